@@ -0,0 +1,17 @@
+package api
+
+// the models and the operations table are generated from the contract, run go generate ./... after editing it
+//go:generate go run ../cmd/openapi-gen -spec openapi.yaml -models ../internal/models/openapi.gen.go -operations ../internal/server/operations.gen.go
+//go:generate go run ../cmd/openapi-gen -spec openapi.v2.yaml -base openapi.yaml -models ../internal/models/openapi_v2.gen.go -operations ../internal/server/operations_v2.gen.go -operations-prefix V2
+
+import _ "embed"
+
+// OpenAPISpec is the contract built into the binary, served unless a path to the contract is configured
+//
+//go:embed openapi.yaml
+var OpenAPISpec []byte
+
+// OpenAPISpecV2 is the contract of v2, whose schemas shared with v1 must stay identical to the ones of v1
+//
+//go:embed openapi.v2.yaml
+var OpenAPISpecV2 []byte
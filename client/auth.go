@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// Auth adds the credentials of the caller to a request; it is called before every attempt, so that an expiring
+// token can be refreshed between retries
+type Auth interface {
+	Authenticate(req *http.Request) error
+}
+
+// AuthFunc turns a function into an Auth
+type AuthFunc func(req *http.Request) error
+
+func (f AuthFunc) Authenticate(req *http.Request) error {
+	return f(req)
+}
+
+// APIKeyHeader is the header of the ApiKeyAuth security scheme
+const APIKeyHeader = "X-API-Key"
+
+// APIKey authenticates with a shared API key
+func APIKey(key string) Auth {
+	return AuthFunc(func(req *http.Request) error {
+		req.Header.Set(APIKeyHeader, key)
+		return nil
+	})
+}
+
+// BearerToken authenticates with a JWT that never changes
+func BearerToken(token string) Auth {
+	return BearerTokenSource(func(context.Context) (string, error) {
+		return token, nil
+	})
+}
+
+// BearerTokenSource authenticates with the JWT returned by token, which is asked again before every attempt
+func BearerTokenSource(token func(ctx context.Context) (string, error)) Auth {
+	return AuthFunc(func(req *http.Request) error {
+		value, err := token(req.Context())
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+value)
+		return nil
+	})
+}
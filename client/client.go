@@ -0,0 +1,404 @@
+// Package client is a typed client of the API described by api/openapi.yaml, for the device simulators and the tools
+// that talk to the server; it has a method for every operation of the contract, named after its operationId
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/requestid"
+)
+
+// APIPrefix is where the operations of the contract are served
+const APIPrefix = "/api/v1"
+
+// APIPrefixV2 is where the operations that only v2 of the contract serves are found, e.g. DeviceReadingsGet
+const APIPrefixV2 = "/api/v2"
+
+type Client interface {
+	// TempPost sends a reading in the device_id:epoch_ms:'Temperature':temperature format
+	TempPost(ctx context.Context, data string) (*TempPostResponse, error)
+	ErrorsGet(ctx context.Context) (*GetErrorsResponse, error)
+	ErrorsDelete(ctx context.Context) error
+	FleetSummaryGet(ctx context.Context, query FleetSummaryQuery) (*FleetSummaryResponse, error)
+	// DeviceReadingsGet lists the last readings of a device, newest first, from v2 of the contract; limit 0 leaves the
+	// default of the server
+	DeviceReadingsGet(ctx context.Context, deviceId int32, limit int) (*DeviceReadingsResponse, error)
+	AuditGet(ctx context.Context, query AuditQuery) (*GetAuditResponse, error)
+	VersionGet(ctx context.Context) (*VersionResponse, error)
+	// Healthz and Readyz answer with the state of the server rather than an error when it is unavailable, and are
+	// never retried
+	Healthz(ctx context.Context) (*HealthResponse, error)
+	Readyz(ctx context.Context, verbose bool) (*HealthResponse, error)
+}
+
+// RetryPolicy retries the requests failing with a 5xx, a 429 or a transport error, waiting for an exponential
+// backoff with jitter, or for the Retry-After of the server when it is longer. A POST may already have been carried
+// out when it fails, so it is only retried on a 429 or a 503, or on a transport error raised before any byte of it
+// was sent.
+type RetryPolicy struct {
+	// MaxRetries is the number of attempts after the first one; 0 turns the retries off
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy retries three times, within a few seconds
+var DefaultRetryPolicy = RetryPolicy{MaxRetries: 3, InitialBackoff: 100 * time.Millisecond, MaxBackoff: 2 * time.Second}
+
+type Config struct {
+	// HTTPClient sends the requests, e.g. with the client certificate of a device; http.DefaultClient when nil
+	HTTPClient *http.Client
+	// Auth adds the credentials to every request; the requests are anonymous when nil
+	Auth  Auth
+	Retry RetryPolicy
+	// UserAgent is sent along with every request when set
+	UserAgent string
+}
+
+// DefaultConfig sends anonymous requests with the DefaultRetryPolicy
+func DefaultConfig() Config {
+	return Config{Retry: DefaultRetryPolicy}
+}
+
+// FleetSummaryQuery holds the parameters of FleetSummaryGet; the zero values leave the defaults of the server
+type FleetSummaryQuery struct {
+	WindowMinutes int
+	Top           int
+}
+
+// Error is the answer of the server to a request that failed
+type Error struct {
+	Method     string
+	Path       string
+	StatusCode int
+	// Code is the machine-readable reason of the failure, e.g. invalid_temperature; see docs/problems.md
+	Code string
+	// Message is the detail of the problem, or the error of a legacy response, or its body when it is neither
+	Message   string
+	RequestId string
+	// Errors lists every part of the request that does not match the contract
+	Errors []ValidationError
+	// RetryAfter is the wait asked for by a 429 or a 503
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	message := fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Code != "" {
+		message += ": " + e.Code
+	}
+	if e.Message != "" {
+		message += ": " + e.Message
+	}
+	if e.RequestId != "" {
+		message += " (request id " + e.RequestId + ")"
+	}
+	return message
+}
+
+// StatusCode returns the status code of an *Error, and 0 for any other error, e.g. a cancelled context
+func StatusCode(err error) int {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+type clientImpl struct {
+	baseURL *url.URL
+	config  Config
+}
+
+// NewClient creates a Client of the server at serverURL, e.g. https://localhost:8080
+func NewClient(serverURL string, cfg Config) (Client, error) {
+	baseURL, err := url.Parse(strings.TrimSuffix(serverURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("server URL: %w", err)
+	}
+	if baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+		return nil, fmt.Errorf("server URL: expected an http or https URL, got %q", serverURL)
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	if cfg.Retry.MaxRetries < 0 {
+		return nil, fmt.Errorf("retry: max retries must not be negative, got %d", cfg.Retry.MaxRetries)
+	}
+	if cfg.Retry.InitialBackoff <= 0 {
+		cfg.Retry.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if cfg.Retry.MaxBackoff < cfg.Retry.InitialBackoff {
+		cfg.Retry.MaxBackoff = max(DefaultRetryPolicy.MaxBackoff, cfg.Retry.InitialBackoff)
+	}
+	return &clientImpl{baseURL: baseURL, config: cfg}, nil
+}
+
+func (c *clientImpl) TempPost(ctx context.Context, data string) (*TempPostResponse, error) {
+	var response TempPostResponse
+	err := c.do(ctx, http.MethodPost, APIPrefix+"/temp", nil, TempPostBody{Data: data}, &response, true)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (c *clientImpl) ErrorsGet(ctx context.Context) (*GetErrorsResponse, error) {
+	var response GetErrorsResponse
+	if err := c.do(ctx, http.MethodGet, APIPrefix+"/errors", nil, nil, &response, true); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (c *clientImpl) ErrorsDelete(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, APIPrefix+"/errors", nil, nil, nil, true)
+}
+
+func (c *clientImpl) FleetSummaryGet(ctx context.Context, query FleetSummaryQuery) (*FleetSummaryResponse, error) {
+	values := url.Values{}
+	if query.WindowMinutes > 0 {
+		values.Set("window_minutes", strconv.Itoa(query.WindowMinutes))
+	}
+	if query.Top > 0 {
+		values.Set("top", strconv.Itoa(query.Top))
+	}
+
+	var response FleetSummaryResponse
+	if err := c.do(ctx, http.MethodGet, APIPrefix+"/fleet/summary", values, nil, &response, true); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (c *clientImpl) DeviceReadingsGet(ctx context.Context, deviceId int32, limit int) (*DeviceReadingsResponse, error) {
+	values := url.Values{}
+	if limit > 0 {
+		values.Set("limit", strconv.Itoa(limit))
+	}
+
+	var response DeviceReadingsResponse
+	path := fmt.Sprintf("%s/devices/%d/readings", APIPrefixV2, deviceId)
+	if err := c.do(ctx, http.MethodGet, path, values, nil, &response, true); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (c *clientImpl) AuditGet(ctx context.Context, query AuditQuery) (*GetAuditResponse, error) {
+	values := url.Values{}
+	if query.Action != "" {
+		values.Set("action", query.Action)
+	}
+	if query.Actor != "" {
+		values.Set("actor", query.Actor)
+	}
+	if !query.Since.IsZero() {
+		values.Set("since", query.Since.Format(time.RFC3339))
+	}
+	if query.Limit > 0 {
+		values.Set("limit", strconv.Itoa(query.Limit))
+	}
+
+	var response GetAuditResponse
+	if err := c.do(ctx, http.MethodGet, APIPrefix+"/audit", values, nil, &response, true); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (c *clientImpl) VersionGet(ctx context.Context) (*VersionResponse, error) {
+	var response VersionResponse
+	if err := c.do(ctx, http.MethodGet, APIPrefix+"/admin/version", nil, nil, &response, true); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (c *clientImpl) Healthz(ctx context.Context) (*HealthResponse, error) {
+	return c.health(ctx, "/healthz", nil)
+}
+
+func (c *clientImpl) Readyz(ctx context.Context, verbose bool) (*HealthResponse, error) {
+	var values url.Values
+	if verbose {
+		values = url.Values{"verbose": {"true"}}
+	}
+	return c.health(ctx, "/readyz", values)
+}
+
+func (c *clientImpl) health(ctx context.Context, path string, query url.Values) (*HealthResponse, error) {
+	var response HealthResponse
+	err := c.do(ctx, http.MethodGet, path, query, nil, &response, false)
+	if StatusCode(err) == http.StatusServiceUnavailable && response.Status != "" {
+		return &response, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// do sends the request until it succeeds, fails for good or runs out of retries, and decodes the response into out;
+// the response of a failed request is decoded too, when it has the shape of out
+func (c *clientImpl) do(ctx context.Context, method, path string, query url.Values, in, out interface{}, retry bool) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	requestURL := *c.baseURL
+	requestURL.Path += path
+	requestURL.RawQuery = query.Encode()
+
+	for attempt := 0; ; attempt++ {
+		sent, err := c.attempt(ctx, method, requestURL.String(), body, out)
+		if err == nil || !retry || attempt >= c.config.Retry.MaxRetries || !retryable(ctx, method, sent, err) {
+			return err
+		}
+
+		wait := c.backoff(attempt)
+		var apiErr *Error
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > wait {
+			wait = apiErr.RetryAfter
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends the request once; sent tells whether any of it may have reached the server
+func (c *clientImpl) attempt(ctx context.Context, method, requestURL string, body []byte, out interface{}) (sent bool, err error) {
+	// the first header written to the connection is the earliest point the server may act on the request
+	var written atomic.Bool
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		WroteHeaderField: func(string, []string) { written.Store(true) },
+	})
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json, application/problem+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.config.UserAgent != "" {
+		req.Header.Set("User-Agent", c.config.UserAgent)
+	}
+	if c.config.Auth != nil {
+		if err := c.config.Auth.Authenticate(req); err != nil {
+			return false, fmt.Errorf("auth: %w", err)
+		}
+	}
+
+	resp, err := c.config.HTTPClient.Do(req)
+	if err != nil {
+		return written.Load(), err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return true, err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if out == nil || len(data) == 0 {
+			return true, nil
+		}
+		if err := json.Unmarshal(data, out); err != nil {
+			return true, fmt.Errorf("%s %s: decoding the response: %w", method, req.URL.Path, err)
+		}
+		return true, nil
+	}
+
+	apiErr := &Error{
+		Method:     method,
+		Path:       req.URL.Path,
+		StatusCode: resp.StatusCode,
+		RequestId:  resp.Header.Get(requestid.Header),
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	// a problem, or the legacy shape of an older server
+	var errorResponse struct {
+		Problem
+		Error string `json:"error"`
+	}
+	switch {
+	case json.Unmarshal(data, &errorResponse) != nil:
+		apiErr.Message = strings.TrimSpace(string(data))
+	case errorResponse.Code != "":
+		apiErr.Code = errorResponse.Code
+		apiErr.Message = errorResponse.Detail
+		apiErr.Errors = errorResponse.Errors
+	case errorResponse.Error != "":
+		apiErr.Message = errorResponse.Error
+	default:
+		apiErr.Message = strings.TrimSpace(string(data))
+	}
+	if out != nil {
+		// e.g. the checks of a server that is not ready
+		_ = json.Unmarshal(data, out)
+	}
+	return true, apiErr
+}
+
+// retryable tells the errors worth another attempt: the server being overloaded or failing, and the connection
+// failing, but not the caller giving up. A request that is not idempotent is only sent again when the server
+// turned it away, or when it never left the client, so that a reading is not recorded twice.
+func retryable(ctx context.Context, method string, sent bool, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		if apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode == http.StatusServiceUnavailable {
+			return true
+		}
+		return apiErr.StatusCode >= 500 && idempotent(method)
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && (idempotent(method) || !sent)
+}
+
+// idempotent tells the methods whose requests have the same effect when they are carried out twice
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// backoff doubles the wait after every attempt up to MaxBackoff, and picks a random wait in its upper half so that
+// the devices failing together do not retry together
+func (c *clientImpl) backoff(attempt int) time.Duration {
+	wait := c.config.Retry.MaxBackoff
+	if attempt < 30 {
+		wait = min(c.config.Retry.InitialBackoff<<attempt, c.config.Retry.MaxBackoff)
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
@@ -0,0 +1,284 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/api"
+	"github.com/sarabrajsingh/restful-openapi/client"
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/audit"
+	"github.com/sarabrajsingh/restful-openapi/internal/codegen"
+	"github.com/sarabrajsingh/restful-openapi/internal/fleet"
+	"github.com/sarabrajsingh/restful-openapi/internal/global_errors"
+	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+	"github.com/sarabrajsingh/restful-openapi/internal/server"
+	"github.com/sarabrajsingh/restful-openapi/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestClientCoversContract fails when an operation is added to the contract without its method on the Client
+func TestClientCoversContract(t *testing.T) {
+	contract, err := codegen.Load(api.OpenAPISpec, "api/openapi.yaml")
+	assert.NoError(t, err)
+	operations, err := contract.Operations()
+	assert.NoError(t, err)
+
+	clientType := reflect.TypeOf((*client.Client)(nil)).Elem()
+	for _, operation := range operations {
+		// the home page redirects browsers to the Swagger UI
+		if operation.Id == server.OperationIndex {
+			continue
+		}
+		_, found := clientType.MethodByName(operation.Name)
+		assert.True(t, found, "Client has no method for %s %s, add %s", operation.Method, operation.Path, operation.Name)
+	}
+}
+
+// TestRoundTrip tests every method of the client against the routes, the validation and the stores of the server
+func TestRoundTrip(t *testing.T) {
+	logger, err := logging.NewLogger(io.Discard, logging.FormatText, slog.LevelError)
+	assert.NoError(t, err)
+
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.ResponseValidation = config.ResponseValidationEnforce
+	cfg.APIKeys = []config.APIKey{
+		{Name: "gateway-01", Key: "device-secret", Scopes: []string{"ingest"}},
+		{Name: "ops", Key: "admin-secret", Scopes: []string{"ingest", "read", "admin"}},
+	}
+	srv := server.NewServer(cfg, logger, global_errors.NewErrorStore(), fleet.NewFleetStore(), audit.NewAuditStore(), utils.DefaultBodyReader)
+	testServer := httptest.NewServer(srv.NewRouter())
+	defer testServer.Close()
+
+	newClient := func(auth client.Auth) client.Client {
+		c, err := client.NewClient(testServer.URL, client.Config{Auth: auth, UserAgent: "client-test"})
+		assert.NoError(t, err)
+		return c
+	}
+	ctx := context.Background()
+	device := newClient(client.APIKey("device-secret"))
+	admin := newClient(client.APIKey("admin-secret"))
+
+	response, err := device.TempPost(ctx, "365951380:1640995229697:'Temperature':58.48256793121914")
+	assert.NoError(t, err)
+	assert.False(t, response.Overtemp)
+
+	response, err = device.TempPost(ctx, "365951380:1640995229697:'Temperature':98.48256793121914")
+	assert.NoError(t, err)
+	assert.True(t, response.Overtemp)
+	assert.Equal(t, int32(365951380), response.DeviceId)
+
+	_, err = device.TempPost(ctx, "foobar")
+	var apiErr *client.Error
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, "invalid_argument_count", apiErr.Code)
+	assert.Equal(t, "invalid number of arguments in request body", apiErr.Message)
+	assert.NotEmpty(t, apiErr.RequestId)
+
+	_, err = admin.FleetSummaryGet(ctx, client.FleetSummaryQuery{WindowMinutes: 120})
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "invalid_parameter", apiErr.Code)
+	assert.Equal(t, []client.ValidationError{{In: "query", Parameter: "window_minutes", Detail: "number must be at most 60"}}, apiErr.Errors)
+
+	errorsResponse, err := admin.ErrorsGet(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foobar"}, errorsResponse.Errors)
+
+	summary, err := admin.FleetSummaryGet(ctx, client.FleetSummaryQuery{WindowMinutes: 10, Top: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, summary.TotalDevices)
+	assert.Equal(t, 1, summary.OvertempDevices)
+	assert.Equal(t, 10, summary.WindowMinutes)
+	assert.Len(t, summary.HottestDevices, 1)
+
+	readings, err := admin.DeviceReadingsGet(ctx, 365951380, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(365951380), readings.DeviceId)
+	if assert.Len(t, readings.Readings, 1) {
+		assert.Equal(t, 98.48256793121914, readings.Readings[0].Temperature)
+		assert.True(t, readings.Readings[0].Overtemp)
+	}
+	_, err = admin.DeviceReadingsGet(ctx, 42, 0)
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	assert.Equal(t, "unknown_device", apiErr.Code)
+
+	// a device key cannot clear the errors, which is not worth a retry
+	assert.Equal(t, http.StatusForbidden, client.StatusCode(device.ErrorsDelete(ctx)))
+	assert.Equal(t, http.StatusUnauthorized, client.StatusCode(newClient(nil).ErrorsDelete(ctx)))
+	assert.NoError(t, admin.ErrorsDelete(ctx))
+
+	errorsResponse, err = admin.ErrorsGet(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, errorsResponse.Errors)
+
+	auditResponse, err := admin.AuditGet(ctx, client.AuditQuery{Action: "errors.delete", Since: time.Now().Add(-time.Hour), Limit: 10})
+	assert.NoError(t, err)
+	// the refused attempts are audited too, newest first
+	if assert.Len(t, auditResponse.Entries, 3) {
+		assert.Equal(t, "apiKey:ops", auditResponse.Entries[0].Actor)
+		assert.Equal(t, http.StatusUnauthorized, auditResponse.Entries[1].Status)
+		assert.Equal(t, http.StatusForbidden, auditResponse.Entries[2].Status)
+	}
+
+	version, err := admin.VersionGet(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, cfg.Version(), version.ConfigVersion)
+
+	health, err := device.Healthz(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", health.Status)
+
+	health, err = device.Readyz(ctx, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", health.Checks["specification"].Status)
+
+	// a draining server is reported, not failed
+	srv.StartDraining()
+	health, err = device.Readyz(ctx, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "unavailable", health.Status)
+}
+
+// TestRetries tests which failures are retried, and that the credentials are added to every attempt
+func TestRetries(t *testing.T) {
+	retry := client.RetryPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+	post := func(c client.Client) error {
+		_, err := c.TempPost(context.Background(), "1:2:'Temperature':3")
+		return err
+	}
+	get := func(c client.Client) error {
+		_, err := c.ErrorsGet(context.Background())
+		return err
+	}
+
+	testCases := []struct {
+		description      string
+		call             func(client.Client) error
+		statuses         []int
+		expectedStatus   int
+		expectedAttempts int32
+	}{
+		{"Recovers from a 503 and a 429", post, []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, 0, 3},
+		{"Gives up after the retries", get, []int{http.StatusBadGateway}, http.StatusBadGateway, 4},
+		{"Does not retry a POST answered with a 502, which may have been recorded", post, []int{http.StatusBadGateway}, http.StatusBadGateway, 1},
+		{"Does not retry a 400", post, []int{http.StatusBadRequest}, http.StatusBadRequest, 1},
+		{"Does not retry a 401", get, []int{http.StatusUnauthorized}, http.StatusUnauthorized, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			var attempts atomic.Int32
+			testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempt := int(attempts.Add(1)) - 1
+				assert.Equal(t, "device-secret", r.Header.Get(client.APIKeyHeader))
+				if r.Method == http.MethodPost {
+					body, _ := io.ReadAll(r.Body)
+					assert.JSONEq(t, `{"data":"1:2:'Temperature':3"}`, string(body))
+				}
+
+				status := tc.statuses[min(attempt, len(tc.statuses)-1)]
+				if status != http.StatusOK {
+					utils.WriteErrorResponse(w, http.StatusText(status), status)
+					return
+				}
+				if r.Method == http.MethodPost {
+					w.Write([]byte(`{"overtemp":false}`))
+					return
+				}
+				w.Write([]byte(`{"errors":[]}`))
+			}))
+			defer testServer.Close()
+
+			c, err := client.NewClient(testServer.URL, client.Config{Auth: client.APIKey("device-secret"), Retry: retry})
+			assert.NoError(t, err)
+
+			assert.Equal(t, tc.expectedStatus, client.StatusCode(tc.call(c)))
+			assert.Equal(t, tc.expectedAttempts, attempts.Load())
+		})
+	}
+}
+
+// TestRetriesOfTransportErrors tests that a POST is only sent again when the previous attempt never left the client
+func TestRetriesOfTransportErrors(t *testing.T) {
+	retry := client.RetryPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+	// the connection is dropped once the request has been read, as if the server died while answering
+	var received atomic.Int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer testServer.Close()
+
+	c, err := client.NewClient(testServer.URL, client.Config{Retry: retry})
+	assert.NoError(t, err)
+	_, err = c.TempPost(context.Background(), "1:2:'Temperature':3")
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), received.Load())
+
+	received.Store(0)
+	_, err = c.ErrorsGet(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, int32(4), received.Load())
+
+	// a connection that can't be opened sends nothing, so the POST is retried
+	var dials atomic.Int32
+	transport := &http.Transport{DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials.Add(1)
+		return nil, errors.New("connection refused")
+	}}
+	c, err = client.NewClient(testServer.URL, client.Config{HTTPClient: &http.Client{Transport: transport}, Retry: retry})
+	assert.NoError(t, err)
+	_, err = c.TempPost(context.Background(), "1:2:'Temperature':3")
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Equal(t, int32(4), dials.Load())
+}
+
+// TestRetryAfter tests that the wait asked for by the server is honoured, within the deadline of the caller
+func TestRetryAfter(t *testing.T) {
+	var attempts atomic.Int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.Header().Set("Retry-After", "30")
+		utils.WriteErrorResponse(w, "Too Many Requests", http.StatusTooManyRequests)
+	}))
+	defer testServer.Close()
+
+	c, err := client.NewClient(testServer.URL, client.DefaultConfig())
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = c.ErrorsGet(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, int32(1), attempts.Load())
+}
+
+// TestNewClient tests the URLs and the retry policies that are refused
+func TestNewClient(t *testing.T) {
+	_, err := client.NewClient("localhost:8080", client.DefaultConfig())
+	assert.ErrorContains(t, err, "expected an http or https URL")
+
+	_, err = client.NewClient("http://localhost:8080", client.Config{Retry: client.RetryPolicy{MaxRetries: -1}})
+	assert.ErrorContains(t, err, "max retries must not be negative")
+
+	_, err = client.NewClient("http://localhost:8080/", client.Config{})
+	assert.NoError(t, err)
+}
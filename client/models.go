@@ -0,0 +1,27 @@
+package client
+
+import "github.com/sarabrajsingh/restful-openapi/internal/models"
+
+// The types exchanged with the server are aliases of the models generated from the contract, so that the client
+// cannot drift from it, and so that other modules can use them without importing the internal packages
+type (
+	TempPostBody           = models.TempPostBody
+	GetErrorsResponse      = models.GetErrorsResponse
+	ErrorDetail            = models.ErrorDetail
+	FleetSummaryResponse   = models.FleetSummaryResponse
+	FleetDevice            = models.FleetDevice
+	DeviceReadingsResponse = models.DeviceReadingsResponse
+	DeviceReading          = models.DeviceReading
+	AuditQuery             = models.AuditQuery
+	AuditEntry             = models.AuditEntry
+	GetAuditResponse       = models.GetAuditResponse
+	VersionResponse        = models.VersionResponse
+	HealthResponse         = models.HealthResponse
+	HealthCheck            = models.HealthCheck
+	Problem                = models.Problem
+	ValidationError        = models.ValidationError
+)
+
+// TempPostResponse decodes both shapes of the response of POST /temp, since a TempPostGoodResponseWithNoOverTemp is
+// a TempPostGoodResponseWithOverTemp without the device id and the formatted time
+type TempPostResponse = models.TempPostGoodResponseWithOverTemp
@@ -0,0 +1,133 @@
+// Command loadgen sends the readings of a fleet of simulated devices, a mix of valid, malformed and overtemp ones, to
+// a server or to the router of an in-process server, and reports the throughput and the latency percentiles.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/loadtest"
+	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+)
+
+const usage = `Usage: loadgen [flags]
+
+Sends readings of simulated devices for -duration, or until -requests were sent, and reports how the server answered.
+Without -url the readings go to an in-process server configured from CONFIG_FILE and the environment.
+
+Flags:
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run is main without the process; an interrupted run still reports the readings sent so far
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	var target loadtest.Target
+	var opts loadtest.Options
+	mix := loadtest.DefaultMix
+	var devices, requests, cpus int
+	var seed int64
+	var output string
+	flags := flag.NewFlagSet("loadgen", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&target.URL, "url", "", "URL of the server; the readings go to an in-process server when empty")
+	flags.StringVar(&target.APIKey, "api-key", "", "API key sent in X-API-Key")
+	flags.StringVar(&target.Token, "token", "", "bearer token, used when no API key is set")
+	flags.StringVar(&target.CAFile, "ca-file", "", "PEM file of the CA that issued the certificate of the server")
+	flags.BoolVar(&target.RateLimits, "rate-limits", false, "keep the rate limits of the configuration for the in-process server")
+	flags.IntVar(&devices, "devices", 100, "number of simulated devices")
+	flags.Float64Var(&mix.Malformed, "malformed", mix.Malformed, "share of the readings that are malformed, 0 to 1")
+	flags.Float64Var(&mix.Overtemp, "overtemp", mix.Overtemp, "share of the well-formed readings that are overtemp, 0 to 1")
+	flags.Int64Var(&seed, "seed", 1, "seed of the simulated devices and readings")
+	flags.IntVar(&requests, "requests", 0, "number of readings to send, until -duration when 0")
+	flags.DurationVar(&opts.Duration, "duration", 30*time.Second, "time to send readings for, until -requests were sent when 0")
+	flags.IntVar(&opts.Concurrency, "concurrency", 16, "number of requests in flight at once")
+	flags.Float64Var(&opts.Rate, "rate", 0, "requests started per second, as fast as possible when 0")
+	flags.IntVar(&cpus, "cpus", 0, "CPUs the run may use, the in-process server included, e.g. the CPUs of an instance; all of them when 0")
+	flags.StringVar(&output, "output", "text", "report format, text or json")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+	if output != "text" && output != "json" {
+		fmt.Fprintf(stderr, "loadgen: unknown output format %q, expected text or json\n", output)
+		return 2
+	}
+	switch {
+	case devices < 1:
+		fmt.Fprintln(stderr, "loadgen: -devices must be at least 1")
+		return 2
+	case mix.Malformed < 0 || mix.Malformed > 1 || mix.Overtemp < 0 || mix.Overtemp > 1:
+		fmt.Fprintln(stderr, "loadgen: -malformed and -overtemp must be between 0 and 1")
+		return 2
+	case requests < 0 || opts.Duration < 0 || requests == 0 && opts.Duration == 0:
+		fmt.Fprintln(stderr, "loadgen: set -requests, -duration or both")
+		return 2
+	case opts.Concurrency < 1 || opts.Rate < 0:
+		fmt.Fprintln(stderr, "loadgen: -concurrency must be at least 1 and -rate must not be negative")
+		return 2
+	case cpus < 0:
+		fmt.Fprintln(stderr, "loadgen: -cpus must not be negative")
+		return 2
+	}
+	if cpus > 0 {
+		defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(cpus))
+	}
+
+	// the in-process server only logs its errors, so that logging the malformed readings does not skew the numbers
+	var err error
+	target.Logger, err = logging.NewLogger(stderr, logging.FormatText, slog.LevelError)
+	if err != nil {
+		fmt.Fprintf(stderr, "loadgen: %v\n", err)
+		return 2
+	}
+	c, err := target.NewClient()
+	if err != nil {
+		fmt.Fprintf(stderr, "loadgen: %v\n", err)
+		return 2
+	}
+
+	// the duration stops sending readings, and lets the requests in flight finish; the generator stops with the run
+	generating, stopGenerating := context.WithCancel(ctx)
+	defer stopGenerating()
+	generator := loadtest.NewGenerator(devices, mix, seed)
+	report := loadtest.Run(ctx, c, generator.Stream(generating, requests), opts)
+
+	if output == "json" {
+		err = report.WriteJSON(stdout)
+	} else {
+		err = report.WriteText(stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "loadgen: %v\n", err)
+		return 1
+	}
+	if report.StatusCodes["0"] > 0 {
+		fmt.Fprintf(stderr, "loadgen: %d of %d readings got no response\n", report.StatusCodes["0"], report.Requests)
+		return 1
+	}
+	return 0
+}
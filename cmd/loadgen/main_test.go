@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/loadtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func loadgen(ctx context.Context, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(ctx, args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestLoadgen(t *testing.T) {
+	// the in-process server leaves out the rate limits, which would turn the malformed readings into 429s
+	code, stdout, stderr := loadgen(context.Background(), "-devices", "50", "-requests", "200", "-malformed", "0.2", "-overtemp", "0.5", "-output", "json")
+	assert.Equal(t, 0, code, stderr)
+	var report loadtest.Report
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &report))
+	assert.Equal(t, 200, report.Requests)
+	assert.Equal(t, 200, report.StatusCodes["200"]+report.StatusCodes["400"])
+	assert.Greater(t, report.StatusCodes["400"], 0)
+	assert.Greater(t, report.Overtemp, 0)
+	assert.Greater(t, report.Throughput, 0.0)
+	assert.Zero(t, report.RateLimited)
+
+	// unless asked to keep them, and the 429s answered early only count towards the throughput
+	code, stdout, stderr = loadgen(context.Background(), "-devices", "1", "-requests", "50", "-rate-limits", "-cpus", "1", "-output", "json")
+	assert.Equal(t, 0, code, stderr)
+	report = loadtest.Report{}
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &report))
+	assert.Equal(t, 50, report.Accepted+report.StatusCodes["400"]+report.RateLimited)
+	assert.GreaterOrEqual(t, report.RateLimited, 20)
+	assert.Less(t, report.AcceptedThroughput, report.Throughput)
+
+	// the duration ends the run, which reports every request sent
+	code, stdout, _ = loadgen(context.Background(), "-devices", "1", "-rate", "20", "-duration", "200ms", "-output", "json")
+	assert.Equal(t, 0, code)
+	report = loadtest.Report{}
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &report))
+	// a reading is due every 50ms, and the one in flight when the duration ends still finishes
+	assert.GreaterOrEqual(t, report.Requests, 3)
+	assert.LessOrEqual(t, report.Requests, 5)
+	assert.Zero(t, report.StatusCodes["0"])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	code, stdout, _ = loadgen(ctx, "-rate", "10", "-duration", "0", "-requests", "100")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "throughput")
+
+	code, _, stderr = loadgen(context.Background(), "-duration", "0")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "set -requests, -duration or both")
+
+	code, _, stderr = loadgen(context.Background(), "-malformed", "2")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "between 0 and 1")
+
+	code, _, stderr = loadgen(context.Background(), "-cpus", "-1")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "-cpus must not be negative")
+}
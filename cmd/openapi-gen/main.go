@@ -0,0 +1,66 @@
+// Command openapi-gen renders the models and the operations table of the server from the OpenAPI contract; it is
+// run by go generate, see api/api.go
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/codegen"
+)
+
+func main() {
+	spec := flag.String("spec", "openapi.yaml", "OpenAPI contract to generate from")
+	base := flag.String("base", "", "contract of a previous version, whose schemas are generated with it and left out")
+	models := flag.String("models", "", "file the models are written to")
+	modelsPackage := flag.String("models-package", "models", "package of the models")
+	operations := flag.String("operations", "", "file the operationIds and the Handlers table are written to")
+	operationsPackage := flag.String("operations-package", "server", "package of the operations table")
+	operationsPrefix := flag.String("operations-prefix", "", "added to the names of the operations table, e.g. V2")
+	flag.Parse()
+
+	contract := load(*spec)
+	var baseContract *codegen.Contract
+	if *base != "" {
+		baseContract = load(*base)
+	}
+
+	if *models != "" {
+		write(*models, func() ([]byte, error) { return contract.GenerateModels(*modelsPackage, baseContract) })
+	}
+	if *operations != "" {
+		write(*operations, func() ([]byte, error) { return contract.GenerateOperations(*operationsPackage, *operationsPrefix) })
+	}
+}
+
+func load(spec string) *codegen.Contract {
+	data, err := os.ReadFile(spec)
+	if err != nil {
+		log.Fatalf("Couldn't read the contract: %v", err)
+	}
+
+	// the header names the contract by its folder, e.g. api/openapi.yaml, wherever the command is run from
+	source, err := filepath.Abs(spec)
+	if err != nil {
+		log.Fatalf("Couldn't read the contract: %v", err)
+	}
+	source = filepath.ToSlash(filepath.Join(filepath.Base(filepath.Dir(source)), filepath.Base(source)))
+
+	contract, err := codegen.Load(data, source)
+	if err != nil {
+		log.Fatalf("Couldn't load the contract %s: %v", spec, err)
+	}
+	return contract
+}
+
+func write(file string, generate func() ([]byte, error)) {
+	code, err := generate()
+	if err != nil {
+		log.Fatalf("Couldn't generate %s: %v", file, err)
+	}
+	if err := os.WriteFile(file, code, 0644); err != nil {
+		log.Fatalf("Couldn't write %s: %v", file, err)
+	}
+}
@@ -0,0 +1,150 @@
+// Command replay submits the readings of a JSON lines file of TempPostBody records to a server, or to the router of
+// an in-process server, and reports the status codes, the overtemp readings and the latency percentiles.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/sarabrajsingh/restful-openapi/client"
+	"github.com/sarabrajsingh/restful-openapi/internal/loadtest"
+	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+)
+
+const usage = `Usage: replay [flags] <file.jsonl | ->
+
+Submits every {"data": ...} record of the file, or of stdin with -, and reports how the server answered. Without
+-url the records go to an in-process server configured from CONFIG_FILE and the environment.
+
+Flags:
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run is main without the process; an interrupted replay still reports the readings sent so far
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var target loadtest.Target
+	var opts loadtest.Options
+	var output string
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&target.URL, "url", "", "URL of the server; the records go to an in-process server when empty")
+	flags.StringVar(&target.APIKey, "api-key", "", "API key sent in X-API-Key")
+	flags.StringVar(&target.Token, "token", "", "bearer token, used when no API key is set")
+	flags.StringVar(&target.CAFile, "ca-file", "", "PEM file of the CA that issued the certificate of the server")
+	flags.BoolVar(&target.RateLimits, "rate-limits", false, "keep the rate limits of the configuration for the in-process server")
+	flags.DurationVar(&target.RequestTimeout, "request-timeout", loadtest.DefaultRequestTimeout, "bound every request, including the ones in flight when the replay stops")
+	flags.IntVar(&opts.Concurrency, "concurrency", 4, "number of requests in flight at once")
+	flags.Float64Var(&opts.Rate, "rate", 0, "requests started per second, as fast as possible when 0")
+	flags.StringVar(&output, "output", "text", "report format, text or json")
+	flags.DurationVar(&opts.Duration, "timeout", 0, "stop the replay after this long, never when 0")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	if output != "text" && output != "json" {
+		fmt.Fprintf(stderr, "replay: unknown output format %q, expected text or json\n", output)
+		return 2
+	}
+	if opts.Concurrency < 1 || opts.Rate < 0 || target.RequestTimeout <= 0 {
+		fmt.Fprintln(stderr, "replay: -concurrency must be at least 1, -rate must not be negative and -request-timeout must be positive")
+		return 2
+	}
+
+	readings, err := readFile(flags.Arg(0), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "replay: %v\n", err)
+		return 2
+	}
+
+	// the in-process server only logs its errors, so that they do not drown the report
+	target.Logger, err = logging.NewLogger(stderr, logging.FormatText, slog.LevelError)
+	if err != nil {
+		fmt.Fprintf(stderr, "replay: %v\n", err)
+		return 2
+	}
+	c, err := target.NewClient()
+	if err != nil {
+		fmt.Fprintf(stderr, "replay: %v\n", err)
+		return 2
+	}
+
+	// the timeout stops sending readings, and lets the requests in flight finish
+	source := make(chan string, len(readings))
+	for _, data := range readings {
+		source <- data
+	}
+	close(source)
+	report := loadtest.Run(ctx, c, source, opts)
+
+	if output == "json" {
+		err = report.WriteJSON(stdout)
+	} else {
+		err = report.WriteText(stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "replay: %v\n", err)
+		return 1
+	}
+	if report.StatusCodes["0"] > 0 {
+		fmt.Fprintf(stderr, "replay: %d of %d readings got no response\n", report.StatusCodes["0"], report.Requests)
+		return 1
+	}
+	return 0
+}
+
+// readFile reads every record before the first request, so that a broken file sends nothing; blank lines are
+// skipped
+func readFile(path string, stdin io.Reader) ([]string, error) {
+	r := stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var readings []string
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var body client.TempPostBody
+		if err := json.Unmarshal([]byte(text), &body); err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", path, line, err)
+		}
+		readings = append(readings, body.Data)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return readings, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/loadtest"
+	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+const records = `{"data": "365951380:1640995229697:'Temperature':58.48256793121914"}
+
+{"data": "365951380:1640995229697:'Temperature':98.48256793121914"}
+{"data": "foobar"}
+`
+
+func replay(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestReplay(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "readings.jsonl")
+	assert.NoError(t, os.WriteFile(file, []byte(records), 0o600))
+
+	// in process
+	code, stdout, stderr := replay("", "-output", "json", file)
+	assert.Equal(t, 0, code, stderr)
+	var report loadtest.Report
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &report))
+	assert.Equal(t, 3, report.Requests)
+	assert.Equal(t, 1, report.Overtemp)
+	assert.Equal(t, map[string]int{"200": 2, "400": 1}, report.StatusCodes)
+
+	// against a server, from stdin
+	logger, err := logging.NewLogger(io.Discard, logging.FormatText, slog.LevelError)
+	assert.NoError(t, err)
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.APIKeys = []config.APIKey{{Name: "gateway-01", Key: "device-secret", Scopes: []string{"ingest"}}}
+	testServer := httptest.NewServer(loadtest.NewInProcessRouter(cfg, logger))
+	defer testServer.Close()
+
+	code, stdout, _ = replay(records, "-url", testServer.URL, "-api-key", "device-secret", "-concurrency", "1", "-rate", "50", "-")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "overtemp      1")
+	assert.Contains(t, stdout, "invalid_argument_count  1")
+
+	code, stdout, _ = replay(records, "-url", testServer.URL, "-output", "json", "-")
+	assert.Equal(t, 0, code)
+	report = loadtest.Report{}
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &report))
+	assert.Equal(t, map[string]int{"401": 3}, report.StatusCodes)
+
+	// nothing is sent when a record is broken
+	code, _, stderr = replay("{\"data\": \"foobar\"}\nfoobar\n", "-url", testServer.URL, "-")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "-: line 2")
+
+	code, _, stderr = replay("", "-output", "json", "-url", "http://127.0.0.1:1", file)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "3 of 3 readings got no response")
+
+	code, _, _ = replay("")
+	assert.Equal(t, 2, code)
+}
+
+// TestReplayInProcessRateLimits tests that the in-process server only limits the readings of a device when asked to
+func TestReplayInProcessRateLimits(t *testing.T) {
+	var burst strings.Builder
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&burst, "{\"data\": \"365951380:1640995229697:'Temperature':58.%d\"}\n", i)
+	}
+
+	code, stdout, stderr := replay(burst.String(), "-output", "json", "-")
+	assert.Equal(t, 0, code, stderr)
+	var report loadtest.Report
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &report))
+	assert.Equal(t, map[string]int{"200": 30}, report.StatusCodes)
+
+	// a device sends bursts of at most 20 readings by default
+	code, stdout, stderr = replay(burst.String(), "-output", "json", "-rate-limits", "-concurrency", "1", "-")
+	assert.Equal(t, 0, code, stderr)
+	report = loadtest.Report{}
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &report))
+	assert.Equal(t, 20, report.StatusCodes["200"])
+	assert.Equal(t, 10, report.StatusCodes["429"])
+}
+
+// TestReplayTimeout tests that the timeout stops sending readings but lets the one in flight finish, while
+// -request-timeout gives up on a server that never answers
+func TestReplayTimeout(t *testing.T) {
+	delay := 200 * time.Millisecond
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"overtemp":false}`))
+	}))
+	defer testServer.Close()
+
+	code, stdout, stderr := replay(records, "-url", testServer.URL, "-output", "json", "-concurrency", "1", "-timeout", "50ms", "-")
+	assert.Equal(t, 0, code, stderr)
+	var report loadtest.Report
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &report))
+	assert.Equal(t, map[string]int{"200": 1}, report.StatusCodes)
+
+	code, stdout, stderr = replay(records, "-url", testServer.URL, "-output", "json", "-concurrency", "1", "-timeout", "50ms", "-request-timeout", "100ms", "-")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "1 of 1 readings got no response")
+	report = loadtest.Report{}
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &report))
+	assert.Equal(t, map[string]int{"0": 1}, report.StatusCodes)
+
+	code, _, _ = replay(records, "-request-timeout", "0", "-")
+	assert.Equal(t, 2, code)
+}
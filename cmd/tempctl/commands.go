@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sarabrajsingh/restful-openapi/client"
+	"github.com/sarabrajsingh/restful-openapi/internal/health"
+)
+
+// submitResult is the outcome of a single reading
+type submitResult struct {
+	Data     string                   `json:"data"`
+	Status   int                      `json:"status"`
+	Response *client.TempPostResponse `json:"response,omitempty"`
+	Code     string                   `json:"code,omitempty"`
+	Error    string                   `json:"error,omitempty"`
+}
+
+// submitCommand sends every reading, even after one was rejected, and fails when any of them was
+func submitCommand(ctx context.Context, c client.Client, out *printer, args []string, stdin io.Reader) error {
+	flags := flag.NewFlagSet("submit", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	file := flags.String("file", "", "file of readings, one per line, as data strings or {\"data\": ...} objects")
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("submit: %w", err)
+	}
+
+	var readings []string
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return fmt.Errorf("submit: %w", err)
+		}
+		defer f.Close()
+		if readings, err = readReadings(f); err != nil {
+			return fmt.Errorf("submit: %s: %w", *file, err)
+		}
+	}
+	for _, arg := range flags.Args() {
+		if arg != "-" {
+			readings = append(readings, arg)
+			continue
+		}
+		fromStdin, err := readReadings(stdin)
+		if err != nil {
+			return fmt.Errorf("submit: stdin: %w", err)
+		}
+		readings = append(readings, fromStdin...)
+	}
+	if len(readings) == 0 {
+		return errors.New("submit: pass data strings, -file, or - to read them from stdin")
+	}
+
+	results := make([]submitResult, 0, len(readings))
+	rows := make([][]string, 0, len(readings))
+	rejected := 0
+	for _, data := range readings {
+		result := submitResult{Data: data, Status: http.StatusOK}
+		response, err := c.TempPost(ctx, data)
+		if err != nil {
+			rejected++
+			result.Status = client.StatusCode(err)
+			result.Error = err.Error()
+			var apiErr *client.Error
+			if errors.As(err, &apiErr) {
+				result.Code, result.Error = apiErr.Code, apiErr.Message
+			}
+			rows = append(rows, []string{data, statusText(result.Status), "", "", result.Error})
+		} else {
+			result.Response = response
+			row := []string{data, statusText(result.Status), strconv.FormatBool(response.Overtemp), "", ""}
+			if response.Overtemp {
+				row[3], row[4] = strconv.Itoa(int(response.DeviceId)), response.FormattedTime
+			}
+			rows = append(rows, row)
+		}
+		results = append(results, result)
+	}
+
+	if err := out.print(results, []string{"DATA", "STATUS", "OVERTEMP", "DEVICE", "DETAIL"}, rows); err != nil {
+		return err
+	}
+	if rejected > 0 {
+		return fmt.Errorf("%d of %d readings were rejected", rejected, len(readings))
+	}
+	return nil
+}
+
+// readReadings reads a reading per line, either a bare data string or a TempPostBody as in a JSONL file; blank lines
+// and lines starting with # are skipped
+func readReadings(r io.Reader) ([]string, error) {
+	var readings []string
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if !strings.HasPrefix(text, "{") {
+			readings = append(readings, text)
+			continue
+		}
+		var body client.TempPostBody
+		if err := json.Unmarshal([]byte(text), &body); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		readings = append(readings, body.Data)
+	}
+	return readings, scanner.Err()
+}
+
+// errorsCommand lists or clears the error buffer
+func errorsCommand(ctx context.Context, c client.Client, out *printer, args []string, stdin io.Reader) error {
+	if len(args) == 0 {
+		return errors.New("errors: expected list or clear")
+	}
+
+	switch args[0] {
+	case "list":
+		flags := flag.NewFlagSet("errors list", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		contains := flags.String("contains", "", "only list the errors containing this text, e.g. a device id")
+		requestId := flags.String("request-id", "", "only list the error reported by this request")
+		if err := flags.Parse(args[1:]); err != nil {
+			return fmt.Errorf("errors list: %w", err)
+		}
+
+		response, err := c.ErrorsGet(ctx)
+		if err != nil {
+			return err
+		}
+		details := response.Details
+		// servers older than the request ids only list the errors
+		if len(details) == 0 {
+			for _, e := range response.Errors {
+				details = append(details, client.ErrorDetail{Error: e})
+			}
+		}
+
+		filtered := []client.ErrorDetail{}
+		rows := [][]string{}
+		for _, detail := range details {
+			if !strings.Contains(detail.Error, *contains) || (*requestId != "" && detail.RequestId != *requestId) {
+				continue
+			}
+			filtered = append(filtered, detail)
+			rows = append(rows, []string{detail.RequestId, detail.Error})
+		}
+		return out.print(filtered, []string{"REQUEST ID", "ERROR"}, rows)
+
+	case "clear":
+		if err := c.ErrorsDelete(ctx); err != nil {
+			return err
+		}
+		out.message("Cleared the error buffer")
+		return nil
+	}
+	return fmt.Errorf("errors: unknown command %q, expected list or clear", args[0])
+}
+
+// deviceCommand shows the last readings of a device
+func deviceCommand(ctx context.Context, c client.Client, out *printer, args []string, stdin io.Reader) error {
+	flags := flag.NewFlagSet("device", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	limit := flags.Int("limit", 0, "maximum number of readings, the default of the server when 0")
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("device: %w", err)
+	}
+	if flags.NArg() != 1 {
+		return errors.New("device: expected a device_id")
+	}
+	deviceId, err := strconv.ParseInt(flags.Arg(0), 10, 32)
+	if err != nil {
+		return fmt.Errorf("device: %s is not an int32 device_id", flags.Arg(0))
+	}
+
+	response, err := c.DeviceReadingsGet(ctx, int32(deviceId), *limit)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(response.Readings))
+	for _, reading := range response.Readings {
+		rows = append(rows, []string{
+			reading.ReceivedAt,
+			reading.RecordedAt,
+			strconv.FormatFloat(reading.Temperature, 'f', -1, 64),
+			strconv.FormatBool(reading.Overtemp),
+		})
+	}
+	return out.print(response, []string{"RECEIVED AT", "RECORDED AT", "TEMPERATURE", "OVERTEMP"}, rows)
+}
+
+// healthCommand checks the liveness of the server, or its readiness, and fails when it is not ok
+func healthCommand(ctx context.Context, c client.Client, out *printer, args []string, stdin io.Reader) error {
+	flags := flag.NewFlagSet("health", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	ready := flags.Bool("ready", false, "check the readiness instead of the liveness")
+	verbose := flags.Bool("verbose", false, "list the result of every readiness check")
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("health: %w", err)
+	}
+
+	var response *client.HealthResponse
+	var err error
+	if *ready {
+		response, err = c.Readyz(ctx, *verbose)
+	} else {
+		response, err = c.Healthz(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{{"server", response.Status}}
+	names := make([]string, 0, len(response.Checks))
+	for name := range response.Checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		rows = append(rows, []string{name, response.Checks[name].Status})
+	}
+
+	if err := out.print(response, []string{"CHECK", "STATUS"}, rows); err != nil {
+		return err
+	}
+	if response.Status != health.StatusOK {
+		return fmt.Errorf("server is %s", response.Status)
+	}
+	return nil
+}
+
+func statusText(status int) string {
+	if status == 0 {
+		return "failed"
+	}
+	return strconv.Itoa(status)
+}
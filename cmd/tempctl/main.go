@@ -0,0 +1,152 @@
+// Command tempctl is the command-line client of the API, for the on-call engineers: it submits readings, lists and
+// clears the error buffer, shows the history of a device and checks the health of a server.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/client"
+)
+
+// the environment variables that save passing the flags of every command
+const (
+	URLEnv    = "TEMPCTL_URL"
+	APIKeyEnv = "TEMPCTL_API_KEY"
+	TokenEnv  = "TEMPCTL_TOKEN"
+)
+
+const usage = `Usage: tempctl [flags] <command> [arguments]
+
+Commands:
+  submit [-file path] [data ...]          submit readings given as arguments, or read from a file, or from stdin with -
+  errors list [-contains s] [-request-id id]
+                                          list the error buffer
+  errors clear                            clear the error buffer
+  device [-limit n] <device_id>           show the last readings of a device
+  health [-ready] [-verbose]              check the liveness, or the readiness, of the server
+
+Flags:
+`
+
+// options are the flags shared by every command
+type options struct {
+	url     string
+	apiKey  string
+	token   string
+	caFile  string
+	output  string
+	timeout time.Duration
+}
+
+// command runs a subcommand with its arguments; the exit code is 1 when any part of it failed
+type command func(ctx context.Context, c client.Client, out *printer, args []string, stdin io.Reader) error
+
+var commands = map[string]command{
+	"submit": submitCommand,
+	"errors": errorsCommand,
+	"device": deviceCommand,
+	"health": healthCommand,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run is main without the process, so that the tests can run the commands against a test server
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var opts options
+	flags := flag.NewFlagSet("tempctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&opts.url, "url", envOr(URLEnv, "http://localhost:8080"), "URL of the server, or $"+URLEnv)
+	flags.StringVar(&opts.apiKey, "api-key", os.Getenv(APIKeyEnv), "API key sent in X-API-Key, or $"+APIKeyEnv)
+	flags.StringVar(&opts.token, "token", os.Getenv(TokenEnv), "bearer token, or $"+TokenEnv+"; used when no API key is set")
+	flags.StringVar(&opts.caFile, "ca-file", "", "PEM file of the CA that issued the certificate of the server")
+	flags.StringVar(&opts.output, "output", "table", "output format, table or json")
+	flags.DurationVar(&opts.timeout, "timeout", 30*time.Second, "time allowed for the command, retries included")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "tempctl: unknown command %q\n", flags.Arg(0))
+		flags.Usage()
+		return 2
+	}
+
+	out, err := newPrinter(stdout, opts.output)
+	if err != nil {
+		fmt.Fprintf(stderr, "tempctl: %v\n", err)
+		return 2
+	}
+
+	c, err := newClient(opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "tempctl: %v\n", err)
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+
+	if err := cmd(ctx, c, out, flags.Args()[1:], stdin); err != nil {
+		fmt.Fprintf(stderr, "tempctl: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func newClient(opts options) (client.Client, error) {
+	cfg := client.DefaultConfig()
+	cfg.UserAgent = "tempctl"
+
+	switch {
+	case opts.apiKey != "":
+		cfg.Auth = client.APIKey(opts.apiKey)
+	case opts.token != "":
+		cfg.Auth = client.BearerToken(opts.token)
+	}
+
+	if opts.caFile != "" {
+		pem, err := os.ReadFile(opts.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA file: no certificate found in %s", opts.caFile)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+		cfg.HTTPClient = &http.Client{Transport: transport}
+	}
+
+	return client.NewClient(opts.url, cfg)
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
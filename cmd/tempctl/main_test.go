@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/audit"
+	"github.com/sarabrajsingh/restful-openapi/internal/fleet"
+	"github.com/sarabrajsingh/restful-openapi/internal/global_errors"
+	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+	"github.com/sarabrajsingh/restful-openapi/internal/server"
+	"github.com/sarabrajsingh/restful-openapi/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommands(t *testing.T) {
+	logger, err := logging.NewLogger(io.Discard, logging.FormatText, slog.LevelError)
+	assert.NoError(t, err)
+
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.ResponseValidation = config.ResponseValidationEnforce
+	cfg.APIKeys = []config.APIKey{
+		{Name: "gateway-01", Key: "device-secret", Scopes: []string{"ingest"}},
+		{Name: "ops", Key: "admin-secret", Scopes: []string{"ingest", "read", "admin"}},
+	}
+	srv := server.NewServer(cfg, logger, global_errors.NewErrorStore(), fleet.NewFleetStore(), audit.NewAuditStore(), utils.DefaultBodyReader)
+	testServer := httptest.NewServer(srv.NewRouter())
+	defer testServer.Close()
+
+	tempctl := func(stdin string, args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		args = append([]string{"-url", testServer.URL, "-api-key", "admin-secret"}, args...)
+		code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+		return code, stdout.String(), stderr.String()
+	}
+
+	file := filepath.Join(t.TempDir(), "readings.jsonl")
+	assert.NoError(t, os.WriteFile(file, []byte("# a comment\n{\"data\": \"365951380:1640995229697:'Temperature':98.48256793121914\"}\n\n"), 0o600))
+
+	code, stdout, stderr := tempctl("365951380:1640995229697:'Temperature':58.48256793121914\nfoobar\n", "submit", "-file", file, "-")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "tempctl: 1 of 3 readings were rejected\n", stderr)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if assert.Len(t, lines, 4) {
+		assert.Equal(t, []string{"DATA", "STATUS", "OVERTEMP", "DEVICE", "DETAIL"}, strings.Fields(lines[0]))
+		assert.Equal(t, []string{"365951380:1640995229697:'Temperature':98.48256793121914", "200", "true", "365951380"}, strings.Fields(lines[1])[:4])
+		assert.Equal(t, []string{"365951380:1640995229697:'Temperature':58.48256793121914", "200", "false"}, strings.Fields(lines[2]))
+		assert.True(t, strings.HasPrefix(lines[3], "foobar"))
+		assert.Contains(t, lines[3], "400")
+		assert.Contains(t, lines[3], "invalid number of arguments in request body")
+	}
+
+	code, stdout, _ = tempctl("", "-output", "json", "submit", "foobar")
+	assert.Equal(t, 1, code)
+	var results []submitResult
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &results))
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, 400, results[0].Status)
+		assert.Equal(t, "invalid_argument_count", results[0].Code)
+	}
+
+	code, stdout, _ = tempctl("", "errors", "list", "-contains", "foo")
+	assert.Equal(t, 0, code)
+	lines = strings.Split(strings.TrimSpace(stdout), "\n")
+	if assert.Len(t, lines, 3) {
+		assert.Equal(t, "foobar", strings.Fields(lines[1])[1])
+	}
+
+	code, stdout, _ = tempctl("", "-output", "json", "errors", "list", "-contains", "365951380")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "[]\n", stdout)
+
+	code, stdout, _ = tempctl("", "-output", "json", "device", "-limit", "1", "365951380")
+	assert.Equal(t, 0, code)
+	var readings struct {
+		DeviceId int32 `json:"device_id"`
+		Readings []struct {
+			Temperature float64 `json:"temperature"`
+		} `json:"readings"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &readings))
+	assert.Equal(t, int32(365951380), readings.DeviceId)
+	if assert.Len(t, readings.Readings, 1) {
+		assert.Equal(t, 58.48256793121914, readings.Readings[0].Temperature)
+	}
+
+	code, _, stderr = tempctl("", "device", "42")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "device 42 has not reported since the server started")
+
+	code, stdout, _ = tempctl("", "errors", "clear")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "Cleared the error buffer\n", stdout)
+
+	code, stdout, _ = tempctl("", "-output", "json", "errors", "list")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "[]\n", stdout)
+
+	code, stdout, _ = tempctl("", "health")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, []string{"server", "ok"}, strings.Fields(strings.Split(stdout, "\n")[1]))
+
+	// a device key lacks the read scope
+	code, _, stderr = tempctl("", "-api-key", "device-secret", "errors", "list")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "403")
+
+	code, _, stderr = tempctl("", "reboot")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, `unknown command "reboot"`)
+
+	code, _, stderr = tempctl("", "-output", "yaml", "health")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, `unknown output format "yaml"`)
+}
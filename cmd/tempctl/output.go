@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+)
+
+// printer writes the result of a command as an aligned table for people, or as JSON for scripts
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+func newPrinter(w io.Writer, format string) (*printer, error) {
+	if format != OutputTable && format != OutputJSON {
+		return nil, fmt.Errorf("unknown output format %q, expected %s or %s", format, OutputTable, OutputJSON)
+	}
+	return &printer{w: w, format: format}, nil
+}
+
+// print writes value as JSON, or the rows under the header as a table
+func (p *printer) print(value interface{}, header []string, rows [][]string) error {
+	if p.format == OutputJSON {
+		encoder := json.NewEncoder(p.w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+
+	table := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(table, strings.Join(row, "\t"))
+	}
+	return table.Flush()
+}
+
+// message writes a line for people; scripts reading JSON only get the exit code
+func (p *printer) message(format string, args ...interface{}) {
+	if p.format == OutputTable {
+		fmt.Fprintf(p.w, format+"\n", args...)
+	}
+}
@@ -1,27 +1,669 @@
 package config
 
 import (
-	"path/filepath"
-	"runtime"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/fleet"
+	"github.com/sarabrajsingh/restful-openapi/internal/global_errors"
+	"github.com/sarabrajsingh/restful-openapi/internal/utils"
+	"gopkg.in/yaml.v3"
 )
 
+const (
+	// ConfigFileEnv points at the YAML or JSON configuration file, unless --config is passed
+	ConfigFileEnv = "CONFIG_FILE"
+
+	// OpenAPISpecEnv, OpenAPISpecV2Env and SwaggerUIDirEnv load the contracts of v1 and v2 and the Swagger UI from
+	// disk instead of the copies built into the binary, which is handy while working on them
+	OpenAPISpecEnv   = "OPENAPI_SPEC"
+	OpenAPISpecV2Env = "OPENAPI_SPEC_V2"
+	SwaggerUIDirEnv  = "SWAGGER_UI_DIR"
+
+	// OvertempThresholdEnv is the temperature at and above which POST /temp reports an overtemp
+	OvertempThresholdEnv = "OVERTEMP_THRESHOLD"
+	// ErrorBufferSizeEnv bounds the errors kept by the error store
+	ErrorBufferSizeEnv = "ERROR_BUFFER_SIZE"
+	// FleetOfflineAfterEnv is how long a device can stay silent before it is counted as offline
+	FleetOfflineAfterEnv = "FLEET_OFFLINE_AFTER"
+
+	// WatchIntervalEnv is how often the configuration file, the contract and the files they point at are checked
+	// for changes; 0 only reloads on SIGHUP
+	WatchIntervalEnv     = "WATCH_INTERVAL"
+	DefaultWatchInterval = 5 * time.Second
+
+	// ResponseValidationEnv sets what happens to a response that does not match the contract: off skips the
+	// validation, log logs the mismatch and sends the response anyway, enforce replaces it with a 500
+	ResponseValidationEnv     = "RESPONSE_VALIDATION"
+	ResponseValidationOff     = "off"
+	ResponseValidationLog     = "log"
+	ResponseValidationEnforce = "enforce"
+
+	// APIKeysFileEnv points at a JSON file holding the API keys accepted by the server
+	APIKeysFileEnv = "API_KEYS_FILE"
+	// APIKeysEnv holds the same JSON document inline, which is handy for container secrets
+	APIKeysEnv = "API_KEYS"
+
+	// AuthDisabledEnv runs the server without authentication, which it otherwise refuses when no API keys or JWKS
+	// are configured
+	AuthDisabledEnv = "AUTH_DISABLED"
+
+	JWKSFileEnv      = "JWKS_FILE"
+	JWKSURLEnv       = "JWKS_URL"
+	JWTIssuerEnv     = "JWT_ISSUER"
+	JWTAudienceEnv   = "JWT_AUDIENCE"
+	JWTScopeClaimEnv = "JWT_SCOPE_CLAIM"
+	JWTRolesClaimEnv = "JWT_ROLES_CLAIM"
+
+	// DefaultJWTScopeClaim is the claim holding the space-separated scopes of a bearer token
+	DefaultJWTScopeClaim = "scope"
+	// DefaultJWTRolesClaim is the claim holding the roles of a bearer token
+	DefaultJWTRolesClaim = "roles"
+
+	LogFormatEnv = "LOG_FORMAT"
+	LogLevelEnv  = "LOG_LEVEL"
+
+	AccessLogFormatEnv     = "ACCESS_LOG_FORMAT"
+	AccessLogSampleRateEnv = "ACCESS_LOG_SAMPLE_RATE"
+	// AccessLogSkipRoutesEnv holds a comma-separated list of route names left out of the access log
+	AccessLogSkipRoutesEnv  = "ACCESS_LOG_SKIP_ROUTES"
+	AccessLogFormatCommon   = "common"
+	AccessLogFormatCombined = "combined"
+	AccessLogFormatJSON     = "json"
+	AccessLogFormatOff      = "off"
+	// DefaultAccessLogSkipRoutes keeps the Swagger UI assets, the scrapes and the probes out of the access log
+	DefaultAccessLogSkipRoutes = "SwaggerUI,Metrics,Healthz,Readyz"
+
+	// MetricsEnabledEnv turns the Prometheus /metrics endpoint off when set to false
+	MetricsEnabledEnv = "METRICS_ENABLED"
+
+	TracingExporterEnv     = "TRACING_EXPORTER"
+	TracingOTLPEndpointEnv = "TRACING_OTLP_ENDPOINT"
+	TracingSampleRatioEnv  = "TRACING_SAMPLE_RATIO"
+	TracingServiceNameEnv  = "TRACING_SERVICE_NAME"
+	TracingExporterNone    = "none"
+	TracingExporterStdout  = "stdout"
+	TracingExporterOTLP    = "otlp"
+	// DefaultTracingOTLPEndpoint is the OTLP/HTTP receiver of a collector running next to the server
+	DefaultTracingOTLPEndpoint = "localhost:4318"
+	DefaultTracingServiceName  = "restful-openapi"
+
+	HTTPReadHeaderTimeoutEnv = "HTTP_READ_HEADER_TIMEOUT"
+	HTTPReadTimeoutEnv       = "HTTP_READ_TIMEOUT"
+	HTTPWriteTimeoutEnv      = "HTTP_WRITE_TIMEOUT"
+	HTTPIdleTimeoutEnv       = "HTTP_IDLE_TIMEOUT"
+	// ShutdownDrainPeriodEnv is how long the readiness probe fails before the listener is closed
+	ShutdownDrainPeriodEnv = "SHUTDOWN_DRAIN_PERIOD"
+	// ShutdownTimeoutEnv bounds the time in-flight requests and the flushes are given to finish
+	ShutdownTimeoutEnv = "SHUTDOWN_TIMEOUT"
+
+	// AuditLogFileEnv points at the append-only JSON lines file holding the audit log
+	AuditLogFileEnv = "AUDIT_LOG_FILE"
+
+	// RBACPolicyFileEnv points at the JSON policy mapping roles to the routes they may call
+	RBACPolicyFileEnv = "RBAC_POLICY_FILE"
+
+	PortEnv               = "PORT"
+	TLSModeEnv            = "TLS_MODE"
+	TLSCertFileEnv        = "TLS_CERT_FILE"
+	TLSKeyFileEnv         = "TLS_KEY_FILE"
+	TLSClientCAFileEnv    = "TLS_CLIENT_CA_FILE"
+	TLSBindDeviceIdEnv    = "TLS_BIND_DEVICE_ID"
+	DefaultPort           = "8080"
+	TLSModeOff            = "off"
+	TLSModeTLS            = "tls"
+	TLSModeMutual         = "mtls"
+	TLSModeMutualOptional = "mtls-optional"
+
+	// RateLimitsEnv holds per-route overrides of DefaultRateLimits as a JSON object keyed by route name
+	RateLimitsEnv = "RATE_LIMITS"
+	// RateLimitKeyClient limits each authenticated caller, or each remote address for anonymous callers
+	RateLimitKeyClient = "client"
+	// RateLimitKeyRemote limits each remote address
+	RateLimitKeyRemote = "remote"
+	// RateLimitKeyDevice limits each device id found in a /temp payload, falling back to the client
+	RateLimitKeyDevice = "device"
+
+	// RedactedSecret replaces the API key secrets in the output of --print-config; a configuration holding it is
+	// rejected
+	RedactedSecret = "REDACTED"
+)
+
+// RateLimit configures the token bucket of a route; a zero rate turns the limit off
+type RateLimit struct {
+	RequestsPerSecond float64 `json:"requests_per_second" yaml:"requests_per_second"`
+	Burst             int     `json:"burst" yaml:"burst"`
+	Key               string  `json:"key" yaml:"key"`
+	// ClientRequestsPerSecond and ClientBurst bound the devices of a client together when Key is device, so that a
+	// client rotating device ids doesn't get a new burst for every id; a zero rate leaves the client unbounded
+	ClientRequestsPerSecond float64 `json:"client_requests_per_second,omitempty" yaml:"client_requests_per_second,omitempty"`
+	ClientBurst             int     `json:"client_burst,omitempty" yaml:"client_burst,omitempty"`
+}
+
+// DefaultRateLimits keeps a single misbehaving gateway from flooding ingestion or the error buffer
+func DefaultRateLimits() map[string]RateLimit {
+	return map[string]RateLimit{
+		"TempPost":        {RequestsPerSecond: 10, Burst: 20, Key: RateLimitKeyDevice, ClientRequestsPerSecond: 100, ClientBurst: 200},
+		"ErrorsGet":       {RequestsPerSecond: 5, Burst: 10, Key: RateLimitKeyClient},
+		"ErrorsDelete":    {RequestsPerSecond: 1, Burst: 2, Key: RateLimitKeyClient},
+		"FleetSummaryGet": {RequestsPerSecond: 5, Burst: 10, Key: RateLimitKeyClient},
+		"AuditGet":        {RequestsPerSecond: 5, Burst: 10, Key: RateLimitKeyClient},
+	}
+}
+
+// APIKey is a shared secret handed out to a device or an operator, along with the scopes it grants
+type APIKey struct {
+	Name   string   `json:"name" yaml:"name"`
+	Key    string   `json:"key" yaml:"key"`
+	Scopes []string `json:"scopes" yaml:"scopes"`
+	Roles  []string `json:"roles" yaml:"roles"`
+	// Rotation is bumped along with the secret, so that the version of the configuration shows the rotation
+	// without depending on the secret
+	Rotation int `json:"rotation,omitempty" yaml:"rotation,omitempty"`
+}
+
+type apiKeysDocument struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// JWTConfig describes how bearer tokens issued by our other services are verified
+type JWTConfig struct {
+	// JWKSFile and JWKSURL locate the JSON Web Key Set holding the issuer's public keys
+	JWKSFile   string `yaml:"jwks_file"`
+	JWKSURL    string `yaml:"jwks_url"`
+	Issuer     string `yaml:"issuer"`
+	Audience   string `yaml:"audience"`
+	ScopeClaim string `yaml:"scope_claim"`
+	RolesClaim string `yaml:"roles_claim"`
+}
+
+// Enabled reports whether a key set has been configured
+func (j JWTConfig) Enabled() bool {
+	return j.JWKSFile != "" || j.JWKSURL != ""
+}
+
+// AuthConfig holds the opt-out of authentication, for local development
+type AuthConfig struct {
+	// Disabled opens every operation to anyone; it can't be set along with API keys or a JWKS
+	Disabled bool `yaml:"disabled"`
+}
+
+// TLSConfig describes how the listener terminates TLS and whether client certificates are required
+type TLSConfig struct {
+	// Mode is one of off, tls, mtls or mtls-optional
+	Mode         string `yaml:"mode"`
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"`
+	// BindDeviceId only lets a device submit readings for the device id in its client certificate
+	BindDeviceId bool `yaml:"bind_device_id"`
+}
+
+// Enabled reports whether the listener should serve HTTPS
+func (t TLSConfig) Enabled() bool {
+	return t.Mode != TLSModeOff
+}
+
+// Mutual reports whether client certificates are requested from callers
+func (t TLSConfig) Mutual() bool {
+	return t.Mode == TLSModeMutual || t.Mode == TLSModeMutualOptional
+}
+
+// AccessLogConfig describes the access log written once every response has been sent
+type AccessLogConfig struct {
+	// Format is one of common, combined, json or off
+	Format string `yaml:"format"`
+	// SampleRate is the fraction of requests logged; server errors are always logged
+	SampleRate float64 `yaml:"sample_rate"`
+	// SkipRoutes lists the route names that are never logged
+	SkipRoutes []string `yaml:"skip_routes"`
+}
+
+// HTTPServerConfig describes the timeouts of the listener and how it is shut down
+type HTTPServerConfig struct {
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	// DrainPeriod gives the load balancer time to notice the failing readiness probe
+	DrainPeriod     time.Duration `yaml:"drain_period"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// DefaultHTTPServerConfig keeps slow clients from holding connections open, and fits the shutdown within
+// the 30 seconds most orchestrators wait before killing the process
+func DefaultHTTPServerConfig() HTTPServerConfig {
+	return HTTPServerConfig{
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		DrainPeriod:       5 * time.Second,
+		ShutdownTimeout:   20 * time.Second,
+	}
+}
+
+// TracingConfig describes where the OpenTelemetry spans are exported to
+type TracingConfig struct {
+	// Exporter is one of none, stdout or otlp
+	Exporter string `yaml:"exporter"`
+	// OTLPEndpoint is the host:port of the collector's OTLP/HTTP receiver
+	OTLPEndpoint string `yaml:"otlp_endpoint"`
+	// SampleRatio is the fraction of new traces sampled; a sampled parent is always followed
+	SampleRatio float64 `yaml:"sample_ratio"`
+	ServiceName string  `yaml:"service_name"`
+}
+
+// Enabled reports whether spans are exported
+func (t TracingConfig) Enabled() bool {
+	return t.Exporter != TracingExporterNone
+}
+
+// Config is built in layers: the defaults, then the configuration file, the environment and the command line
+// flags, each one overriding the previous one. The yaml tags are the keys of the configuration file.
 type Config struct {
-	OpenAPI3YamlFileLocation string
-	SwaggerUIFolder          string
+	// OpenAPI3YamlFileLocation, OpenAPISpecV2 and SwaggerUIFolder are empty to use the copies built into the binary;
+	// paths are relative to the working directory, or to the configuration file when they are set there
+	OpenAPI3YamlFileLocation string `yaml:"openapi_spec"`
+	OpenAPISpecV2            string `yaml:"openapi_spec_v2"`
+	SwaggerUIFolder          string `yaml:"swagger_ui_dir"`
+	Port                     string `yaml:"port"`
+	// LogFormat is text or json, LogLevel one of debug, info, warn or error
+	LogFormat string          `yaml:"log_format"`
+	LogLevel  string          `yaml:"log_level"`
+	AccessLog AccessLogConfig `yaml:"access_log"`
+	// MetricsEnabled serves the Prometheus metrics on /metrics
+	MetricsEnabled bool             `yaml:"metrics_enabled"`
+	Tracing        TracingConfig    `yaml:"tracing"`
+	HTTPServer     HTTPServerConfig `yaml:"http_server"`
+	// ResponseValidation is one of off, log or enforce
+	ResponseValidation string `yaml:"response_validation"`
+	// APIKeysFile is read once every layer has been applied, and its keys are added to APIKeys
+	APIKeysFile string     `yaml:"api_keys_file"`
+	APIKeys     []APIKey   `yaml:"api_keys"`
+	JWT         JWTConfig  `yaml:"jwt"`
+	Auth        AuthConfig `yaml:"auth"`
+	TLS         TLSConfig  `yaml:"tls"`
+	// RBACPolicyFile turns on role-based access control when set
+	RBACPolicyFile string `yaml:"rbac_policy_file"`
+	// AuditLogFile keeps the audit log across restarts when set
+	AuditLogFile      string        `yaml:"audit_log_file"`
+	ErrorBufferSize   int           `yaml:"error_buffer_size"`
+	FleetOfflineAfter time.Duration `yaml:"fleet_offline_after"`
+	OvertempThreshold float64       `yaml:"overtemp_threshold"`
+	// RateLimits is keyed by Route.Name
+	RateLimits    map[string]RateLimit `yaml:"rate_limits"`
+	WatchInterval time.Duration        `yaml:"watch_interval"`
+
+	// File is the configuration file that was loaded, if any
+	File string `yaml:"-"`
+	// PrintConfig asks for the configuration to be printed instead of starting the server
+	PrintConfig bool `yaml:"-"`
 }
 
-// NewConfig creates a new Config instance with fully qualified paths
+// Defaults returns the configuration used when nothing else is set
+func Defaults() *Config {
+	return &Config{
+		Port:      DefaultPort,
+		LogFormat: "text",
+		LogLevel:  "info",
+		AccessLog: AccessLogConfig{
+			Format:     AccessLogFormatCombined,
+			SampleRate: 1,
+			SkipRoutes: splitList(DefaultAccessLogSkipRoutes),
+		},
+		MetricsEnabled: true,
+		Tracing: TracingConfig{
+			Exporter:     TracingExporterNone,
+			OTLPEndpoint: DefaultTracingOTLPEndpoint,
+			SampleRatio:  1,
+			ServiceName:  DefaultTracingServiceName,
+		},
+		HTTPServer:         DefaultHTTPServerConfig(),
+		ResponseValidation: ResponseValidationLog,
+		JWT: JWTConfig{
+			ScopeClaim: DefaultJWTScopeClaim,
+			RolesClaim: DefaultJWTRolesClaim,
+		},
+		TLS: TLSConfig{
+			Mode: TLSModeOff,
+		},
+		ErrorBufferSize:   global_errors.DefaultErrorBufferSize,
+		FleetOfflineAfter: fleet.DefaultOfflineAfter,
+		OvertempThreshold: utils.DefaultOvertempThreshold,
+		RateLimits:        DefaultRateLimits(),
+		WatchInterval:     DefaultWatchInterval,
+	}
+}
+
+// NewConfig loads the configuration from the defaults, the file named by CONFIG_FILE and the environment
 func NewConfig() (*Config, error) {
-	// Get the path of the directory where the current source file is located
-	_, currentFilePath, _, _ := runtime.Caller(0)
-	baseDir := filepath.Dir(filepath.Dir(currentFilePath))
+	return Load(nil)
+}
 
-	// Build the absolute paths
-	openAPI3YamlFileLocation := filepath.Join(baseDir, "api", "openapi.yaml")
-	swaggerUIFolder := filepath.Join(baseDir, "swaggerui", "dist")
+// Load applies the defaults, the configuration file, the environment and the command line flags in args,
+// then validates the result
+func Load(args []string) (*Config, error) {
+	cfg := Defaults()
 
-	return &Config{
-		OpenAPI3YamlFileLocation: openAPI3YamlFileLocation,
-		SwaggerUIFolder:          swaggerUIFolder,
-	}, nil
+	flags, err := parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.File = flags.file
+	if cfg.File == "" {
+		cfg.File = os.Getenv(ConfigFileEnv)
+	}
+	if cfg.File != "" {
+		if err := cfg.loadFile(cfg.File); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	for _, value := range flags.values {
+		if err := value.setting.set(cfg, value.value); err != nil {
+			return nil, fmt.Errorf("%s (--%s=%s): %w", value.setting.key, value.setting.flagName(), value.value, err)
+		}
+	}
+	cfg.PrintConfig = flags.printConfig
+
+	if err := cfg.loadAPIKeysFile(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// validate checks every setting once all the layers have been applied, and fills in the defaults that
+// depend on other settings
+func (c *Config) validate() error {
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 0 || port > math.MaxUint16 {
+		return fmt.Errorf("port: %q is not a port number", c.Port)
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		return fmt.Errorf("log_format: unknown format %q; expected text or json", c.LogFormat)
+	}
+	c.LogLevel = strings.ToLower(c.LogLevel)
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("log_level: unknown level %q; expected debug, info, warn or error", c.LogLevel)
+	}
+
+	switch c.AccessLog.Format {
+	case AccessLogFormatCommon, AccessLogFormatCombined, AccessLogFormatJSON, AccessLogFormatOff:
+	default:
+		return fmt.Errorf("access_log.format: unknown format %q; expected common, combined, json or off", c.AccessLog.Format)
+	}
+	if c.AccessLog.SampleRate < 0 || c.AccessLog.SampleRate > 1 {
+		return fmt.Errorf("access_log.sample_rate: %v must be between 0 and 1", c.AccessLog.SampleRate)
+	}
+
+	switch c.ResponseValidation {
+	case ResponseValidationOff, ResponseValidationLog, ResponseValidationEnforce:
+	default:
+		return fmt.Errorf("response_validation: unknown mode %q; expected off, log or enforce", c.ResponseValidation)
+	}
+
+	switch c.Tracing.Exporter {
+	case TracingExporterNone, TracingExporterStdout, TracingExporterOTLP:
+	default:
+		return fmt.Errorf("tracing.exporter: unknown exporter %q; expected none, stdout or otlp", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("tracing.sample_ratio: %v must be between 0 and 1", c.Tracing.SampleRatio)
+	}
+
+	durations := []struct {
+		key   string
+		value time.Duration
+	}{
+		{"http_server.read_header_timeout", c.HTTPServer.ReadHeaderTimeout},
+		{"http_server.read_timeout", c.HTTPServer.ReadTimeout},
+		{"http_server.write_timeout", c.HTTPServer.WriteTimeout},
+		{"http_server.idle_timeout", c.HTTPServer.IdleTimeout},
+		{"http_server.drain_period", c.HTTPServer.DrainPeriod},
+		{"http_server.shutdown_timeout", c.HTTPServer.ShutdownTimeout},
+		{"watch_interval", c.WatchInterval},
+	}
+	for _, duration := range durations {
+		if duration.value < 0 {
+			return fmt.Errorf("%s: %v must not be negative", duration.key, duration.value)
+		}
+	}
+
+	for i, key := range c.APIKeys {
+		if key.Name == "" {
+			return fmt.Errorf("api_keys[%d]: is missing a name", i)
+		}
+		if key.Key == "" {
+			return fmt.Errorf("api_keys[%d] (%s): is missing a key", i, key.Name)
+		}
+		if key.Rotation < 0 {
+			return fmt.Errorf("api_keys[%d] (%s): rotation %d must not be negative", i, key.Name, key.Rotation)
+		}
+		// the output of --print-config, fed back as is, would otherwise turn the placeholder into a working key
+		if key.Key == RedactedSecret {
+			return fmt.Errorf("api_keys[%d] (%s): holds the redacted secret printed by --print-config", i, key.Name)
+		}
+	}
+
+	if c.Auth.Disabled && (len(c.APIKeys) > 0 || c.JWT.Enabled()) {
+		return fmt.Errorf("auth.disabled: can't be set along with API keys or a JWKS")
+	}
+
+	if err := c.TLS.validate(); err != nil {
+		return err
+	}
+
+	if c.ErrorBufferSize <= 0 {
+		return fmt.Errorf("error_buffer_size: %d must be positive", c.ErrorBufferSize)
+	}
+	if c.FleetOfflineAfter <= 0 {
+		return fmt.Errorf("fleet_offline_after: %v must be positive", c.FleetOfflineAfter)
+	}
+	if math.IsNaN(c.OvertempThreshold) || math.IsInf(c.OvertempThreshold, 0) {
+		return fmt.Errorf("overtemp_threshold: %v is not a temperature", c.OvertempThreshold)
+	}
+
+	for route, rateLimit := range c.RateLimits {
+		if rateLimit.RequestsPerSecond < 0 || rateLimit.Burst < 0 || rateLimit.ClientRequestsPerSecond < 0 || rateLimit.ClientBurst < 0 {
+			return fmt.Errorf("rate_limits.%s: requests_per_second, burst, client_requests_per_second and client_burst must not be negative", route)
+		}
+		switch rateLimit.Key {
+		case RateLimitKeyClient, RateLimitKeyRemote, RateLimitKeyDevice:
+		case "":
+			rateLimit.Key = RateLimitKeyClient
+			c.RateLimits[route] = rateLimit
+		default:
+			return fmt.Errorf("rate_limits.%s.key: unknown key %q; expected client, remote or device", route, rateLimit.Key)
+		}
+	}
+
+	return nil
+}
+
+func (t TLSConfig) validate() error {
+	switch t.Mode {
+	case TLSModeOff:
+	case TLSModeTLS, TLSModeMutual, TLSModeMutualOptional:
+		if t.CertFile == "" || t.KeyFile == "" {
+			return fmt.Errorf("tls.mode: %s requires tls.cert_file and tls.key_file", t.Mode)
+		}
+		if t.Mutual() && t.ClientCAFile == "" {
+			return fmt.Errorf("tls.mode: %s requires tls.client_ca_file", t.Mode)
+		}
+	default:
+		return fmt.Errorf("tls.mode: unknown mode %q; expected one of off, tls, mtls or mtls-optional", t.Mode)
+	}
+
+	if t.BindDeviceId && !t.Mutual() {
+		return fmt.Errorf("tls.bind_device_id: requires tls.mode mtls or mtls-optional")
+	}
+
+	return nil
+}
+
+// Print writes the configuration in the format of the configuration file, with the API key secrets redacted
+func (c *Config) Print(w io.Writer) error {
+	redacted := *c
+	redacted.APIKeys = make([]APIKey, len(c.APIKeys))
+	for i, key := range c.APIKeys {
+		key.Key = RedactedSecret
+		redacted.APIKeys[i] = key
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&redacted); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// Version identifies the configuration by a hash of every setting; the API key secrets are left out, since the
+// version is published, and a rotated key shows up through its rotation counter instead. The content of the other
+// files the settings point at is not part of it either.
+func (c *Config) Version() string {
+	published := c.published()
+	data, err := yaml.Marshal(&published)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// published is a copy of the configuration without the API key secrets
+func (c *Config) published() Config {
+	published := *c
+	published.APIKeys = make([]APIKey, len(c.APIKeys))
+	for i, key := range c.APIKeys {
+		key.Key = ""
+		published.APIKeys[i] = key
+	}
+	return published
+}
+
+// Changes lists the settings that differ from previous by their dotted key, e.g. rate_limits.TempPost.burst, as
+// "before -> after" with the values in JSON; a setting that one of them lacks is null. The API key secrets are left
+// out, like in Version, and api_keys is compared as a whole.
+func (c *Config) Changes(previous *Config) map[string]string {
+	before, after := map[string]string{}, map[string]string{}
+	flatten(before, previous.published())
+	flatten(after, c.published())
+
+	changes := map[string]string{}
+	for key, value := range after {
+		if before[key] != value {
+			changes[key] = orNull(before[key]) + " -> " + value
+		}
+	}
+	for key, value := range before {
+		if _, ok := after[key]; !ok {
+			changes[key] = value + " -> null"
+		}
+	}
+	return changes
+}
+
+// flatten adds the settings of cfg to values by their dotted key, down to the values that are not mappings
+func flatten(values map[string]string, cfg Config) {
+	var settings map[string]interface{}
+	data, err := yaml.Marshal(&cfg)
+	if err == nil {
+		err = yaml.Unmarshal(data, &settings)
+	}
+	if err != nil {
+		return
+	}
+	flattenSettings(values, "", settings)
+}
+
+func flattenSettings(values map[string]string, prefix string, settings map[string]interface{}) {
+	for key, value := range settings {
+		if nested, ok := value.(map[string]interface{}); ok {
+			flattenSettings(values, prefix+key+".", nested)
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			encoded = []byte(strconv.Quote(fmt.Sprint(value)))
+		}
+		values[prefix+key] = string(encoded)
+	}
+}
+
+func orNull(value string) string {
+	if value == "" {
+		return "null"
+	}
+	return value
+}
+
+// RestartRequired lists the keys that differ from previous and only take effect once the server restarts,
+// since they configure the listener, the logs, the exporters or the stores
+func (c *Config) RestartRequired(previous *Config) []string {
+	var keys []string
+	if c.Port != previous.Port {
+		keys = append(keys, "port")
+	}
+	if c.LogFormat != previous.LogFormat {
+		keys = append(keys, "log_format")
+	}
+	if c.LogLevel != previous.LogLevel {
+		keys = append(keys, "log_level")
+	}
+	if c.Tracing != previous.Tracing {
+		keys = append(keys, "tracing")
+	}
+	if c.HTTPServer != previous.HTTPServer {
+		keys = append(keys, "http_server")
+	}
+	// the device binding is applied with the routes, the rest of tls configures the listener
+	if c.TLS.Mode != previous.TLS.Mode || c.TLS.CertFile != previous.TLS.CertFile || c.TLS.KeyFile != previous.TLS.KeyFile ||
+		c.TLS.ClientCAFile != previous.TLS.ClientCAFile {
+		keys = append(keys, "tls")
+	}
+	if c.AuditLogFile != previous.AuditLogFile {
+		keys = append(keys, "audit_log_file")
+	}
+	if c.ErrorBufferSize != previous.ErrorBufferSize {
+		keys = append(keys, "error_buffer_size")
+	}
+	if c.FleetOfflineAfter != previous.FleetOfflineAfter {
+		keys = append(keys, "fleet_offline_after")
+	}
+	if c.WatchInterval != previous.WatchInterval {
+		keys = append(keys, "watch_interval")
+	}
+	return keys
+}
+
+// WatchedFiles lists the files a reload would read again
+func (c *Config) WatchedFiles() []string {
+	var files []string
+	for _, file := range []string{c.File, c.OpenAPI3YamlFileLocation, c.OpenAPISpecV2, c.APIKeysFile, c.JWT.JWKSFile, c.RBACPolicyFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
 }
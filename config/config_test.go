@@ -1,32 +1,515 @@
 package config_test
 
 import (
+	"bytes"
+	"fmt"
+	"os"
 	"path/filepath"
-	"runtime"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/sarabrajsingh/restful-openapi/config"
 )
 
-// TestNewConfig tests the NewConfig function
+// TestNewConfig tests that the contract and the Swagger UI built into the binary are used by default
 func TestNewConfig(t *testing.T) {
 	config, err := config.NewConfig()
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
-	// Get the path of the directory where the current source file is located
-	_, currentFilePath, _, _ := runtime.Caller(0)
-	baseDir := filepath.Dir(filepath.Dir(currentFilePath))
+	if config.OpenAPI3YamlFileLocation != "" {
+		t.Errorf("expected OpenAPI3YamlFileLocation to be empty, got %v", config.OpenAPI3YamlFileLocation)
+	}
+
+	if config.SwaggerUIFolder != "" {
+		t.Errorf("expected SwaggerUIFolder to be empty, got %v", config.SwaggerUIFolder)
+	}
+}
+
+// TestNewConfigAPIKeys tests loading API keys from a file and from the environment
+func TestNewConfigAPIKeys(t *testing.T) {
+	keysFile := filepath.Join(t.TempDir(), "keys.json")
+	err := os.WriteFile(keysFile, []byte(`{"keys":[{"name":"gateway-01","key":"device-secret","scopes":["ingest"]}]}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(config.APIKeysFileEnv, keysFile)
+	t.Setenv(config.APIKeysEnv, `{"keys":[{"name":"ops","key":"admin-secret","scopes":["ingest","read","admin"]}]}`)
+
+	cfg, err := config.NewConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(cfg.APIKeys) != 2 {
+		t.Fatalf("expected 2 API keys, got %d", len(cfg.APIKeys))
+	}
+
+	if cfg.APIKeys[0].Name != "gateway-01" || cfg.APIKeys[1].Name != "ops" {
+		t.Errorf("unexpected API keys %+v", cfg.APIKeys)
+	}
+}
+
+// TestNewConfigInvalidAPIKeys tests that a key without a secret is rejected
+func TestNewConfigInvalidAPIKeys(t *testing.T) {
+	t.Setenv(config.APIKeysEnv, `{"keys":[{"name":"ops","scopes":["admin"]}]}`)
+
+	if _, err := config.NewConfig(); err == nil {
+		t.Fatal("expected an error for a key without a secret")
+	}
+}
+
+// TestNewConfigTLS tests the validation of the TLS settings
+func TestNewConfigTLS(t *testing.T) {
+	testCases := []struct {
+		description string
+		env         map[string]string
+		expectErr   bool
+	}{
+		{"TLS off by default", map[string]string{}, false},
+		{"TLS without a certificate", map[string]string{config.TLSModeEnv: "tls"}, true},
+		{"mTLS without a client CA", map[string]string{config.TLSModeEnv: "mtls", config.TLSCertFileEnv: "cert.pem", config.TLSKeyFileEnv: "key.pem"}, true},
+		{"Device binding without mTLS", map[string]string{config.TLSBindDeviceIdEnv: "true"}, true},
+		{"Unknown mode", map[string]string{config.TLSModeEnv: "ssl"}, true},
+		{"mTLS with device binding", map[string]string{
+			config.TLSModeEnv:         "mtls",
+			config.TLSCertFileEnv:     "cert.pem",
+			config.TLSKeyFileEnv:      "key.pem",
+			config.TLSClientCAFileEnv: "ca.pem",
+			config.TLSBindDeviceIdEnv: "true",
+		}, false},
+	}
 
-	expectedOpenAPI3YamlFileLocation := filepath.Join(baseDir, "api", "openapi.yaml")
-	expectedSwaggerUIFolder := filepath.Join(baseDir, "swaggerui", "dist")
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
 
-	if config.OpenAPI3YamlFileLocation != expectedOpenAPI3YamlFileLocation {
-		t.Errorf("expected OpenAPI3YamlFileLocation to be %v, got %v", expectedOpenAPI3YamlFileLocation, config.OpenAPI3YamlFileLocation)
+			_, err := config.NewConfig()
+			if tc.expectErr != (err != nil) {
+				t.Errorf("expected error=%v, got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+// TestNewConfigRateLimits tests that RATE_LIMITS overrides the default limits
+func TestNewConfigRateLimits(t *testing.T) {
+	t.Setenv(config.RateLimitsEnv, `{"TempPost":{"requests_per_second":0},"ErrorsGet":{"requests_per_second":1,"burst":1}}`)
+
+	cfg, err := config.NewConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if cfg.RateLimits["TempPost"].RequestsPerSecond != 0 {
+		t.Errorf("expected the TempPost limit to be turned off, got %+v", cfg.RateLimits["TempPost"])
+	}
+	// the settings left out keep their defaults
+	expected := config.DefaultRateLimits()["TempPost"]
+	expected.RequestsPerSecond = 0
+	if cfg.RateLimits["TempPost"] != expected {
+		t.Errorf("expected the burst and the key of TempPost to be kept, got %+v", cfg.RateLimits["TempPost"])
+	}
+
+	if cfg.RateLimits["ErrorsGet"].Key != config.RateLimitKeyClient {
+		t.Errorf("expected the ErrorsGet limit to default to the client key, got %+v", cfg.RateLimits["ErrorsGet"])
+	}
+
+	if cfg.RateLimits["ErrorsDelete"] != config.DefaultRateLimits()["ErrorsDelete"] {
+		t.Errorf("expected the ErrorsDelete limit to keep its default, got %+v", cfg.RateLimits["ErrorsDelete"])
+	}
+
+	t.Setenv(config.RateLimitsEnv, `{"TempPost":{"requests_per_second":1,"key":"foobar"}}`)
+	if _, err := config.NewConfig(); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+
+	t.Setenv(config.RateLimitsEnv, `{"TempPost":{"requests_per_secnd":1}}`)
+	if _, err := config.NewConfig(); err == nil || !strings.Contains(err.Error(), "requests_per_secnd") {
+		t.Errorf("expected an error for an unknown setting, got %v", err)
+	}
+}
+
+// TestNewConfigLogging tests the LOG_FORMAT and LOG_LEVEL settings
+func TestNewConfigLogging(t *testing.T) {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.LogFormat != "text" || cfg.LogLevel != "info" {
+		t.Errorf("expected text logs at info, got %s at %s", cfg.LogFormat, cfg.LogLevel)
+	}
+
+	t.Setenv(config.LogFormatEnv, "json")
+	t.Setenv(config.LogLevelEnv, "DEBUG")
+	cfg, err = config.NewConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.LogFormat != "json" || cfg.LogLevel != "debug" {
+		t.Errorf("expected json logs at debug, got %s at %s", cfg.LogFormat, cfg.LogLevel)
+	}
+
+	t.Setenv(config.LogLevelEnv, "verbose")
+	if _, err := config.NewConfig(); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+// TestNewConfigAccessLog tests the access log settings
+func TestNewConfigAccessLog(t *testing.T) {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.AccessLog.Format != config.AccessLogFormatCombined || cfg.AccessLog.SampleRate != 1 {
+		t.Errorf("expected the combined format with every request logged, got %+v", cfg.AccessLog)
+	}
+	if len(cfg.AccessLog.SkipRoutes) != 4 || cfg.AccessLog.SkipRoutes[0] != "SwaggerUI" || cfg.AccessLog.SkipRoutes[1] != "Metrics" ||
+		cfg.AccessLog.SkipRoutes[2] != "Healthz" || cfg.AccessLog.SkipRoutes[3] != "Readyz" {
+		t.Errorf("expected the Swagger UI, the metrics and the probes to be skipped, got %v", cfg.AccessLog.SkipRoutes)
+	}
+
+	t.Setenv(config.AccessLogFormatEnv, "json")
+	t.Setenv(config.AccessLogSampleRateEnv, "0.1")
+	t.Setenv(config.AccessLogSkipRoutesEnv, "")
+	cfg, err = config.NewConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.AccessLog.Format != "json" || cfg.AccessLog.SampleRate != 0.1 || len(cfg.AccessLog.SkipRoutes) != 0 {
+		t.Errorf("unexpected access log settings %+v", cfg.AccessLog)
+	}
+
+	t.Setenv(config.AccessLogSampleRateEnv, "2")
+	if _, err := config.NewConfig(); err == nil {
+		t.Error("expected an error for a sample rate above 1")
+	}
+}
+
+// TestNewConfigMetrics tests that METRICS_ENABLED turns the metrics endpoint off
+func TestNewConfigMetrics(t *testing.T) {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !cfg.MetricsEnabled {
+		t.Error("expected the metrics to be enabled by default")
+	}
+
+	t.Setenv(config.MetricsEnabledEnv, "false")
+	cfg, err = config.NewConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.MetricsEnabled {
+		t.Error("expected the metrics to be disabled")
+	}
+
+	t.Setenv(config.MetricsEnabledEnv, "maybe")
+	if _, err := config.NewConfig(); err == nil {
+		t.Error("expected an error for a value that isn't a boolean")
+	}
+}
+
+// TestNewConfigTracing tests the tracing exporter settings
+func TestNewConfigTracing(t *testing.T) {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.Tracing.Enabled() || cfg.Tracing.OTLPEndpoint != config.DefaultTracingOTLPEndpoint {
+		t.Errorf("expected tracing to be off with the default endpoint, got %+v", cfg.Tracing)
+	}
+
+	t.Setenv(config.TracingExporterEnv, "otlp")
+	t.Setenv(config.TracingOTLPEndpointEnv, "otel-collector:4318")
+	t.Setenv(config.TracingSampleRatioEnv, "0.25")
+	cfg, err = config.NewConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !cfg.Tracing.Enabled() || cfg.Tracing.OTLPEndpoint != "otel-collector:4318" || cfg.Tracing.SampleRatio != 0.25 {
+		t.Errorf("unexpected tracing settings %+v", cfg.Tracing)
 	}
 
-	if config.SwaggerUIFolder != expectedSwaggerUIFolder {
-		t.Errorf("expected SwaggerUIFolder to be %v, got %v", expectedSwaggerUIFolder, config.SwaggerUIFolder)
+	t.Setenv(config.TracingExporterEnv, "zipkin")
+	if _, err := config.NewConfig(); err == nil {
+		t.Error("expected an error for an unknown exporter")
+	}
+}
+
+func TestNewConfigHTTPServer(t *testing.T) {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.HTTPServer != config.DefaultHTTPServerConfig() {
+		t.Errorf("expected the default timeouts, got %+v", cfg.HTTPServer)
+	}
+
+	t.Setenv(config.HTTPWriteTimeoutEnv, "1m")
+	t.Setenv(config.ShutdownDrainPeriodEnv, "0s")
+	cfg, err = config.NewConfig()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.HTTPServer.WriteTimeout != time.Minute || cfg.HTTPServer.DrainPeriod != 0 {
+		t.Errorf("unexpected timeouts %+v", cfg.HTTPServer)
+	}
+
+	t.Setenv(config.HTTPIdleTimeoutEnv, "forever")
+	if _, err := config.NewConfig(); err == nil {
+		t.Error("expected an error for a malformed duration")
+	}
+}
+
+// TestLoadLayers tests that the file overrides the defaults, the environment the file, and the flags the environment
+func TestLoadLayers(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	err := os.WriteFile(file, []byte(`
+port: "9090"
+openapi_spec: contract/openapi.yaml
+openapi_spec_v2: contract/openapi.v2.yaml
+log_level: debug
+overtemp_threshold: 85.5
+fleet_offline_after: 5m
+tracing:
+  exporter: stdout
+rate_limits:
+  TempPost:
+    requests_per_second: 100
+    burst: 200
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(config.ConfigFileEnv, file)
+	t.Setenv(config.LogLevelEnv, "warn")
+	t.Setenv(config.OvertempThresholdEnv, "80")
+
+	cfg, err := config.Load([]string{"--overtemp-threshold", "75", "--tracing-sample-ratio=0.5"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if cfg.File != file || cfg.Port != "9090" || cfg.Tracing.Exporter != config.TracingExporterStdout || cfg.FleetOfflineAfter != 5*time.Minute {
+		t.Errorf("expected the settings of the file, got %+v", cfg)
+	}
+	if cfg.OpenAPI3YamlFileLocation != filepath.Join(dir, "contract", "openapi.yaml") {
+		t.Errorf("expected the spec to be relative to the file, got %s", cfg.OpenAPI3YamlFileLocation)
+	}
+	if cfg.OpenAPISpecV2 != filepath.Join(dir, "contract", "openapi.v2.yaml") {
+		t.Errorf("expected the v2 spec to be relative to the file, got %s", cfg.OpenAPISpecV2)
+	}
+	if cfg.SwaggerUIFolder != "" {
+		t.Errorf("expected the Swagger UI to stay embedded, got %s", cfg.SwaggerUIFolder)
+	}
+	if cfg.LogLevel != "warn" {
+		t.Errorf("expected the environment to override the file, got %s", cfg.LogLevel)
+	}
+	if cfg.OvertempThreshold != 75 || cfg.Tracing.SampleRatio != 0.5 {
+		t.Errorf("expected the flags to override the environment, got %v and %v", cfg.OvertempThreshold, cfg.Tracing.SampleRatio)
+	}
+	// the file overrides the settings it names and keeps the others
+	if cfg.RateLimits["TempPost"].RequestsPerSecond != 100 || cfg.RateLimits["TempPost"].Burst != 200 ||
+		cfg.RateLimits["TempPost"].Key != config.RateLimitKeyDevice || cfg.RateLimits["TempPost"].ClientBurst != config.DefaultRateLimits()["TempPost"].ClientBurst {
+		t.Errorf("expected the TempPost limit of the file over the default one, got %+v", cfg.RateLimits["TempPost"])
+	}
+	if cfg.RateLimits["ErrorsDelete"] != config.DefaultRateLimits()["ErrorsDelete"] {
+		t.Errorf("expected the ErrorsDelete limit to keep its default, got %+v", cfg.RateLimits["ErrorsDelete"])
+	}
+}
+
+// TestLoadJSONFile tests that a JSON file passed with --config is read like a YAML one
+func TestLoadJSONFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(file, []byte(`{"error_buffer_size": 64, "http_server": {"write_timeout": "1m"}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.Load([]string{"--config", file})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.ErrorBufferSize != 64 || cfg.HTTPServer.WriteTimeout != time.Minute {
+		t.Errorf("expected the settings of the file, got %+v", cfg)
+	}
+}
+
+// TestLoadErrors tests that the errors name the offending key
+func TestLoadErrors(t *testing.T) {
+	testCases := []struct {
+		description string
+		file        string
+		env         map[string]string
+		args        []string
+		expectedErr string
+	}{
+		{"Unknown key in the file", "tracing:\n  sampel_ratio: 0.5\n", nil, nil, "field sampel_ratio not found"},
+		{"Invalid value in the file", "error_buffer_size: 0\n", nil, nil, "error_buffer_size: 0 must be positive"},
+		{"Malformed variable", "", map[string]string{config.ErrorBufferSizeEnv: "many"}, nil, "error_buffer_size (ERROR_BUFFER_SIZE=many): must be an integer"},
+		{"Malformed flag", "", nil, []string{"--fleet-offline-after", "soon"}, "fleet_offline_after (--fleet-offline-after=soon): must be a duration"},
+		{"Invalid flag", "", nil, []string{"--port", "http"}, `port: "http" is not a port number`},
+		{"Unknown flag", "", nil, []string{"--colour"}, "flag provided but not defined"},
+		{"Invalid rate limit", "rate_limits:\n  TempPost:\n    key: foobar\n", nil, nil, "rate_limits.TempPost.key"},
+		{"Authentication disabled along with keys", "auth:\n  disabled: true\n", map[string]string{config.APIKeysEnv: `{"keys":[{"name":"ops","key":"admin-secret","scopes":["admin"]}]}`}, nil, "auth.disabled: can't be set along with API keys or a JWKS"},
+		{"Unknown response validation mode", "", map[string]string{config.ResponseValidationEnv: "strict"}, nil, `response_validation: unknown mode "strict"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if tc.file != "" {
+				file := filepath.Join(t.TempDir(), "config.yaml")
+				if err := os.WriteFile(file, []byte(tc.file), 0600); err != nil {
+					t.Fatal(err)
+				}
+				t.Setenv(config.ConfigFileEnv, file)
+			}
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+
+			_, err := config.Load(tc.args)
+			if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Errorf("expected an error containing %q, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+// TestPrint tests that --print-config shows the resulting configuration without the API key secrets
+func TestPrint(t *testing.T) {
+	t.Setenv(config.APIKeysEnv, `{"keys":[{"name":"ops","key":"admin-secret","scopes":["admin"]}]}`)
+
+	cfg, err := config.Load([]string{"--print-config", "--port", "9090"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !cfg.PrintConfig {
+		t.Fatal("expected --print-config to be set")
+	}
+
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if strings.Contains(out.String(), "admin-secret") || !strings.Contains(out.String(), config.RedactedSecret) {
+		t.Errorf("expected the secret to be redacted, got %s", out.String())
+	}
+	if cfg.APIKeys[0].Key != "admin-secret" {
+		t.Error("expected the configuration itself to keep the secret")
+	}
+
+	// the redacted secrets can't be fed back as working keys
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, out.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(config.APIKeysEnv, "")
+	if _, err := config.Load([]string{"--config", file}); err == nil || !strings.Contains(err.Error(), "redacted secret") {
+		t.Fatalf("expected the redacted secret to be rejected, got %v", err)
+	}
+
+	// the output of a configuration without keys can be fed back as a configuration file
+	cfg.APIKeys = nil
+	out.Reset()
+	if err := cfg.Print(&out); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := os.WriteFile(file, out.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := config.Load([]string{"--config", file})
+	if err != nil {
+		t.Fatalf("expected the printed configuration to load, got %v", err)
+	}
+	if reloaded.Port != "9090" || reloaded.HTTPServer != cfg.HTTPServer {
+		t.Errorf("expected the printed settings, got %+v", reloaded)
+	}
+}
+
+// TestVersion tests that the version follows the settings and which changes need a restart
+func TestVersion(t *testing.T) {
+	cfg := config.Defaults()
+	previous := config.Defaults()
+
+	if cfg.Version() != previous.Version() {
+		t.Errorf("expected the same settings to have the same version")
+	}
+	if restart := cfg.RestartRequired(previous); len(restart) != 0 {
+		t.Errorf("expected nothing to need a restart, got %v", restart)
+	}
+
+	// the published version does not depend on the secrets, only on the rotation counter of the keys
+	cfg.APIKeys = []config.APIKey{{Name: "ops", Key: "admin-secret", Scopes: []string{"admin"}}}
+	previous.APIKeys = []config.APIKey{{Name: "ops", Key: "old-secret", Scopes: []string{"admin"}}}
+	if cfg.Version() != previous.Version() {
+		t.Errorf("expected the secret to be left out of the version")
+	}
+	cfg.APIKeys[0].Rotation = 1
+	if cfg.Version() == previous.Version() {
+		t.Errorf("expected a rotated key to change the version")
+	}
+	if cfg.APIKeys[0].Key != "admin-secret" {
+		t.Error("expected the configuration itself to keep the secret")
+	}
+
+	// the routes are rebuilt on a reload, the listener and the stores are not
+	cfg.OvertempThreshold = 80
+	cfg.Port = "9090"
+	cfg.HTTPServer.IdleTimeout = time.Minute
+	cfg.TLS.BindDeviceId = true
+	restart := cfg.RestartRequired(previous)
+	if strings.Join(restart, ",") != "port,http_server" {
+		t.Errorf("expected port and http_server to need a restart, got %v", restart)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	cfg := config.Defaults()
+	previous := config.Defaults()
+
+	if changes := cfg.Changes(previous); len(changes) != 0 {
+		t.Errorf("expected no changes, got %v", changes)
+	}
+
+	cfg.OvertempThreshold = 35
+	cfg.LogLevel = "debug"
+	cfg.RateLimits["TempPost"] = config.RateLimit{RequestsPerSecond: 50, Burst: 20, Key: config.RateLimitKeyDevice, ClientRequestsPerSecond: 100, ClientBurst: 200}
+	cfg.RateLimits["DeviceGet"] = config.RateLimit{RequestsPerSecond: 1, Burst: 1, Key: config.RateLimitKeyClient}
+	// the secrets are never part of the changes
+	cfg.APIKeys = []config.APIKey{{Name: "ops", Key: "admin-secret", Scopes: []string{"admin"}}}
+	previous.APIKeys = []config.APIKey{{Name: "ops", Key: "old-secret", Scopes: []string{"admin"}}}
+
+	expected := map[string]string{
+		"overtemp_threshold": fmt.Sprintf("%v -> 35", previous.OvertempThreshold),
+		"log_level":          `"info" -> "debug"`,
+		"rate_limits.TempPost.requests_per_second":  "10 -> 50",
+		"rate_limits.DeviceGet.requests_per_second": "null -> 1",
+		"rate_limits.DeviceGet.burst":               "null -> 1",
+		"rate_limits.DeviceGet.key":                 `null -> "client"`,
+	}
+	changes := cfg.Changes(previous)
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected changes %v, got %v", expected, changes)
+	}
+
+	cfg.APIKeys[0].Scopes = []string{"read"}
+	changes = cfg.Changes(previous)
+	if changes["api_keys"] != `[{"key":"","name":"ops","roles":[],"scopes":["admin"]}] -> [{"key":"","name":"ops","roles":[],"scopes":["read"]}]` {
+		t.Errorf("expected the scopes of the key to change without its secret, got %q", changes["api_keys"])
+	}
+	if strings.Contains(fmt.Sprint(changes), "secret") {
+		t.Errorf("expected no secret in the changes, got %v", changes)
 	}
 }
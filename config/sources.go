@@ -0,0 +1,338 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// setting is a configuration key that can be overridden by an environment variable and a command line flag
+type setting struct {
+	// key is the dotted path of the setting in the configuration file
+	key string
+	env string
+	// secret settings aren't offered as flags, which would show up in the process list
+	secret bool
+	// list settings can be emptied by setting the variable to an empty string
+	list bool
+	set  func(*Config, string) error
+}
+
+// flagName turns the key into the name of its flag, e.g. tracing.sample_ratio into tracing-sample-ratio
+func (s setting) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(s.key)
+}
+
+func settings() []setting {
+	return []setting{
+		{key: "port", env: PortEnv, set: stringValue(func(c *Config) *string { return &c.Port })},
+		{key: "openapi_spec", env: OpenAPISpecEnv, set: stringValue(func(c *Config) *string { return &c.OpenAPI3YamlFileLocation })},
+		{key: "openapi_spec_v2", env: OpenAPISpecV2Env, set: stringValue(func(c *Config) *string { return &c.OpenAPISpecV2 })},
+		{key: "swagger_ui_dir", env: SwaggerUIDirEnv, set: stringValue(func(c *Config) *string { return &c.SwaggerUIFolder })},
+		{key: "log_format", env: LogFormatEnv, set: stringValue(func(c *Config) *string { return &c.LogFormat })},
+		{key: "log_level", env: LogLevelEnv, set: stringValue(func(c *Config) *string { return &c.LogLevel })},
+		{key: "access_log.format", env: AccessLogFormatEnv, set: stringValue(func(c *Config) *string { return &c.AccessLog.Format })},
+		{key: "access_log.sample_rate", env: AccessLogSampleRateEnv, set: floatValue(func(c *Config) *float64 { return &c.AccessLog.SampleRate })},
+		{key: "access_log.skip_routes", env: AccessLogSkipRoutesEnv, list: true, set: listValue(func(c *Config) *[]string { return &c.AccessLog.SkipRoutes })},
+		{key: "metrics_enabled", env: MetricsEnabledEnv, set: boolValue(func(c *Config) *bool { return &c.MetricsEnabled })},
+		{key: "response_validation", env: ResponseValidationEnv, set: stringValue(func(c *Config) *string { return &c.ResponseValidation })},
+		{key: "tracing.exporter", env: TracingExporterEnv, set: stringValue(func(c *Config) *string { return &c.Tracing.Exporter })},
+		{key: "tracing.otlp_endpoint", env: TracingOTLPEndpointEnv, set: stringValue(func(c *Config) *string { return &c.Tracing.OTLPEndpoint })},
+		{key: "tracing.sample_ratio", env: TracingSampleRatioEnv, set: floatValue(func(c *Config) *float64 { return &c.Tracing.SampleRatio })},
+		{key: "tracing.service_name", env: TracingServiceNameEnv, set: stringValue(func(c *Config) *string { return &c.Tracing.ServiceName })},
+		{key: "http_server.read_header_timeout", env: HTTPReadHeaderTimeoutEnv, set: durationValue(func(c *Config) *time.Duration { return &c.HTTPServer.ReadHeaderTimeout })},
+		{key: "http_server.read_timeout", env: HTTPReadTimeoutEnv, set: durationValue(func(c *Config) *time.Duration { return &c.HTTPServer.ReadTimeout })},
+		{key: "http_server.write_timeout", env: HTTPWriteTimeoutEnv, set: durationValue(func(c *Config) *time.Duration { return &c.HTTPServer.WriteTimeout })},
+		{key: "http_server.idle_timeout", env: HTTPIdleTimeoutEnv, set: durationValue(func(c *Config) *time.Duration { return &c.HTTPServer.IdleTimeout })},
+		{key: "http_server.drain_period", env: ShutdownDrainPeriodEnv, set: durationValue(func(c *Config) *time.Duration { return &c.HTTPServer.DrainPeriod })},
+		{key: "http_server.shutdown_timeout", env: ShutdownTimeoutEnv, set: durationValue(func(c *Config) *time.Duration { return &c.HTTPServer.ShutdownTimeout })},
+		{key: "api_keys_file", env: APIKeysFileEnv, set: stringValue(func(c *Config) *string { return &c.APIKeysFile })},
+		{key: "api_keys", env: APIKeysEnv, secret: true, set: appendAPIKeys},
+		{key: "auth.disabled", env: AuthDisabledEnv, set: boolValue(func(c *Config) *bool { return &c.Auth.Disabled })},
+		{key: "jwt.jwks_file", env: JWKSFileEnv, set: stringValue(func(c *Config) *string { return &c.JWT.JWKSFile })},
+		{key: "jwt.jwks_url", env: JWKSURLEnv, set: stringValue(func(c *Config) *string { return &c.JWT.JWKSURL })},
+		{key: "jwt.issuer", env: JWTIssuerEnv, set: stringValue(func(c *Config) *string { return &c.JWT.Issuer })},
+		{key: "jwt.audience", env: JWTAudienceEnv, set: stringValue(func(c *Config) *string { return &c.JWT.Audience })},
+		{key: "jwt.scope_claim", env: JWTScopeClaimEnv, set: stringValue(func(c *Config) *string { return &c.JWT.ScopeClaim })},
+		{key: "jwt.roles_claim", env: JWTRolesClaimEnv, set: stringValue(func(c *Config) *string { return &c.JWT.RolesClaim })},
+		{key: "tls.mode", env: TLSModeEnv, set: stringValue(func(c *Config) *string { return &c.TLS.Mode })},
+		{key: "tls.cert_file", env: TLSCertFileEnv, set: stringValue(func(c *Config) *string { return &c.TLS.CertFile })},
+		{key: "tls.key_file", env: TLSKeyFileEnv, set: stringValue(func(c *Config) *string { return &c.TLS.KeyFile })},
+		{key: "tls.client_ca_file", env: TLSClientCAFileEnv, set: stringValue(func(c *Config) *string { return &c.TLS.ClientCAFile })},
+		{key: "tls.bind_device_id", env: TLSBindDeviceIdEnv, set: boolValue(func(c *Config) *bool { return &c.TLS.BindDeviceId })},
+		{key: "rbac_policy_file", env: RBACPolicyFileEnv, set: stringValue(func(c *Config) *string { return &c.RBACPolicyFile })},
+		{key: "audit_log_file", env: AuditLogFileEnv, set: stringValue(func(c *Config) *string { return &c.AuditLogFile })},
+		{key: "error_buffer_size", env: ErrorBufferSizeEnv, set: intValue(func(c *Config) *int { return &c.ErrorBufferSize })},
+		{key: "fleet_offline_after", env: FleetOfflineAfterEnv, set: durationValue(func(c *Config) *time.Duration { return &c.FleetOfflineAfter })},
+		{key: "overtemp_threshold", env: OvertempThresholdEnv, set: floatValue(func(c *Config) *float64 { return &c.OvertempThreshold })},
+		{key: "rate_limits", env: RateLimitsEnv, set: mergeRateLimits},
+		{key: "watch_interval", env: WatchIntervalEnv, set: durationValue(func(c *Config) *time.Duration { return &c.WatchInterval })},
+	}
+}
+
+// pathFields lists the paths resolved against the directory of the configuration file
+func pathFields(c *Config) []*string {
+	return []*string{
+		&c.OpenAPI3YamlFileLocation,
+		&c.OpenAPISpecV2,
+		&c.SwaggerUIFolder,
+		&c.APIKeysFile,
+		&c.JWT.JWKSFile,
+		&c.TLS.CertFile,
+		&c.TLS.KeyFile,
+		&c.TLS.ClientCAFile,
+		&c.RBACPolicyFile,
+		&c.AuditLogFile,
+	}
+}
+
+func stringValue(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func boolValue(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func intValue(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func floatValue(field func(*Config) *float64) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func durationValue(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.New("must be a duration such as 30s")
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func listValue(field func(*Config) *[]string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*field(c) = splitList(value)
+		return nil
+	}
+}
+
+// splitList splits a comma-separated list, dropping the empty items
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// mergeRateLimits overrides the settings found in a JSON object keyed by route name, field by field, so that
+// {"TempPost":{"requests_per_second":50}} keeps the burst and the key of TempPost
+func mergeRateLimits(c *Config, value string) error {
+	var parsed map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+		return fmt.Errorf("could not parse the limits: %w", err)
+	}
+	if c.RateLimits == nil {
+		c.RateLimits = map[string]RateLimit{}
+	}
+	for route, raw := range parsed {
+		rateLimit := c.RateLimits[route]
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&rateLimit); err != nil {
+			return fmt.Errorf("could not parse the limits of %s: %w", route, err)
+		}
+		c.RateLimits[route] = rateLimit
+	}
+	return nil
+}
+
+// appendAPIKeys adds the keys of an inline {"keys": [...]} document
+func appendAPIKeys(c *Config, value string) error {
+	keys, err := parseAPIKeys([]byte(value))
+	if err != nil {
+		return err
+	}
+	c.APIKeys = append(c.APIKeys, keys...)
+	return nil
+}
+
+func parseAPIKeys(contents []byte) ([]APIKey, error) {
+	var document apiKeysDocument
+	if err := json.Unmarshal(contents, &document); err != nil {
+		return nil, fmt.Errorf("could not parse the keys: %w", err)
+	}
+	return document.Keys, nil
+}
+
+// loadAPIKeysFile adds the keys of api_keys_file to the keys found in the other layers
+func (c *Config) loadAPIKeysFile() error {
+	if c.APIKeysFile == "" {
+		return nil
+	}
+
+	contents, err := os.ReadFile(c.APIKeysFile)
+	if err != nil {
+		return fmt.Errorf("api_keys_file: %w", err)
+	}
+	keys, err := parseAPIKeys(contents)
+	if err != nil {
+		return fmt.Errorf("api_keys_file (%s): %w", c.APIKeysFile, err)
+	}
+
+	// the keys of the file come first, like they did before the configuration file existed
+	c.APIKeys = append(keys, c.APIKeys...)
+	return nil
+}
+
+// loadFile applies a YAML or JSON configuration file; unknown keys are rejected so that typos don't go unnoticed
+func (c *Config) loadFile(path string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read the configuration file: %w", err)
+	}
+
+	rateLimits := make(map[string]RateLimit, len(c.RateLimits))
+	for route, rateLimit := range c.RateLimits {
+		rateLimits[route] = rateLimit
+	}
+	if err := decodeFile(contents, c); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	// the decoder replaces the limits of a route whole, while the file only overrides the settings it names
+	var fileRateLimits struct {
+		RateLimits map[string]yaml.Node `yaml:"rate_limits"`
+	}
+	if err := yaml.Unmarshal(contents, &fileRateLimits); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for route, node := range fileRateLimits.RateLimits {
+		rateLimit := rateLimits[route]
+		if err := node.Decode(&rateLimit); err != nil {
+			return fmt.Errorf("%s: rate_limits.%s: %w", path, route, err)
+		}
+		c.RateLimits[route] = rateLimit
+	}
+
+	// the paths set in the file are relative to the file, so that it can be moved along with what it points to
+	var fromFile Config
+	if err := decodeFile(contents, &fromFile); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	resolved := pathFields(c)
+	for i, value := range pathFields(&fromFile) {
+		if *value != "" && !filepath.IsAbs(*value) {
+			*resolved[i] = filepath.Join(filepath.Dir(path), *value)
+		}
+	}
+
+	return nil
+}
+
+func decodeFile(contents []byte, cfg *Config) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// loadEnv applies the environment variables that are set; an empty variable is ignored, except for lists
+func (c *Config) loadEnv() error {
+	for _, s := range settings() {
+		value, ok := os.LookupEnv(s.env)
+		if !ok || (value == "" && !s.list) {
+			continue
+		}
+		if err := s.set(c, value); err != nil {
+			if s.secret {
+				return fmt.Errorf("%s (%s): %w", s.key, s.env, err)
+			}
+			return fmt.Errorf("%s (%s=%s): %w", s.key, s.env, value, err)
+		}
+	}
+	return nil
+}
+
+type flagValue struct {
+	setting setting
+	value   string
+}
+
+type parsedFlags struct {
+	file        string
+	printConfig bool
+	// values are applied after the environment, in the order they were passed
+	values []flagValue
+}
+
+// parseFlags collects the flags, which are only applied once the file and the environment have been loaded
+func parseFlags(args []string) (*parsedFlags, error) {
+	parsed := &parsedFlags{}
+
+	flags := flag.NewFlagSet("app-api-server", flag.ContinueOnError)
+	flags.StringVar(&parsed.file, "config", "", fmt.Sprintf("YAML or JSON configuration file, overriding %s", ConfigFileEnv))
+	flags.BoolVar(&parsed.printConfig, "print-config", false, "print the configuration with every layer applied, then exit")
+
+	for _, s := range settings() {
+		if s.secret {
+			continue
+		}
+		s := s
+		flags.Func(s.flagName(), fmt.Sprintf("sets %s, overriding %s", s.key, s.env), func(value string) error {
+			parsed.values = append(parsed.values, flagValue{setting: s, value: value})
+			return nil
+		})
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	return parsed, nil
+}
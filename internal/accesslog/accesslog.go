@@ -0,0 +1,163 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/config"
+)
+
+// Entry describes a request once its response has been sent
+type Entry struct {
+	Time       time.Time
+	RemoteAddr string
+	Caller     string
+	Method     string
+	URI        string
+	Proto      string
+	Status     int
+	Bytes      int
+	Referer    string
+	UserAgent  string
+	Route      string
+	RequestId  string
+	Latency    time.Duration
+}
+
+type AccessLogger interface {
+	// Log writes the entry unless its route is skipped or it is sampled out
+	Log(Entry)
+}
+
+type jsonEntry struct {
+	Time       string  `json:"time"`
+	RemoteAddr string  `json:"remote_addr"`
+	Caller     string  `json:"caller"`
+	Method     string  `json:"method"`
+	URI        string  `json:"uri"`
+	Proto      string  `json:"proto"`
+	Status     int     `json:"status"`
+	Bytes      int     `json:"bytes"`
+	Referer    string  `json:"referer,omitempty"`
+	UserAgent  string  `json:"user_agent,omitempty"`
+	Route      string  `json:"route"`
+	RequestId  string  `json:"request_id,omitempty"`
+	LatencyMS  float64 `json:"latency_ms"`
+}
+
+type accessLoggerImpl struct {
+	writer     io.Writer
+	format     string
+	sampleRate float64
+	skipRoutes map[string]bool
+	random     func() float64
+	mutex      *sync.Mutex
+}
+
+// NewAccessLogger creates an AccessLogger writing the configured format to w
+func NewAccessLogger(w io.Writer, cfg config.AccessLogConfig) (AccessLogger, error) {
+	return NewAccessLoggerWithRand(w, cfg, rand.Float64)
+}
+
+// NewAccessLoggerWithRand creates an AccessLogger drawing its sampling decisions from random, for tests
+func NewAccessLoggerWithRand(w io.Writer, cfg config.AccessLogConfig, random func() float64) (AccessLogger, error) {
+	switch cfg.Format {
+	case config.AccessLogFormatCommon, config.AccessLogFormatCombined, config.AccessLogFormatJSON, config.AccessLogFormatOff:
+	default:
+		return nil, fmt.Errorf("unknown access log format %q; expected common, combined, json or off", cfg.Format)
+	}
+
+	skipRoutes := make(map[string]bool)
+	for _, route := range cfg.SkipRoutes {
+		skipRoutes[route] = true
+	}
+
+	return &accessLoggerImpl{
+		writer:     w,
+		format:     cfg.Format,
+		sampleRate: cfg.SampleRate,
+		skipRoutes: skipRoutes,
+		random:     random,
+		mutex:      &sync.Mutex{},
+	}, nil
+}
+
+func (a *accessLoggerImpl) Log(entry Entry) {
+	if a.format == config.AccessLogFormatOff || a.skipRoutes[entry.Route] {
+		return
+	}
+	// server errors are always logged, whatever the sample rate
+	if entry.Status < 500 && a.sampleRate < 1 && a.random() >= a.sampleRate {
+		return
+	}
+
+	var line []byte
+	switch a.format {
+	case config.AccessLogFormatJSON:
+		line, _ = json.Marshal(jsonEntry{
+			Time:       entry.Time.Format(time.RFC3339Nano),
+			RemoteAddr: entry.RemoteAddr,
+			Caller:     entry.Caller,
+			Method:     entry.Method,
+			URI:        entry.URI,
+			Proto:      entry.Proto,
+			Status:     entry.Status,
+			Bytes:      entry.Bytes,
+			Referer:    entry.Referer,
+			UserAgent:  entry.UserAgent,
+			Route:      entry.Route,
+			RequestId:  entry.RequestId,
+			LatencyMS:  float64(entry.Latency.Microseconds()) / 1000,
+		})
+	case config.AccessLogFormatCommon:
+		line = []byte(common(entry) + trailer(entry))
+	default:
+		line = []byte(common(entry) + fmt.Sprintf(" %q %q", dash(entry.Referer), dash(entry.UserAgent)) + trailer(entry))
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.writer.Write(append(line, '\n'))
+}
+
+// common formats the entry in the NCSA Common Log Format, with the caller as the authenticated user
+func common(entry Entry) string {
+	host, _, err := net.SplitHostPort(entry.RemoteAddr)
+	if err != nil {
+		host = entry.RemoteAddr
+	}
+
+	size := "-"
+	if entry.Bytes > 0 {
+		size = fmt.Sprint(entry.Bytes)
+	}
+
+	request := strings.Join([]string{entry.Method, entry.URI, entry.Proto}, " ")
+
+	return fmt.Sprintf("%s - %s [%s] %q %d %s",
+		dash(host),
+		dash(entry.Caller),
+		entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		request,
+		entry.Status,
+		size,
+	)
+}
+
+// trailer appends the route, the request id and the latency in seconds, which the standard formats lack
+func trailer(entry Entry) string {
+	return fmt.Sprintf(" %s %s %.6f", dash(entry.Route), dash(entry.RequestId), entry.Latency.Seconds())
+}
+
+func dash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
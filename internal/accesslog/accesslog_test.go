@@ -0,0 +1,106 @@
+package accesslog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/accesslog"
+	"github.com/stretchr/testify/assert"
+)
+
+var entry = accesslog.Entry{
+	Time:       time.Date(2024, 7, 27, 15, 26, 35, 0, time.UTC),
+	RemoteAddr: "172.17.0.1:53002",
+	Caller:     "apiKey:gateway-01",
+	Method:     "POST",
+	URI:        "/api/v1/temp",
+	Proto:      "HTTP/1.1",
+	Status:     400,
+	Bytes:      60,
+	UserAgent:  "curl/8.4.0",
+	Route:      "TempPost",
+	RequestId:  "gateway-01:7f3a",
+	Latency:    1500 * time.Microsecond,
+}
+
+func TestAccessLogger_Common(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := accesslog.NewAccessLogger(&buf, config.AccessLogConfig{Format: config.AccessLogFormatCommon, SampleRate: 1})
+	assert.NoError(t, err)
+
+	logger.Log(entry)
+
+	assert.Equal(t, `172.17.0.1 - apiKey:gateway-01 [27/Jul/2024:15:26:35 +0000] "POST /api/v1/temp HTTP/1.1" 400 60 TempPost gateway-01:7f3a 0.001500`+"\n", buf.String())
+}
+
+func TestAccessLogger_Combined(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := accesslog.NewAccessLogger(&buf, config.AccessLogConfig{Format: config.AccessLogFormatCombined, SampleRate: 1})
+	assert.NoError(t, err)
+
+	logger.Log(entry)
+
+	assert.Equal(t, `172.17.0.1 - apiKey:gateway-01 [27/Jul/2024:15:26:35 +0000] "POST /api/v1/temp HTTP/1.1" 400 60 "-" "curl/8.4.0" TempPost gateway-01:7f3a 0.001500`+"\n", buf.String())
+}
+
+func TestAccessLogger_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := accesslog.NewAccessLogger(&buf, config.AccessLogConfig{Format: config.AccessLogFormatJSON, SampleRate: 1})
+	assert.NoError(t, err)
+
+	logger.Log(entry)
+
+	var logged map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &logged))
+	assert.Equal(t, "TempPost", logged["route"])
+	assert.Equal(t, float64(400), logged["status"])
+	assert.Equal(t, float64(60), logged["bytes"])
+	assert.Equal(t, 1.5, logged["latency_ms"])
+	assert.Equal(t, "curl/8.4.0", logged["user_agent"])
+	assert.Equal(t, "gateway-01:7f3a", logged["request_id"])
+}
+
+func TestAccessLogger_SkipAndSample(t *testing.T) {
+	var buf bytes.Buffer
+	draw := 0.75
+	logger, err := accesslog.NewAccessLoggerWithRand(&buf, config.AccessLogConfig{
+		Format:     config.AccessLogFormatCommon,
+		SampleRate: 0.5,
+		SkipRoutes: []string{"SwaggerUI"},
+	}, func() float64 { return draw })
+	assert.NoError(t, err)
+
+	swagger := entry
+	swagger.Route = "SwaggerUI"
+	swagger.Status = 500
+	logger.Log(swagger)
+	assert.Empty(t, buf.String(), "skipped routes are never logged")
+
+	logger.Log(entry)
+	assert.Empty(t, buf.String(), "a draw above the sample rate is dropped")
+
+	failed := entry
+	failed.Status = 503
+	logger.Log(failed)
+	assert.Contains(t, buf.String(), `" 503 `, "server errors are always logged")
+
+	buf.Reset()
+	draw = 0.25
+	logger.Log(entry)
+	assert.Contains(t, buf.String(), `" 400 `)
+}
+
+func TestAccessLogger_Off(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := accesslog.NewAccessLogger(&buf, config.AccessLogConfig{Format: config.AccessLogFormatOff})
+	assert.NoError(t, err)
+
+	logger.Log(entry)
+	assert.Empty(t, buf.String())
+
+	_, err = accesslog.NewAccessLogger(&buf, config.AccessLogConfig{Format: "apache"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,179 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+	"github.com/sarabrajsingh/restful-openapi/internal/models"
+)
+
+// MaxAuditEntriesInMemory bounds the entries that can be queried; the audit file keeps every entry
+const MaxAuditEntriesInMemory = 10000
+
+type AuditStore interface {
+	Record(logging.Logger, models.AuditEntry)
+	GetEntries(logging.Logger, models.AuditQuery) []models.AuditEntry
+	// Ping reports whether entries can still be recorded
+	Ping(logging.Logger) error
+	// Close flushes the audit file; entries recorded afterwards are only kept in memory
+	Close(logging.Logger) error
+}
+
+type auditStoreImpl struct {
+	entries []models.AuditEntry
+	nextId  int64
+	file    *os.File
+	mutex   *sync.Mutex
+}
+
+// NewAuditStore creates an in-memory AuditStore
+func NewAuditStore() AuditStore {
+	return &auditStoreImpl{
+		entries: make([]models.AuditEntry, 0),
+		nextId:  1,
+		mutex:   &sync.Mutex{},
+	}
+}
+
+// NewFileAuditStore creates an AuditStore that appends every entry to a JSON lines file, and replays the
+// existing entries so they can still be queried after a restart
+func NewFileAuditStore(path string) (AuditStore, error) {
+	store := NewAuditStore().(*auditStoreImpl)
+
+	existing, err := os.Open(path)
+	if err == nil {
+		scanner := bufio.NewScanner(existing)
+		for line := 1; scanner.Scan(); line++ {
+			var entry models.AuditEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				existing.Close()
+				return nil, fmt.Errorf("could not parse %s:%d: %w", path, line, err)
+			}
+			store.append(entry)
+			store.nextId = entry.Id + 1
+		}
+		existing.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not open %s: %w", path, err)
+	}
+
+	// the file is only ever appended to
+	store.file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s for appending: %w", path, err)
+	}
+
+	return store, nil
+}
+
+func (as *auditStoreImpl) Record(log logging.Logger, entry models.AuditEntry) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	entry.Id = as.nextId
+	as.nextId++
+	if entry.Time == "" {
+		entry.Time = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	log.Info("AUDIT", "action", entry.Action, "actor", entry.Actor, "remote_addr", entry.RemoteAddr, "status", entry.Status)
+	as.append(entry)
+
+	if as.file == nil {
+		return
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Error("could not encode audit entry", "id", entry.Id, "error", err)
+		return
+	}
+	if _, err := as.file.Write(append(line, '\n')); err != nil {
+		log.Error("could not write audit entry", "id", entry.Id, "error", err)
+		return
+	}
+	if err := as.file.Sync(); err != nil {
+		log.Error("could not sync audit entry", "id", entry.Id, "error", err)
+	}
+}
+
+func (as *auditStoreImpl) append(entry models.AuditEntry) {
+	if len(as.entries) >= MaxAuditEntriesInMemory {
+		as.entries = as.entries[1:]
+	}
+	as.entries = append(as.entries, entry)
+}
+
+// GetEntries returns the newest entries matching the query, newest first
+func (as *auditStoreImpl) GetEntries(log logging.Logger, query models.AuditQuery) []models.AuditEntry {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	entries := make([]models.AuditEntry, 0)
+	for i := len(as.entries) - 1; i >= 0; i-- {
+		if query.Limit > 0 && len(entries) >= query.Limit {
+			break
+		}
+
+		entry := as.entries[i]
+		if query.Action != "" && entry.Action != query.Action {
+			continue
+		}
+		if query.Actor != "" && entry.Actor != query.Actor {
+			continue
+		}
+		if !query.Since.IsZero() {
+			recorded, err := time.Parse(time.RFC3339, entry.Time)
+			if err != nil || recorded.Before(query.Since) {
+				continue
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func (as *auditStoreImpl) Ping(log logging.Logger) error {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	if as.file == nil {
+		return nil
+	}
+
+	// the open descriptor outlives a deleted file or an unmounted volume, so look the path up again
+	if _, err := os.Stat(as.file.Name()); err != nil {
+		return fmt.Errorf("audit log is unreachable: %w", err)
+	}
+	return nil
+}
+
+func (as *auditStoreImpl) Close(log logging.Logger) error {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	if as.file == nil {
+		return nil
+	}
+
+	file := as.file
+	as.file = nil
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("could not sync the audit log: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("could not close the audit log: %w", err)
+	}
+	log.Info("audit log closed", "path", file.Name())
+	return nil
+}
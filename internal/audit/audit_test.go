@@ -0,0 +1,107 @@
+package audit_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sarabrajsingh/restful-openapi/internal/audit"
+	"github.com/sarabrajsingh/restful-openapi/internal/models"
+	"github.com/sarabrajsingh/restful-openapi/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditStore_GetEntries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Error(gomock.Any(), gomock.Any()).AnyTimes()
+
+	as := audit.NewAuditStore()
+	as.Record(mockLogger, models.AuditEntry{Time: "2024-07-27T14:00:00Z", Action: "errors.delete", Actor: "apiKey:ops"})
+	as.Record(mockLogger, models.AuditEntry{Time: "2024-07-27T15:00:00Z", Action: "config.reload", Actor: "signal:SIGHUP"})
+	as.Record(mockLogger, models.AuditEntry{Time: "2024-07-27T16:00:00Z", Action: "errors.delete", Actor: "bearer:reporting-service"})
+
+	// newest first, with ids assigned in order
+	entries := as.GetEntries(mockLogger, models.AuditQuery{})
+	assert.Len(t, entries, 3)
+	assert.Equal(t, int64(3), entries[0].Id)
+	assert.Equal(t, int64(1), entries[2].Id)
+
+	entries = as.GetEntries(mockLogger, models.AuditQuery{Action: "errors.delete"})
+	assert.Len(t, entries, 2)
+
+	entries = as.GetEntries(mockLogger, models.AuditQuery{Actor: "apiKey:ops"})
+	assert.Len(t, entries, 1)
+
+	entries = as.GetEntries(mockLogger, models.AuditQuery{Since: time.Date(2024, 7, 27, 14, 30, 0, 0, time.UTC)})
+	assert.Len(t, entries, 2)
+
+	entries = as.GetEntries(mockLogger, models.AuditQuery{Limit: 1})
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "bearer:reporting-service", entries[0].Actor)
+}
+
+func TestFileAuditStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Error(gomock.Any(), gomock.Any()).AnyTimes()
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	as, err := audit.NewFileAuditStore(path)
+	assert.NoError(t, err)
+	as.Record(mockLogger, models.AuditEntry{Action: "errors.delete", Actor: "apiKey:ops", Status: 200})
+	as.Record(mockLogger, models.AuditEntry{Action: "errors.delete", Actor: "apiKey:ops", Status: 200})
+
+	contents, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(contents), "\n"))
+
+	// a restarted server can still answer for the old entries, and keeps numbering them
+	reopened, err := audit.NewFileAuditStore(path)
+	assert.NoError(t, err)
+	reopened.Record(mockLogger, models.AuditEntry{Action: "errors.delete", Actor: "apiKey:ops", Status: 200})
+
+	entries := reopened.GetEntries(mockLogger, models.AuditQuery{})
+	assert.Len(t, entries, 3)
+	assert.Equal(t, int64(3), entries[0].Id)
+
+	contents, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(string(contents), "\n"))
+
+	// entries recorded during the shutdown are kept in memory only
+	assert.NoError(t, reopened.Close(mockLogger))
+	reopened.Record(mockLogger, models.AuditEntry{Action: "errors.delete", Actor: "apiKey:ops", Status: 200})
+	assert.Len(t, reopened.GetEntries(mockLogger, models.AuditQuery{}), 4)
+
+	contents, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(string(contents), "\n"))
+}
+
+func TestFileAuditStorePing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+
+	assert.NoError(t, audit.NewAuditStore().Ping(mockLogger))
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	as, err := audit.NewFileAuditStore(path)
+	assert.NoError(t, err)
+	assert.NoError(t, as.Ping(mockLogger))
+
+	assert.NoError(t, os.Remove(path))
+	assert.Error(t, as.Ping(mockLogger))
+}
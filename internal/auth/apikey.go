@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/sarabrajsingh/restful-openapi/config"
+)
+
+var (
+	// ErrMissingCredentials is returned when the request does not carry any credentials
+	ErrMissingCredentials = errors.New("missing credentials")
+	// ErrInvalidCredentials is returned when the credentials are not recognised
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrInsufficientScope is returned when the caller is known but lacks a required scope
+	ErrInsufficientScope = errors.New("insufficient scope")
+)
+
+// NewAPIKeyAuthenticationFunc returns an openapi3filter.AuthenticationFunc that checks apiKey security schemes
+// against the configured keys and enforces the scopes listed in the operation's security requirement
+func NewAPIKeyAuthenticationFunc(keys []config.APIKey) openapi3filter.AuthenticationFunc {
+	// keys are indexed by their digest so the lookup does not leak timing information about the secrets
+	byDigest := make(map[[sha256.Size]byte]config.APIKey, len(keys))
+	for _, key := range keys {
+		byDigest[sha256.Sum256([]byte(key.Key))] = key
+	}
+
+	return func(ctx context.Context, input *openapi3filter.AuthenticationInput) error {
+		scheme := input.SecurityScheme
+		if scheme.Type != "apiKey" {
+			return fmt.Errorf("unsupported security scheme %q of type %q", input.SecuritySchemeName, scheme.Type)
+		}
+
+		presented := apiKeyFromRequest(input.RequestValidationInput.Request, scheme.In, scheme.Name)
+		if presented == "" {
+			return fmt.Errorf("%w: %s %q is not set", ErrMissingCredentials, scheme.In, scheme.Name)
+		}
+
+		key, ok := byDigest[sha256.Sum256([]byte(presented))]
+		if !ok {
+			return ErrInvalidCredentials
+		}
+
+		if err := RequireScopes(key.Name, key.Scopes, input.Scopes); err != nil {
+			return err
+		}
+
+		SetPrincipal(ctx, &Principal{
+			Name:   key.Name,
+			Method: "apiKey",
+			Scopes: key.Scopes,
+			Roles:  key.Roles,
+		})
+		return nil
+	}
+}
+
+// RequireScopes checks that every required scope has been granted
+func RequireScopes(name string, granted []string, required []string) error {
+	for _, scope := range required {
+		found := false
+		for _, candidate := range granted {
+			if candidate == scope {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: %s lacks scope %q", ErrInsufficientScope, name, scope)
+		}
+	}
+	return nil
+}
+
+func apiKeyFromRequest(r *http.Request, in string, name string) string {
+	switch in {
+	case "header":
+		return r.Header.Get(name)
+	case "query":
+		return r.URL.Query().Get(name)
+	case "cookie":
+		if cookie, err := r.Cookie(name); err == nil {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// StatusCode maps an error returned by the OpenAPI request validation to a response code; it returns
+// zero if the error is not an authentication failure
+func StatusCode(err error) int {
+	var securityErr *openapi3filter.SecurityRequirementsError
+	if !errors.As(err, &securityErr) {
+		return 0
+	}
+	if errors.Is(err, ErrInsufficientScope) {
+		return http.StatusForbidden
+	}
+	return http.StatusUnauthorized
+}
@@ -0,0 +1,102 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyAuthenticationFunc(t *testing.T) {
+	authFunc := auth.NewAPIKeyAuthenticationFunc([]config.APIKey{
+		{Name: "gateway-01", Key: "device-secret", Scopes: []string{"ingest"}},
+		{Name: "ops", Key: "admin-secret", Scopes: []string{"ingest", "read", "admin"}},
+	})
+
+	scheme := &openapi3.SecurityScheme{Type: "apiKey", In: "header", Name: "X-API-Key"}
+
+	testCases := []struct {
+		description       string
+		apiKey            string
+		scopes            []string
+		expectedErr       error
+		expectedPrincipal string
+	}{
+		{
+			description: "Missing key",
+			scopes:      []string{"ingest"},
+			expectedErr: auth.ErrMissingCredentials,
+		},
+		{
+			description: "Unknown key",
+			apiKey:      "foobar",
+			scopes:      []string{"ingest"},
+			expectedErr: auth.ErrInvalidCredentials,
+		},
+		{
+			description: "Device key cannot delete errors",
+			apiKey:      "device-secret",
+			scopes:      []string{"admin"},
+			expectedErr: auth.ErrInsufficientScope,
+		},
+		{
+			description:       "Device key can ingest",
+			apiKey:            "device-secret",
+			scopes:            []string{"ingest"},
+			expectedPrincipal: "gateway-01",
+		},
+		{
+			description:       "Admin key can delete errors",
+			apiKey:            "admin-secret",
+			scopes:            []string{"admin"},
+			expectedPrincipal: "ops",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/api/v1/errors", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.apiKey != "" {
+				req.Header.Set("X-API-Key", tc.apiKey)
+			}
+
+			ctx := auth.NewContext(context.Background())
+			err = authFunc(ctx, &openapi3filter.AuthenticationInput{
+				RequestValidationInput: &openapi3filter.RequestValidationInput{Request: req},
+				SecuritySchemeName:     "ApiKeyAuth",
+				SecurityScheme:         scheme,
+				Scopes:                 tc.scopes,
+			})
+
+			principal, ok := auth.PrincipalFromContext(ctx)
+			if tc.expectedErr != nil {
+				assert.True(t, errors.Is(err, tc.expectedErr), "expected %v, got %v", tc.expectedErr, err)
+				assert.False(t, ok)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, tc.expectedPrincipal, principal.Name)
+		})
+	}
+}
+
+func TestStatusCode(t *testing.T) {
+	missing := &openapi3filter.SecurityRequirementsError{Errors: []error{auth.ErrInvalidCredentials}}
+	assert.Equal(t, http.StatusUnauthorized, auth.StatusCode(missing))
+
+	forbidden := &openapi3filter.SecurityRequirementsError{Errors: []error{auth.ErrInsufficientScope}}
+	assert.Equal(t, http.StatusForbidden, auth.StatusCode(forbidden))
+
+	assert.Equal(t, 0, auth.StatusCode(errors.New("request body has an error")))
+}
@@ -0,0 +1,22 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// Authenticators maps an OpenAPI security scheme type ("apiKey", "http", ...) to the function that checks it
+type Authenticators map[string]openapi3filter.AuthenticationFunc
+
+// AuthenticationFunc dispatches every security scheme to the authenticator registered for its type
+func (a Authenticators) AuthenticationFunc() openapi3filter.AuthenticationFunc {
+	return func(ctx context.Context, input *openapi3filter.AuthenticationInput) error {
+		authenticate, ok := a[input.SecurityScheme.Type]
+		if !ok {
+			return fmt.Errorf("%w: %s authentication is not configured", ErrMissingCredentials, input.SecuritySchemeName)
+		}
+		return authenticate(ctx, input)
+	}
+}
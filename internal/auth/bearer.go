@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sarabrajsingh/restful-openapi/config"
+)
+
+const bearerPrefix = "Bearer "
+
+// NewBearerAuthenticationFunc returns an openapi3filter.AuthenticationFunc that verifies RS256 and ES256 bearer
+// tokens against a key set and enforces the scopes listed in the operation's security requirement
+func NewBearerAuthenticationFunc(keys KeySource, cfg config.JWTConfig) openapi3filter.AuthenticationFunc {
+	parserOptions := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()}),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(cfg.Audience))
+	}
+	parser := jwt.NewParser(parserOptions...)
+
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return keys.Key(kid)
+	}
+
+	return func(ctx context.Context, input *openapi3filter.AuthenticationInput) error {
+		scheme := input.SecurityScheme
+		if scheme.Type != "http" || !strings.EqualFold(scheme.Scheme, "bearer") {
+			return fmt.Errorf("unsupported security scheme %q of type %q", input.SecuritySchemeName, scheme.Type)
+		}
+
+		header := input.RequestValidationInput.Request.Header.Get("Authorization")
+		if header == "" {
+			return fmt.Errorf("%w: Authorization header is not set", ErrMissingCredentials)
+		}
+		// the authentication scheme name is case-insensitive
+		if len(header) < len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+			return fmt.Errorf("%w: Authorization header is not a bearer token", ErrMissingCredentials)
+		}
+		tokenString := strings.TrimSpace(header[len(bearerPrefix):])
+
+		claims := jwt.MapClaims{}
+		if _, err := parser.ParseWithClaims(tokenString, claims, keyFunc); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+		}
+
+		subject, err := claims.GetSubject()
+		if err != nil || subject == "" {
+			return fmt.Errorf("%w: token has no subject", ErrInvalidCredentials)
+		}
+
+		scopes := stringsFromClaim(claims[cfg.ScopeClaim])
+		if err := RequireScopes(subject, scopes, input.Scopes); err != nil {
+			return err
+		}
+
+		SetPrincipal(ctx, &Principal{
+			Name:   subject,
+			Method: "bearer",
+			Scopes: scopes,
+			Roles:  stringsFromClaim(claims[cfg.RolesClaim]),
+		})
+		return nil
+	}
+}
+
+// stringsFromClaim accepts both the space-separated OAuth 2.0 form and a JSON array of strings
+func stringsFromClaim(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				items = append(items, s)
+			}
+		}
+		return items
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeBigInt(value *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(value.Bytes())
+}
+
+// writeJWKS writes the public halves of the keys to a JWKS file and returns its path
+func writeJWKS(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) string {
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": "rsa-1",
+				"use": "sig",
+				"n":   encodeBigInt(rsaKey.N),
+				"e":   encodeBigInt(big.NewInt(int64(rsaKey.E))),
+			},
+			{
+				"kty": "EC",
+				"kid": "ec-1",
+				"crv": "P-256",
+				"x":   encodeBigInt(ecKey.X),
+				"y":   encodeBigInt(ecKey.Y),
+			},
+		},
+	}
+
+	contents, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, contents, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestBearerAuthenticationFunc(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.JWTConfig{
+		JWKSFile:   writeJWKS(t, rsaKey, ecKey),
+		Issuer:     "https://issuer.internal",
+		Audience:   "temperature-api",
+		ScopeClaim: config.DefaultJWTScopeClaim,
+	}
+
+	keys, err := auth.NewKeySource(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authFunc := auth.NewBearerAuthenticationFunc(keys, cfg)
+
+	claims := func(scope interface{}) jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub":   "reporting-service",
+			"iss":   cfg.Issuer,
+			"aud":   cfg.Audience,
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"scope": scope,
+		}
+	}
+
+	expired := claims("read")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+
+	wrongIssuer := claims("read")
+	wrongIssuer["iss"] = "https://somebody.else"
+
+	testCases := []struct {
+		description   string
+		authorization string
+		scopes        []string
+		expectedErr   error
+	}{
+		{
+			description: "Missing token",
+			scopes:      []string{"read"},
+			expectedErr: auth.ErrMissingCredentials,
+		},
+		{
+			description:   "RS256 token",
+			authorization: "Bearer " + signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims("read admin")),
+			scopes:        []string{"admin"},
+		},
+		{
+			description:   "ES256 token with an array of scopes",
+			authorization: "bearer " + signToken(t, jwt.SigningMethodES256, "ec-1", ecKey, claims([]string{"ingest"})),
+			scopes:        []string{"ingest"},
+		},
+		{
+			description:   "Missing scope",
+			authorization: "Bearer " + signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims("read")),
+			scopes:        []string{"admin"},
+			expectedErr:   auth.ErrInsufficientScope,
+		},
+		{
+			description:   "Signed by an unknown key",
+			authorization: "Bearer " + signToken(t, jwt.SigningMethodRS256, "rsa-1", otherKey, claims("read")),
+			scopes:        []string{"read"},
+			expectedErr:   auth.ErrInvalidCredentials,
+		},
+		{
+			description:   "Expired token",
+			authorization: "Bearer " + signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, expired),
+			scopes:        []string{"read"},
+			expectedErr:   auth.ErrInvalidCredentials,
+		},
+		{
+			description:   "Wrong issuer",
+			authorization: "Bearer " + signToken(t, jwt.SigningMethodES256, "ec-1", ecKey, wrongIssuer),
+			scopes:        []string{"read"},
+			expectedErr:   auth.ErrInvalidCredentials,
+		},
+	}
+
+	scheme := &openapi3.SecurityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT"}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/api/v1/errors", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+
+			ctx := auth.NewContext(context.Background())
+			err = authFunc(ctx, &openapi3filter.AuthenticationInput{
+				RequestValidationInput: &openapi3filter.RequestValidationInput{Request: req},
+				SecuritySchemeName:     "BearerAuth",
+				SecurityScheme:         scheme,
+				Scopes:                 tc.scopes,
+			})
+
+			principal, ok := auth.PrincipalFromContext(ctx)
+			if tc.expectedErr != nil {
+				assert.True(t, errors.Is(err, tc.expectedErr), "expected %v, got %v", tc.expectedErr, err)
+				assert.False(t, ok)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, "reporting-service", principal.Name)
+			assert.Equal(t, "bearer", principal.Method)
+		})
+	}
+}
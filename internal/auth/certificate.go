@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// deviceURIPrefix is the URI SAN form used by our device certificates, e.g. urn:device:365951380
+const deviceURIPrefix = "urn:device:"
+
+// ErrDeviceMismatch is returned when a device submits a reading for a device id other than its own
+var ErrDeviceMismatch = errors.New("device id does not match the client certificate")
+
+// DeviceIdentity is the device bound to the client certificate of a request
+type DeviceIdentity struct {
+	Subject string
+	// DeviceId is only meaningful when Valid is set; a certificate that names no device can't submit readings
+	DeviceId int32
+	Valid    bool
+}
+
+type deviceIdentityKey struct{}
+
+// DeviceIdFromCertificate reads the device id from a urn:device URI SAN, falling back to a numeric common name
+func DeviceIdFromCertificate(cert *x509.Certificate) (int32, bool) {
+	for _, uri := range cert.URIs {
+		if value, found := strings.CutPrefix(uri.String(), deviceURIPrefix); found {
+			if deviceId, err := strconv.ParseInt(value, 10, 32); err == nil {
+				return int32(deviceId), true
+			}
+		}
+	}
+
+	if deviceId, err := strconv.ParseInt(cert.Subject.CommonName, 10, 32); err == nil {
+		return int32(deviceId), true
+	}
+
+	return 0, false
+}
+
+// DeviceIdentityMiddleware binds the verified client certificate of a request to a device id
+func DeviceIdentityMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			cert := r.TLS.VerifiedChains[0][0]
+			deviceId, ok := DeviceIdFromCertificate(cert)
+			identity := &DeviceIdentity{
+				Subject:  cert.Subject.String(),
+				DeviceId: deviceId,
+				Valid:    ok,
+			}
+			r = r.WithContext(context.WithValue(r.Context(), deviceIdentityKey{}, identity))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// DeviceIdentityFromContext returns the device bound to the request, if there is one
+func DeviceIdentityFromContext(ctx context.Context) (*DeviceIdentity, bool) {
+	identity, ok := ctx.Value(deviceIdentityKey{}).(*DeviceIdentity)
+	return identity, ok
+}
+
+// CheckDevice makes sure a request bound to a device certificate only reports for that device;
+// requests without a bound certificate are left to the other authenticators
+func CheckDevice(ctx context.Context, deviceId int32) error {
+	identity, ok := DeviceIdentityFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if !identity.Valid {
+		return fmt.Errorf("%w: %s does not name a device", ErrDeviceMismatch, identity.Subject)
+	}
+	if identity.DeviceId != deviceId {
+		return fmt.Errorf("%w: certificate is bound to device_id=%d, got device_id=%d", ErrDeviceMismatch, identity.DeviceId, deviceId)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceIdFromCertificate(t *testing.T) {
+	deviceURI, err := url.Parse("urn:device:365951380")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		description      string
+		cert             *x509.Certificate
+		expectedDeviceId int32
+		expectedOk       bool
+	}{
+		{
+			description:      "URI SAN",
+			cert:             &x509.Certificate{URIs: []*url.URL{deviceURI}, Subject: pkix.Name{CommonName: "gateway"}},
+			expectedDeviceId: 365951380,
+			expectedOk:       true,
+		},
+		{
+			description:      "Numeric common name",
+			cert:             &x509.Certificate{Subject: pkix.Name{CommonName: "1234"}},
+			expectedDeviceId: 1234,
+			expectedOk:       true,
+		},
+		{
+			description: "Common name larger than an int32",
+			cert:        &x509.Certificate{Subject: pkix.Name{CommonName: "36595138029567120956"}},
+			expectedOk:  false,
+		},
+		{
+			description: "No device",
+			cert:        &x509.Certificate{Subject: pkix.Name{CommonName: "ops-laptop"}},
+			expectedOk:  false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			deviceId, ok := auth.DeviceIdFromCertificate(tc.cert)
+			assert.Equal(t, tc.expectedOk, ok)
+			assert.Equal(t, tc.expectedDeviceId, deviceId)
+		})
+	}
+}
+
+func TestCheckDevice(t *testing.T) {
+	// requests without a client certificate are not bound to a device
+	assert.NoError(t, auth.CheckDevice(context.Background(), 1234))
+
+	var ctx context.Context
+	handler := auth.DeviceIdentityMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	}))
+
+	req := httptest.NewRequest("POST", "/api/v1/temp", nil)
+	req.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "1234"}}}},
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.NoError(t, auth.CheckDevice(ctx, 1234))
+	assert.True(t, errors.Is(auth.CheckDevice(ctx, 4321), auth.ErrDeviceMismatch))
+
+	req.TLS.VerifiedChains = [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "ops-laptop"}}}}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.True(t, errors.Is(auth.CheckDevice(ctx, 1234), auth.ErrDeviceMismatch))
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"sync"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Name   string
+	Method string
+	Scopes []string
+	Roles  []string
+}
+
+// ID identifies the principal across authentication methods, e.g. apiKey:ops or bearer:reporting-service
+func (p *Principal) ID() string {
+	return p.Method + ":" + p.Name
+}
+
+type principalKey struct{}
+
+// principalHolder is placed in the request context before the OpenAPI validation runs, since an
+// openapi3filter.AuthenticationFunc only sees the context and cannot replace the request
+type principalHolder struct {
+	principal *Principal
+	mutex     sync.Mutex
+}
+
+// NewContext returns a context that can carry the Principal of the request; a context that can already
+// carry one is returned as is, so that outer middleware can read the Principal set further in
+func NewContext(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(principalKey{}).(*principalHolder); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, principalKey{}, &principalHolder{})
+}
+
+// SetPrincipal records the authenticated caller in a context created by NewContext
+func SetPrincipal(ctx context.Context, principal *Principal) {
+	holder, ok := ctx.Value(principalKey{}).(*principalHolder)
+	if !ok {
+		return
+	}
+	holder.mutex.Lock()
+	defer holder.mutex.Unlock()
+	holder.principal = principal
+}
+
+// PrincipalFromContext returns the authenticated caller, if there is one
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	holder, ok := ctx.Value(principalKey{}).(*principalHolder)
+	if !ok {
+		return nil, false
+	}
+	holder.mutex.Lock()
+	defer holder.mutex.Unlock()
+	return holder.principal, holder.principal != nil
+}
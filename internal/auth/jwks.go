@@ -0,0 +1,272 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/config"
+)
+
+// minJWKSRefreshInterval stops tokens with unknown key ids from hammering the JWKS endpoint
+const minJWKSRefreshInterval = time.Minute
+
+// ErrUnknownKey is returned when a token is signed by a key that is not in the key set
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// errUnsupportedKey marks the keys of a type or a curve the tokens can't be signed with here, e.g. the OKP and oct
+// keys an issuer publishes along with its RSA and EC ones
+var errUnsupportedKey = errors.New("unsupported key")
+
+// KeySource provides the public key used to verify a token signature
+type KeySource interface {
+	Key(kid string) (crypto.PublicKey, error)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// KeySet holds the RSA and EC public keys of a JSON Web Key Set, indexed by key id
+type KeySet struct {
+	keys map[string]crypto.PublicKey
+}
+
+// ParseKeySet decodes a JSON Web Key Set; keys that are not meant for signatures, or of a type or a curve that is not
+// supported, are skipped, and a set without any other key is rejected
+func ParseKeySet(contents []byte) (*KeySet, error) {
+	var document jsonWebKeySet
+	if err := json.Unmarshal(contents, &document); err != nil {
+		return nil, err
+	}
+
+	keySet := &KeySet{keys: make(map[string]crypto.PublicKey, len(document.Keys))}
+	for i, jwk := range document.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		var (
+			key crypto.PublicKey
+			err error
+		)
+		switch jwk.Kty {
+		case "RSA":
+			key, err = jwk.rsaPublicKey()
+		case "EC":
+			key, err = jwk.ecPublicKey()
+		default:
+			err = fmt.Errorf("%w type %q", errUnsupportedKey, jwk.Kty)
+		}
+		if errors.Is(err, errUnsupportedKey) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("keys[%d] (kid=%s): %w", i, jwk.Kid, err)
+		}
+		keySet.keys[jwk.Kid] = key
+	}
+
+	if len(keySet.keys) == 0 {
+		return nil, errors.New("no RSA or P-256 signing key in the key set")
+	}
+	return keySet, nil
+}
+
+// Key returns the key with the given id; tokens without a key id are accepted when the set holds a single key
+func (ks *KeySet) Key(kid string) (crypto.PublicKey, error) {
+	if key, ok := ks.keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: kid=%s", ErrUnknownKey, kid)
+}
+
+func (jwk jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(jwk.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := decodeBigInt(jwk.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+	if !e.IsInt64() || e.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("exponent is too large")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (jwk jsonWebKey) ecPublicKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch jwk.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	default:
+		return nil, fmt.Errorf("%w curve %q", errUnsupportedKey, jwk.Crv)
+	}
+
+	x, err := decodeBigInt(jwk.X)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x coordinate: %w", err)
+	}
+	y, err := decodeBigInt(jwk.Y)
+	if err != nil {
+		return nil, fmt.Errorf("invalid y coordinate: %w", err)
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("point is not on curve %s", jwk.Crv)
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	if value == "" {
+		return nil, fmt.Errorf("value is empty")
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(decoded), nil
+}
+
+// remoteKeySource fetches a key set from a JWKS URL and refetches it when a token names an unknown key
+type remoteKeySource struct {
+	url    string
+	client *http.Client
+	// mutex guards the fields below; it is never held across a fetch, so that the tokens signed by a known key
+	// don't wait for the refresh of the key set
+	mutex       sync.RWMutex
+	keySet      *KeySet
+	lastFetched time.Time
+	// refreshing is the fetch in flight, shared by the tokens that wait for it, nil when there is none
+	refreshing *keyRefresh
+}
+
+// keyRefresh is a fetch of the key set; done is closed once err is set
+type keyRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+func (rs *remoteKeySource) Key(kid string) (crypto.PublicKey, error) {
+	rs.mutex.RLock()
+	key, err := rs.keySet.Key(kid)
+	rs.mutex.RUnlock()
+	if err == nil {
+		return key, nil
+	}
+
+	// the issuer may have rotated its keys
+	if refreshErr := rs.refresh(); refreshErr != nil {
+		return nil, fmt.Errorf("%w (refresh failed: %v)", err, refreshErr)
+	}
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	return rs.keySet.Key(kid)
+}
+
+// refresh refetches the key set at most once per minJWKSRefreshInterval; the callers arriving while a fetch is in
+// flight wait for that one rather than starting their own
+func (rs *remoteKeySource) refresh() error {
+	rs.mutex.Lock()
+	if inFlight := rs.refreshing; inFlight != nil {
+		rs.mutex.Unlock()
+		<-inFlight.done
+		return inFlight.err
+	}
+	if time.Since(rs.lastFetched) < minJWKSRefreshInterval {
+		rs.mutex.Unlock()
+		return nil
+	}
+	inFlight := &keyRefresh{done: make(chan struct{})}
+	rs.refreshing = inFlight
+	rs.lastFetched = time.Now()
+	rs.mutex.Unlock()
+
+	keySet, err := rs.fetch()
+
+	rs.mutex.Lock()
+	if err == nil {
+		rs.keySet = keySet
+	}
+	rs.refreshing = nil
+	rs.mutex.Unlock()
+
+	inFlight.err = err
+	close(inFlight.done)
+	return err
+}
+
+// fetch downloads and parses the key set, without touching the one in use
+func (rs *remoteKeySource) fetch() (*KeySet, error) {
+	resp, err := rs.client.Get(rs.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, rs.url)
+	}
+
+	contents, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeySet(contents)
+}
+
+// NewKeySource loads the key set named by the JWT configuration; a JWKS file takes precedence over a URL
+func NewKeySource(cfg config.JWTConfig) (KeySource, error) {
+	if cfg.JWKSFile != "" {
+		contents, err := os.ReadFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read JWKS file %s: %w", cfg.JWKSFile, err)
+		}
+		keySet, err := ParseKeySet(contents)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse JWKS file %s: %w", cfg.JWKSFile, err)
+		}
+		return keySet, nil
+	}
+
+	source := &remoteKeySource{
+		url:    cfg.JWKSURL,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+	source.lastFetched = time.Now()
+	keySet, err := source.fetch()
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch JWKS from %s: %w", cfg.JWKSURL, err)
+	}
+	source.keySet = keySet
+	return source, nil
+}
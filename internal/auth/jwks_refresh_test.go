@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRemoteKeySourceRefresh tests that a refresh of the key set doesn't hold up the tokens signed by a known key, and
+// that the tokens naming an unknown key share the refresh in flight
+func TestRemoteKeySourceRefresh(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first fetch is the one of NewKeySource, the refresh waits for the test
+		kids := `"rsa-1"`
+		if fetches.Add(1) > 1 {
+			<-release
+			kids = `"rsa-2"`
+		}
+		fmt.Fprintf(w, `{"keys":[{"kty":"RSA","kid":%s,"n":"%s","e":"%s"},{"kty":"RSA","kid":"rsa-1","n":"%s","e":"%s"}]}`,
+			kids, encode(rsaKey.N), encode(big.NewInt(int64(rsaKey.E))), encode(rsaKey.N), encode(big.NewInt(int64(rsaKey.E))))
+	}))
+	defer jwksServer.Close()
+
+	keys, err := NewKeySource(config.JWTConfig{JWKSURL: jwksServer.URL})
+	assert.NoError(t, err)
+	source := keys.(*remoteKeySource)
+	source.mutex.Lock()
+	source.lastFetched = time.Time{}
+	source.mutex.Unlock()
+
+	var waiting sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		waiting.Add(1)
+		go func() {
+			defer waiting.Done()
+			_, err := keys.Key("rsa-2")
+			assert.NoError(t, err)
+		}()
+	}
+	assert.Eventually(t, func() bool { return fetches.Load() == 2 }, time.Second, time.Millisecond)
+
+	// the known key is served while the refresh is in flight
+	_, err = keys.Key("rsa-1")
+	assert.NoError(t, err)
+
+	close(release)
+	waiting.Wait()
+	assert.Equal(t, int32(2), fetches.Load(), "the tokens naming rsa-2 share a single refresh")
+}
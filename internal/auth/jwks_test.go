@@ -0,0 +1,75 @@
+package auth_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+// ecKey is the generator of P-256, a valid public key
+const ecKey = `{"kty":"EC","kid":"ec-1","crv":"P-256","x":"axfR8uEsQkf4vOblY6RA8ncDfYEt6zOg9KE5RdiYwpY","y":"T-NC4v4af5uO5-tKfA-eFivOM1drMV7Oy7ZAaDe_UfU"}`
+
+func TestParseKeySet(t *testing.T) {
+	testCases := []struct {
+		description string
+		jwks        string
+		expectErr   bool
+	}{
+		{"Empty key set", `{"keys":[]}`, true},
+		{"Only encryption keys", `{"keys":[{"kty":"RSA","use":"enc","kid":"enc-1"}]}`, true},
+		{"Only unsupported key types", `{"keys":[{"kty":"oct","kid":"hmac-1","k":"c2VjcmV0"}]}`, true},
+		{"Only unsupported curves", `{"keys":[{"kty":"EC","kid":"ec-1","crv":"P-521","x":"AQ","y":"AQ"}]}`, true},
+		{"Other keys are skipped", `{"keys":[` + ecKey + `,{"kty":"RSA","use":"enc","kid":"enc-1"},{"kty":"oct","kid":"hmac-1","k":"c2VjcmV0"},{"kty":"OKP","kid":"ed-1","crv":"Ed25519","x":"AQ"},{"kty":"EC","kid":"ec-2","crv":"P-521","x":"AQ","y":"AQ"}]}`, false},
+		{"Point off the curve", `{"keys":[{"kty":"EC","kid":"ec-1","crv":"P-256","x":"AQ","y":"AQ"}]}`, true},
+		{"Not JSON", `foobar`, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			keySet, err := auth.ParseKeySet([]byte(tc.jwks))
+			assert.Equal(t, tc.expectErr, err != nil, "unexpected error: %v", err)
+			if err == nil {
+				_, err = keySet.Key("ec-1")
+				assert.NoError(t, err)
+				_, err = keySet.Key("hmac-1")
+				assert.ErrorIs(t, err, auth.ErrUnknownKey)
+			}
+		})
+	}
+}
+
+func TestNewKeySourceFromURL(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"keys":[{"kty":"RSA","kid":"rsa-1","n":"%s","e":"%s"}]}`,
+			encodeBigInt(rsaKey.N), encodeBigInt(big.NewInt(int64(rsaKey.E))))
+	}))
+	defer jwksServer.Close()
+
+	keys, err := auth.NewKeySource(config.JWTConfig{JWKSURL: jwksServer.URL})
+	assert.NoError(t, err)
+
+	key, err := keys.Key("rsa-1")
+	assert.NoError(t, err)
+	assert.True(t, rsaKey.PublicKey.Equal(key))
+
+	// a single key may be used by tokens without a key id
+	_, err = keys.Key("")
+	assert.NoError(t, err)
+
+	_, err = keys.Key("rsa-2")
+	assert.True(t, errors.Is(err, auth.ErrUnknownKey))
+}
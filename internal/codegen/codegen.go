@@ -0,0 +1,338 @@
+// Package codegen renders Go code from the OpenAPI contract, so that the models and the routes cannot drift from it
+package codegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"net/http"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// GoNameExtension renames a schema or a property in the generated code
+	GoNameExtension = "x-go-name"
+	// GoTypeExtension overrides the Go type of a property
+	GoTypeExtension = "x-go-type"
+)
+
+// methods is the order the operations of a path are listed in
+var methods = []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete, http.MethodOptions,
+	http.MethodHead, http.MethodPatch, http.MethodTrace}
+
+// Contract is a loaded contract, along with the order of its keys which the loader does not keep
+type Contract struct {
+	// Source is the path printed in the header of the generated files
+	Source string
+	spec   *openapi3.T
+	// order lists the keys of every mapping of the document by its path, e.g. "components.schemas"
+	order map[string][]string
+}
+
+// Load parses and validates the contract
+func Load(data []byte, source string) (*Contract, error) {
+	spec, err := openapi3.NewLoader().LoadFromData(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := spec.Validate(openapi3.NewLoader().Context); err != nil {
+		return nil, err
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	order := map[string][]string{}
+	if len(document.Content) > 0 {
+		collectOrder(document.Content[0], "", order)
+	}
+
+	return &Contract{Source: source, spec: spec, order: order}, nil
+}
+
+func collectOrder(node *yaml.Node, path string, order map[string][]string) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		order[path] = append(order[path], key)
+		collectOrder(node.Content[i+1], path+"."+key, order)
+	}
+}
+
+// Field is a property of a schema
+type Field struct {
+	Name        string
+	Type        string
+	Tag         string
+	Description []string
+}
+
+// Model is a schema of the components
+type Model struct {
+	Name        string
+	Description []string
+	Fields      []Field
+}
+
+// Operation is an operation of the contract; Name is the Go name of its operationId
+type Operation struct {
+	Id      string
+	Name    string
+	Method  string
+	Path    string
+	Summary string
+}
+
+// Models returns a Go type for every schema of the components, in the order of the contract; the schemas of base,
+// the contract of a previous version, are left out since they are generated with it, and must not have changed
+func (c *Contract) Models(base *Contract) ([]Model, error) {
+	var models []Model
+	for _, name := range c.order[".components.schemas"] {
+		schema := c.spec.Components.Schemas[name].Value
+		if base != nil {
+			if same, err := base.hasSchema(name, c.spec.Components.Schemas[name]); err != nil || same {
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+		if !schema.Type.Is(openapi3.TypeObject) {
+			return nil, fmt.Errorf("schema %s: only objects can be generated", name)
+		}
+
+		model := Model{Name: c.schemaName(name), Description: lines(schema.Description)}
+		for _, property := range c.order[".components.schemas."+name+".properties"] {
+			propertySchema := schema.Properties[property]
+			goType, err := c.goType(propertySchema)
+			if err != nil {
+				return nil, fmt.Errorf("schema %s, property %s: %w", name, property, err)
+			}
+
+			tag := property
+			if !contains(schema.Required, property) {
+				tag += ",omitempty"
+			}
+			goName := extension(propertySchema.Value.Extensions, GoNameExtension)
+			if goName == "" {
+				goName = exportedName(property)
+			}
+			model.Fields = append(model.Fields, Field{
+				Name:        goName,
+				Type:        goType,
+				Tag:         fmt.Sprintf("`json:%q`", tag),
+				Description: lines(propertySchema.Value.Description),
+			})
+		}
+		models = append(models, model)
+	}
+	return models, nil
+}
+
+// Operations returns every operation of the contract, in the order of the contract; Load already rejected the
+// contracts that reuse an operationId
+func (c *Contract) Operations() ([]Operation, error) {
+	var operations []Operation
+	for _, path := range c.order[".paths"] {
+		pathItem := c.spec.Paths.Value(path)
+		for _, method := range methods {
+			operation := pathItem.GetOperation(method)
+			if operation == nil {
+				continue
+			}
+			if operation.OperationID == "" {
+				return nil, fmt.Errorf("%s %s has no operationId", method, path)
+			}
+			operations = append(operations, Operation{
+				Id:      operation.OperationID,
+				Name:    exportedName(operation.OperationID),
+				Method:  method,
+				Path:    path,
+				Summary: operation.Summary,
+			})
+		}
+	}
+	return operations, nil
+}
+
+// hasSchema tells whether the contract has a schema named name, and fails when its definition differs from schema,
+// which would need two Go types of the same name
+func (c *Contract) hasSchema(name string, schema *openapi3.SchemaRef) (bool, error) {
+	existing, ok := c.spec.Components.Schemas[name]
+	if !ok {
+		return false, nil
+	}
+	existingJSON, err := json.Marshal(existing)
+	if err != nil {
+		return false, err
+	}
+	schemaJSON, err := json.Marshal(schema)
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(existingJSON, schemaJSON) {
+		return false, fmt.Errorf("schema %s differs from the one of %s; rename it, or keep both definitions the same", name, c.Source)
+	}
+	return true, nil
+}
+
+// schemaName is the Go name of a schema of the components
+func (c *Contract) schemaName(name string) string {
+	if goName := extension(c.spec.Components.Schemas[name].Value.Extensions, GoNameExtension); goName != "" {
+		return goName
+	}
+	return exportedName(name)
+}
+
+func (c *Contract) goType(schemaRef *openapi3.SchemaRef) (string, error) {
+	if schemaRef.Ref != "" {
+		name, found := strings.CutPrefix(schemaRef.Ref, "#/components/schemas/")
+		if !found {
+			return "", fmt.Errorf("only references to the schemas of the components can be generated, got %s", schemaRef.Ref)
+		}
+		return c.schemaName(name), nil
+	}
+
+	schema := schemaRef.Value
+	if goType := extension(schema.Extensions, GoTypeExtension); goType != "" {
+		return goType, nil
+	}
+
+	switch {
+	case schema.Type.Is(openapi3.TypeString):
+		return "string", nil
+	case schema.Type.Is(openapi3.TypeBoolean):
+		return "bool", nil
+	case schema.Type.Is(openapi3.TypeInteger):
+		switch schema.Format {
+		case "int32", "int64":
+			return schema.Format, nil
+		}
+		return "int", nil
+	case schema.Type.Is(openapi3.TypeNumber):
+		if schema.Format == "float" {
+			return "float32", nil
+		}
+		return "float64", nil
+	case schema.Type.Is(openapi3.TypeArray):
+		items, err := c.goType(schema.Items)
+		return "[]" + items, err
+	case schema.Type.Is(openapi3.TypeObject) && schema.AdditionalProperties.Schema != nil:
+		values, err := c.goType(schema.AdditionalProperties.Schema)
+		return "map[string]" + values, err
+	}
+	return "", fmt.Errorf("no Go type for %v; declare it in the components or set %s", schema.Type, GoTypeExtension)
+}
+
+var modelsTemplate = template.Must(template.New("models").Parse(`// Code generated by openapi-gen from {{ .Source }}; DO NOT EDIT.
+
+package {{ .Package }}
+{{ range .Models }}
+{{ range .Description }}// {{ . }}
+{{ end }}type {{ .Name }} struct {
+{{ range .Fields }}{{ range .Description }}	// {{ . }}
+{{ end }}	{{ .Name }} {{ .Type }} {{ .Tag }}
+{{ end }}}
+{{ end }}`))
+
+var operationsTemplate = template.Must(template.New("operations").Parse(`// Code generated by openapi-gen from {{ .Source }}; DO NOT EDIT.
+
+package {{ .Package }}
+
+import "net/http"
+
+// The operationIds of the contract, which also name the routes in the RBAC policy, the rate limits, the metrics and
+// the access log
+const (
+{{ range .Operations }}	Operation{{ $.Prefix }}{{ .Name }} = "{{ .Id }}"
+{{ end }})
+
+// Handlers{{ .Prefix }} has a field for every operation of the contract; a nil handler fails the start up
+type Handlers{{ .Prefix }} struct {
+{{ range .Operations }}	// {{ .Name }} serves {{ .Method }} {{ .Path }}{{ if .Summary }}: {{ .Summary }}{{ end }}
+	{{ .Name }} http.HandlerFunc
+{{ end }}}
+
+// Handler returns the handler of an operationId, and false when the operation was not in the contract the code was
+// generated from
+func (h *Handlers{{ .Prefix }}) Handler(operationId string) (http.HandlerFunc, bool) {
+	switch operationId {
+{{ range .Operations }}	case Operation{{ $.Prefix }}{{ .Name }}:
+		return h.{{ .Name }}, true
+{{ end }}	}
+	return nil, false
+}
+`))
+
+// GenerateModels renders the Go types of the schemas of the components, but the ones of base when it is not nil
+func (c *Contract) GenerateModels(packageName string, base *Contract) ([]byte, error) {
+	models, err := c.Models(base)
+	if err != nil {
+		return nil, err
+	}
+	return render(modelsTemplate, map[string]interface{}{"Source": c.Source, "Package": packageName, "Models": models})
+}
+
+// GenerateOperations renders the operationId constants and the Handlers table; the prefix, e.g. V2, is added to their
+// names so that the tables of several versions of the contract can live in the same package
+func (c *Contract) GenerateOperations(packageName, prefix string) ([]byte, error) {
+	operations, err := c.Operations()
+	if err != nil {
+		return nil, err
+	}
+	return render(operationsTemplate, map[string]interface{}{"Source": c.Source, "Package": packageName, "Prefix": prefix, "Operations": operations})
+}
+
+func render(tmpl *template.Template, data interface{}) ([]byte, error) {
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, err
+	}
+	return format.Source(out.Bytes())
+}
+
+// exportedName turns snake_case and kebab-case keys into Go names, keeping the initialisms the repo writes in capitals
+func exportedName(name string) string {
+	var goName strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' || r == '.' }) {
+		if strings.ToLower(part) == "api" {
+			goName.WriteString("API")
+			continue
+		}
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		goName.WriteString(string(runes))
+	}
+	return goName.String()
+}
+
+func extension(extensions map[string]any, name string) string {
+	value, _ := extensions[name].(string)
+	return value
+}
+
+func lines(description string) []string {
+	description = strings.TrimSpace(description)
+	if description == "" {
+		return nil
+	}
+	return strings.Split(description, "\n")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,226 @@
+package codegen_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sarabrajsingh/restful-openapi/api"
+	"github.com/sarabrajsingh/restful-openapi/internal/codegen"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGeneratedCodeIsUpToDate fails when the contract was edited without running go generate ./...
+func TestGeneratedCodeIsUpToDate(t *testing.T) {
+	contract, err := codegen.Load(api.OpenAPISpec, "api/openapi.yaml")
+	assert.NoError(t, err)
+	contractV2, err := codegen.Load(api.OpenAPISpecV2, "api/openapi.v2.yaml")
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		file     string
+		generate func() ([]byte, error)
+	}{
+		{"../models/openapi.gen.go", func() ([]byte, error) { return contract.GenerateModels("models", nil) }},
+		{"../server/operations.gen.go", func() ([]byte, error) { return contract.GenerateOperations("server", "") }},
+		{"../models/openapi_v2.gen.go", func() ([]byte, error) { return contractV2.GenerateModels("models", contract) }},
+		{"../server/operations_v2.gen.go", func() ([]byte, error) { return contractV2.GenerateOperations("server", "V2") }},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.file, func(t *testing.T) {
+			expected, err := tc.generate()
+			assert.NoError(t, err)
+			actual, err := os.ReadFile(tc.file)
+			assert.NoError(t, err)
+			assert.Equal(t, string(expected), string(actual), "run go generate ./... after editing the contracts in api")
+		})
+	}
+}
+
+// TestModels tests the Go types, names and tags derived from the schemas
+func TestModels(t *testing.T) {
+	contract, err := codegen.Load([]byte(`
+openapi: 3.0.3
+info:
+  title: test
+  version: 1.0.0
+paths: {}
+components:
+  schemas:
+    Reading:
+      type: object
+      description: A reading of a device
+      properties:
+        device_id:
+          type: integer
+          format: int32
+        temperature:
+          type: number
+        api_version:
+          type: string
+        tags:
+          type: array
+          items:
+            type: string
+        labels:
+          type: object
+          additionalProperties:
+            type: string
+        count:
+          type: integer
+          x-go-type: uint64
+        owner:
+          $ref: '#/components/schemas/owner_info'
+      required:
+        - device_id
+    owner_info:
+      type: object
+      x-go-name: Owner
+      properties:
+        name:
+          type: string
+          x-go-name: DisplayName
+`), "test.yaml")
+	assert.NoError(t, err)
+
+	models, err := contract.Models(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []codegen.Model{
+		{
+			Name:        "Reading",
+			Description: []string{"A reading of a device"},
+			Fields: []codegen.Field{
+				{Name: "DeviceId", Type: "int32", Tag: "`json:\"device_id\"`"},
+				{Name: "Temperature", Type: "float64", Tag: "`json:\"temperature,omitempty\"`"},
+				{Name: "APIVersion", Type: "string", Tag: "`json:\"api_version,omitempty\"`"},
+				{Name: "Tags", Type: "[]string", Tag: "`json:\"tags,omitempty\"`"},
+				{Name: "Labels", Type: "map[string]string", Tag: "`json:\"labels,omitempty\"`"},
+				{Name: "Count", Type: "uint64", Tag: "`json:\"count,omitempty\"`"},
+				{Name: "Owner", Type: "Owner", Tag: "`json:\"owner,omitempty\"`"},
+			},
+		},
+		{
+			Name:   "Owner",
+			Fields: []codegen.Field{{Name: "DisplayName", Type: "string", Tag: "`json:\"name,omitempty\"`"}},
+		},
+	}, models)
+
+	code, err := contract.GenerateModels("models", nil)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(code), "// Code generated by openapi-gen from test.yaml; DO NOT EDIT."))
+}
+
+// TestModelsOfBase tests that the schemas of a previous version are left out, and that they may not be redefined
+func TestModelsOfBase(t *testing.T) {
+	const header = `
+openapi: 3.0.3
+info:
+  title: test
+  version: 1.0.0
+paths: {}
+components:
+  schemas:
+    Reading:
+      type: object
+      properties:
+        device_id:
+          type: integer
+          format: int32
+`
+	base, err := codegen.Load([]byte(header), "v1.yaml")
+	assert.NoError(t, err)
+
+	contract, err := codegen.Load([]byte(header+`
+    ReadingList:
+      type: object
+      properties:
+        readings:
+          type: array
+          items:
+            $ref: '#/components/schemas/Reading'
+`), "v2.yaml")
+	assert.NoError(t, err)
+	models, err := contract.Models(base)
+	assert.NoError(t, err)
+	assert.Equal(t, []codegen.Model{
+		{Name: "ReadingList", Fields: []codegen.Field{{Name: "Readings", Type: "[]Reading", Tag: "`json:\"readings,omitempty\"`"}}},
+	}, models)
+
+	changed, err := codegen.Load([]byte(header+`
+        temperature:
+          type: number
+`), "v2.yaml")
+	assert.NoError(t, err)
+	_, err = changed.Models(base)
+	assert.ErrorContains(t, err, "schema Reading differs from the one of v1.yaml")
+}
+
+// TestOperations tests the operations table and that every operation needs a unique operationId
+func TestOperations(t *testing.T) {
+	const header = `
+openapi: 3.0.3
+info:
+  title: test
+  version: 1.0.0
+paths:
+`
+	const responses = `
+      responses:
+        "200":
+          description: OK
+`
+
+	contract, err := codegen.Load([]byte(header+`
+  /readings:
+    post:
+      operationId: ReadingsPost`+responses+`
+    get:
+      operationId: readingsGet
+      summary: List readings`+responses), "test.yaml")
+	assert.NoError(t, err)
+	operations, err := contract.Operations()
+	assert.NoError(t, err)
+	assert.Equal(t, []codegen.Operation{
+		{Id: "readingsGet", Name: "ReadingsGet", Method: "GET", Path: "/readings", Summary: "List readings"},
+		{Id: "ReadingsPost", Name: "ReadingsPost", Method: "POST", Path: "/readings"},
+	}, operations)
+
+	// the Go names are exported, the operationIds are kept as they are in the contract
+	code, err := contract.GenerateOperations("server", "")
+	assert.NoError(t, err)
+	assert.Contains(t, string(code), `OperationReadingsGet  = "readingsGet"`)
+
+	// the tables of several versions live side by side in the same package
+	code, err = contract.GenerateOperations("server", "V2")
+	assert.NoError(t, err)
+	assert.Contains(t, string(code), `OperationV2ReadingsGet  = "readingsGet"`)
+	assert.Contains(t, string(code), `func (h *HandlersV2) Handler(operationId string)`)
+
+	testCases := []struct {
+		description string
+		paths       string
+		expectedErr string
+	}{
+		{"Missing operationId", `
+  /readings:
+    get:` + responses, "GET /readings has no operationId"},
+		{"Duplicate operationId", `
+  /readings:
+    get:
+      operationId: Readings` + responses + `
+  /devices:
+    get:
+      operationId: Readings` + responses, `have the same operation id "Readings"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			contract, err := codegen.Load([]byte(header+tc.paths), "test.yaml")
+			if err == nil {
+				_, err = contract.GenerateOperations("server", "")
+			}
+			assert.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package fleet
+
+import (
+	"container/heap"
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+	"github.com/sarabrajsingh/restful-openapi/internal/models"
+	"github.com/sarabrajsingh/restful-openapi/internal/utils"
+)
+
+const (
+	// MaxWindowMinutes is the largest ingestion window the store can answer for
+	MaxWindowMinutes = 60
+	// DefaultOfflineAfter is how long a device can stay silent before it is counted as offline
+	DefaultOfflineAfter = 10 * time.Minute
+	// HistorySize bounds the readings kept for every device
+	HistorySize = 100
+	// HistoryDevices bounds the devices whose readings are kept; the least recently seen one loses its history first
+	HistoryDevices = 10000
+	// MaxDevices bounds the devices the store knows about; the least recently seen one is forgotten first
+	MaxDevices = 100000
+)
+
+type FleetStore interface {
+	RecordReading(logging.Logger, *models.TempPostPayload, bool)
+	// GetSummary summarizes the fleet over a window of minutes, ranking the top hottest online devices; the malformed
+	// payloads are the ones stored in the ErrorStore since the server started, which the malformed rate is based on
+	GetSummary(log logging.Logger, windowMinutes int, top int, malformedPayloads uint64) models.FleetSummaryResponse
+	// GetReadings returns up to limit readings of a device, newest first, and false when the device never reported;
+	// a device whose history was dropped for more recently seen ones has no readings
+	GetReadings(logging.Logger, int32, int) ([]models.DeviceReading, bool)
+}
+
+type deviceState struct {
+	lastSeen        time.Time
+	lastTemperature float64
+	overtemp        bool
+	// history holds the last HistorySize readings as a ring, next is where the next reading goes
+	history []models.DeviceReading
+	next    int
+	// recent is the element of the device in the history order, nil when no history is kept for it
+	recent *list.Element
+	// seen is the element of the device in the order of the devices
+	seen *list.Element
+}
+
+// minuteBucket counts readings received during a single wall-clock minute
+type minuteBucket struct {
+	minute int64
+	count  int
+}
+
+type fleetStoreImpl struct {
+	devices       map[int32]*deviceState
+	buckets       [MaxWindowMinutes]minuteBucket
+	validReadings uint64
+	// order lists the ids of all the devices, most recently seen first
+	order *list.List
+	// historyOrder lists the ids of the devices that have a history, most recently seen first
+	historyOrder *list.List
+	offlineAfter time.Duration
+	now          func() time.Time
+	mutex        *sync.Mutex
+}
+
+func NewFleetStore() FleetStore {
+	return NewFleetStoreWithClock(DefaultOfflineAfter, time.Now)
+}
+
+// NewFleetStoreWithClock creates a FleetStore with a custom offline threshold and time source
+func NewFleetStoreWithClock(offlineAfter time.Duration, now func() time.Time) FleetStore {
+	return &fleetStoreImpl{
+		devices:      make(map[int32]*deviceState),
+		order:        list.New(),
+		historyOrder: list.New(),
+		offlineAfter: offlineAfter,
+		now:          now,
+		mutex:        &sync.Mutex{},
+	}
+}
+
+func (fs *fleetStoreImpl) RecordReading(log logging.Logger, reading *models.TempPostPayload, overtemp bool) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	now := fs.now()
+
+	device, ok := fs.devices[reading.DeviceId]
+	if !ok {
+		device = &deviceState{seen: fs.order.PushFront(reading.DeviceId)}
+		fs.devices[reading.DeviceId] = device
+		fs.forgetOldest()
+	} else {
+		fs.order.MoveToFront(device.seen)
+	}
+	device.lastSeen = now
+	device.lastTemperature = reading.Temperature
+	device.overtemp = overtemp
+
+	entry := models.DeviceReading{
+		Temperature: reading.Temperature,
+		Overtemp:    overtemp,
+		RecordedAt:  utils.ReadingTime(reading.EpochMS).Format(time.RFC3339),
+		ReceivedAt:  now.UTC().Format(time.RFC3339),
+	}
+	if len(device.history) < HistorySize {
+		device.history = append(device.history, entry)
+	} else {
+		device.history[device.next] = entry
+	}
+	device.next = (device.next + 1) % HistorySize
+	fs.touchHistory(reading.DeviceId, device)
+
+	minute := now.Unix() / 60
+	bucket := &fs.buckets[minute%MaxWindowMinutes]
+	if bucket.minute != minute {
+		bucket.minute = minute
+		bucket.count = 0
+	}
+	bucket.count++
+
+	fs.validReadings++
+}
+
+// touchHistory moves the device to the front of the history order, and drops the history of the least recently seen
+// device once more than HistoryDevices have one, so that rotating device ids can't grow the readings kept for ever
+func (fs *fleetStoreImpl) touchHistory(deviceId int32, device *deviceState) {
+	if device.recent != nil {
+		fs.historyOrder.MoveToFront(device.recent)
+		return
+	}
+	device.recent = fs.historyOrder.PushFront(deviceId)
+	if fs.historyOrder.Len() <= HistoryDevices {
+		return
+	}
+	oldest := fs.historyOrder.Back()
+	fs.historyOrder.Remove(oldest)
+	evicted := fs.devices[oldest.Value.(int32)]
+	evicted.history, evicted.next, evicted.recent = nil, 0, nil
+}
+
+// forgetOldest drops the least recently seen device, along with its history, once the store knows more than
+// MaxDevices, so that rotating device ids can't grow the store for ever
+func (fs *fleetStoreImpl) forgetOldest() {
+	if fs.order.Len() <= MaxDevices {
+		return
+	}
+	oldest := fs.order.Back()
+	fs.order.Remove(oldest)
+	deviceId := oldest.Value.(int32)
+	if evicted := fs.devices[deviceId]; evicted.recent != nil {
+		fs.historyOrder.Remove(evicted.recent)
+	}
+	delete(fs.devices, deviceId)
+}
+
+func (fs *fleetStoreImpl) GetSummary(log logging.Logger, windowMinutes int, top int, malformedPayloads uint64) models.FleetSummaryResponse {
+	if windowMinutes < 1 {
+		windowMinutes = 1
+	}
+	if windowMinutes > MaxWindowMinutes {
+		windowMinutes = MaxWindowMinutes
+	}
+
+	// only the counters are copied under the lock, so that ranking a large fleet doesn't hold up the readings
+	fs.mutex.Lock()
+	now := fs.now()
+	summary := models.FleetSummaryResponse{
+		TotalDevices:      len(fs.devices),
+		WindowMinutes:     windowMinutes,
+		MalformedPayloads: malformedPayloads,
+	}
+	online := make([]rankedDevice, 0, len(fs.devices))
+	for deviceId, device := range fs.devices {
+		// the last temperature of an offline device may be hours old, so it is not ranked among the hottest
+		if now.Sub(device.lastSeen) > fs.offlineAfter {
+			summary.OfflineDevices++
+			continue
+		}
+		if device.overtemp {
+			summary.OvertempDevices++
+		}
+		online = append(online, rankedDevice{deviceId: deviceId, temperature: device.lastTemperature, overtemp: device.overtemp, lastSeen: device.lastSeen})
+	}
+
+	// the window includes the current, partially elapsed minute
+	currentMinute := now.Unix() / 60
+	for _, bucket := range fs.buckets {
+		if bucket.minute > currentMinute-int64(windowMinutes) && bucket.minute <= currentMinute {
+			summary.ReadingsInWindow += bucket.count
+		}
+	}
+
+	if total := fs.validReadings + malformedPayloads; total > 0 {
+		summary.MalformedRate = float64(malformedPayloads) / float64(total)
+	}
+	fs.mutex.Unlock()
+
+	hottest := hottestDevices(online, top)
+	summary.HottestDevices = make([]models.FleetDevice, 0, len(hottest))
+	for _, device := range hottest {
+		summary.HottestDevices = append(summary.HottestDevices, models.FleetDevice{
+			DeviceId:    device.deviceId,
+			Temperature: device.temperature,
+			Overtemp:    device.overtemp,
+			LastSeen:    device.lastSeen.Format("2006/01/02 15:04:05"),
+		})
+	}
+	return summary
+}
+
+// rankedDevice is the copy of a device that GetSummary ranks outside of the lock
+type rankedDevice struct {
+	deviceId    int32
+	temperature float64
+	overtemp    bool
+	lastSeen    time.Time
+}
+
+// hotter orders the devices by temperature, hottest first, and by device id among equals
+func hotter(a, b rankedDevice) bool {
+	if a.temperature == b.temperature {
+		return a.deviceId < b.deviceId
+	}
+	return a.temperature > b.temperature
+}
+
+// coolestFirst is a heap of the hottest devices seen so far, with the coolest of them on top
+type coolestFirst []rankedDevice
+
+func (h coolestFirst) Len() int           { return len(h) }
+func (h coolestFirst) Less(i, j int) bool { return hotter(h[j], h[i]) }
+func (h coolestFirst) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *coolestFirst) Push(x any)        { *h = append(*h, x.(rankedDevice)) }
+func (h *coolestFirst) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// hottestDevices returns the top hottest devices, hottest first, or all of them when top is negative; a heap of top
+// devices keeps it at O(n log top)
+func hottestDevices(devices []rankedDevice, top int) []rankedDevice {
+	if top < 0 || top >= len(devices) {
+		sort.Slice(devices, func(i, j int) bool { return hotter(devices[i], devices[j]) })
+		return devices
+	}
+
+	h := make(coolestFirst, 0, top+1)
+	for _, device := range devices {
+		if len(h) < top {
+			heap.Push(&h, device)
+		} else if top > 0 && hotter(device, h[0]) {
+			h[0] = device
+			heap.Fix(&h, 0)
+		}
+	}
+	sort.Slice(h, func(i, j int) bool { return hotter(h[i], h[j]) })
+	return h
+}
+
+func (fs *fleetStoreImpl) GetReadings(log logging.Logger, deviceId int32, limit int) ([]models.DeviceReading, bool) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	device, ok := fs.devices[deviceId]
+	if !ok {
+		return nil, false
+	}
+
+	if limit < 1 || limit > len(device.history) {
+		limit = len(device.history)
+	}
+	readings := make([]models.DeviceReading, 0, limit)
+	for i := 1; i <= limit; i++ {
+		readings = append(readings, device.history[(device.next-i+len(device.history))%len(device.history)])
+	}
+	return readings, true
+}
@@ -0,0 +1,204 @@
+package fleet_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sarabrajsingh/restful-openapi/internal/fleet"
+	"github.com/sarabrajsingh/restful-openapi/internal/models"
+	"github.com/sarabrajsingh/restful-openapi/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a controllable time source for the fleet store
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestFleetStore_Summary(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	clock := &fakeClock{now: time.Date(2024, 7, 27, 14, 0, 0, 0, time.UTC)}
+	fs := fleet.NewFleetStoreWithClock(10*time.Minute, clock.Now)
+
+	// device 1 reports and then goes quiet
+	fs.RecordReading(mockLogger, &models.TempPostPayload{DeviceId: 1, Temperature: 99.0}, true)
+
+	clock.now = clock.now.Add(15 * time.Minute)
+	fs.RecordReading(mockLogger, &models.TempPostPayload{DeviceId: 2, Temperature: 95.5}, true)
+	fs.RecordReading(mockLogger, &models.TempPostPayload{DeviceId: 3, Temperature: 40.0}, false)
+	// device 3 cools down further, only the latest reading counts
+	fs.RecordReading(mockLogger, &models.TempPostPayload{DeviceId: 3, Temperature: 35.0}, false)
+
+	summary := fs.GetSummary(mockLogger, 5, 2, 1)
+
+	assert.Equal(t, 3, summary.TotalDevices)
+	assert.Equal(t, 1, summary.OvertempDevices)
+	assert.Equal(t, 1, summary.OfflineDevices)
+	assert.Equal(t, 5, summary.WindowMinutes)
+	assert.Equal(t, 3, summary.ReadingsInWindow)
+	assert.Equal(t, uint64(1), summary.MalformedPayloads)
+	assert.InDelta(t, 0.2, summary.MalformedRate, 1e-9)
+
+	// device 1 is the hottest but offline, so it is left out of the ranking
+	assert.Len(t, summary.HottestDevices, 2)
+	assert.Equal(t, int32(2), summary.HottestDevices[0].DeviceId)
+	assert.Equal(t, int32(3), summary.HottestDevices[1].DeviceId)
+
+	// a wider window picks up the first reading as well
+	summary = fs.GetSummary(mockLogger, 30, 10, 0)
+	assert.Equal(t, 4, summary.ReadingsInWindow)
+	assert.Len(t, summary.HottestDevices, 2)
+
+	// device 1 is ranked again once it reports
+	fs.RecordReading(mockLogger, &models.TempPostPayload{DeviceId: 1, Temperature: 99.0}, true)
+	summary = fs.GetSummary(mockLogger, 5, 1, 0)
+	assert.Equal(t, 0, summary.OfflineDevices)
+	if assert.Len(t, summary.HottestDevices, 1) {
+		assert.Equal(t, int32(1), summary.HottestDevices[0].DeviceId)
+	}
+}
+
+func TestFleetStore_WindowBounds(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	clock := &fakeClock{now: time.Date(2024, 7, 27, 14, 0, 0, 0, time.UTC)}
+	fs := fleet.NewFleetStoreWithClock(fleet.DefaultOfflineAfter, clock.Now)
+
+	fs.RecordReading(mockLogger, &models.TempPostPayload{DeviceId: 1, Temperature: 50.0}, false)
+
+	// once the ring wraps around, stale buckets must not be counted
+	clock.now = clock.now.Add(fleet.MaxWindowMinutes * time.Minute)
+	summary := fs.GetSummary(mockLogger, 1000, 5, 0)
+	assert.Equal(t, fleet.MaxWindowMinutes, summary.WindowMinutes)
+	assert.Equal(t, 0, summary.ReadingsInWindow)
+	assert.Equal(t, 0.0, summary.MalformedRate)
+}
+
+// TestFleetStore_Readings tests that the history of a device is listed newest first, and bounded by HistorySize
+func TestFleetStore_Readings(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	clock := &fakeClock{now: time.Date(2024, 7, 27, 14, 0, 0, 0, time.UTC)}
+	fs := fleet.NewFleetStoreWithClock(10*time.Minute, clock.Now)
+
+	_, ok := fs.GetReadings(mockLogger, 1, 10)
+	assert.False(t, ok)
+
+	for i := 0; i < fleet.HistorySize+5; i++ {
+		clock.now = clock.now.Add(time.Second)
+		fs.RecordReading(mockLogger, &models.TempPostPayload{DeviceId: 1, EpochMS: 1722089835, Temperature: float64(i)}, i >= 100)
+	}
+
+	readings, ok := fs.GetReadings(mockLogger, 1, 2)
+	assert.True(t, ok)
+	assert.Equal(t, []models.DeviceReading{
+		{Temperature: 104, Overtemp: true, RecordedAt: "2024-07-27T14:17:15Z", ReceivedAt: "2024-07-27T14:01:45Z"},
+		{Temperature: 103, Overtemp: true, RecordedAt: "2024-07-27T14:17:15Z", ReceivedAt: "2024-07-27T14:01:44Z"},
+	}, readings)
+
+	// the oldest readings were dropped
+	readings, _ = fs.GetReadings(mockLogger, 1, 0)
+	assert.Len(t, readings, fleet.HistorySize)
+	assert.Equal(t, float64(5), readings[fleet.HistorySize-1].Temperature)
+}
+
+// TestFleetStore_HistoryDevices tests that the least recently seen device loses its history once HistoryDevices
+// devices have one
+func TestFleetStore_HistoryDevices(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	clock := &fakeClock{now: time.Date(2024, 7, 27, 14, 0, 0, 0, time.UTC)}
+	fs := fleet.NewFleetStoreWithClock(10*time.Minute, clock.Now)
+
+	for deviceId := int32(1); deviceId <= fleet.HistoryDevices; deviceId++ {
+		fs.RecordReading(mockLogger, &models.TempPostPayload{DeviceId: deviceId, EpochMS: 1722089835, Temperature: 50}, false)
+	}
+	// device 1 reports again, so device 2 is now the least recently seen
+	fs.RecordReading(mockLogger, &models.TempPostPayload{DeviceId: 1, EpochMS: 1722089835, Temperature: 51}, false)
+	fs.RecordReading(mockLogger, &models.TempPostPayload{DeviceId: fleet.HistoryDevices + 1, EpochMS: 1722089835, Temperature: 50}, false)
+
+	readings, ok := fs.GetReadings(mockLogger, 2, 0)
+	assert.True(t, ok, "the device is still known")
+	assert.Empty(t, readings)
+	assert.NotNil(t, readings)
+
+	readings, _ = fs.GetReadings(mockLogger, 1, 0)
+	assert.Len(t, readings, 2)
+	readings, _ = fs.GetReadings(mockLogger, fleet.HistoryDevices+1, 0)
+	assert.Len(t, readings, 1)
+
+	// a device that reports again starts a new history
+	fs.RecordReading(mockLogger, &models.TempPostPayload{DeviceId: 2, EpochMS: 1722089835, Temperature: 52}, false)
+	readings, _ = fs.GetReadings(mockLogger, 2, 0)
+	assert.Equal(t, 52.0, readings[0].Temperature)
+	assert.Equal(t, fleet.HistoryDevices+1, fs.GetSummary(mockLogger, 1, 0, 0).TotalDevices)
+}
+
+// TestFleetStore_MaxDevices tests that the least recently seen device is forgotten once the store knows MaxDevices
+func TestFleetStore_MaxDevices(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	clock := &fakeClock{now: time.Date(2024, 7, 27, 14, 0, 0, 0, time.UTC)}
+	fs := fleet.NewFleetStoreWithClock(10*time.Minute, clock.Now)
+
+	for deviceId := int32(1); deviceId <= fleet.MaxDevices; deviceId++ {
+		fs.RecordReading(mockLogger, &models.TempPostPayload{DeviceId: deviceId, EpochMS: 1722089835, Temperature: 50}, false)
+	}
+	// device 1 reports again, so device 2 is now the least recently seen
+	fs.RecordReading(mockLogger, &models.TempPostPayload{DeviceId: 1, EpochMS: 1722089835, Temperature: 51}, false)
+	fs.RecordReading(mockLogger, &models.TempPostPayload{DeviceId: fleet.MaxDevices + 1, EpochMS: 1722089835, Temperature: 50}, false)
+
+	_, ok := fs.GetReadings(mockLogger, 2, 0)
+	assert.False(t, ok, "the least recently seen device is forgotten")
+	_, ok = fs.GetReadings(mockLogger, 1, 0)
+	assert.True(t, ok)
+	readings, ok := fs.GetReadings(mockLogger, fleet.MaxDevices+1, 0)
+	assert.True(t, ok)
+	assert.Len(t, readings, 1)
+	assert.Equal(t, fleet.MaxDevices, fs.GetSummary(mockLogger, 1, 0, 0).TotalDevices)
+}
+
+// TestFleetStore_HottestDevices tests that the top hottest devices come hottest first, the lower device id first
+// among equal temperatures, whatever top is
+func TestFleetStore_HottestDevices(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	clock := &fakeClock{now: time.Date(2024, 7, 27, 14, 0, 0, 0, time.UTC)}
+	fs := fleet.NewFleetStoreWithClock(10*time.Minute, clock.Now)
+
+	temperatures := map[int32]float64{1: 50, 2: 95, 3: 70, 4: 95, 5: 20, 6: 88}
+	for deviceId, temperature := range temperatures {
+		fs.RecordReading(mockLogger, &models.TempPostPayload{DeviceId: deviceId, EpochMS: 1722089835, Temperature: temperature}, temperature >= 90)
+	}
+
+	ids := func(top int) []int32 {
+		var ids []int32
+		for _, device := range fs.GetSummary(mockLogger, 5, top, 0).HottestDevices {
+			ids = append(ids, device.DeviceId)
+		}
+		return ids
+	}
+	assert.Equal(t, []int32{2, 4, 6}, ids(3))
+	assert.Equal(t, []int32{2}, ids(1))
+	assert.Equal(t, []int32{2, 4, 6, 3, 1, 5}, ids(6))
+	assert.Equal(t, []int32{2, 4, 6, 3, 1, 5}, ids(-1))
+	assert.Empty(t, ids(0))
+}
@@ -4,50 +4,101 @@ import (
 	"sync"
 
 	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+	"github.com/sarabrajsingh/restful-openapi/internal/models"
 )
 
-const MaxErrorBufferSize = 512
+// DefaultErrorBufferSize is the number of errors kept before the oldest ones are dropped
+const DefaultErrorBufferSize = 512
 
 type ErrorStore interface {
 	DeleteErrors(logging.Logger)
 	GetErrors(logging.Logger) []string
-	AddError(logging.Logger, string)
+	// GetErrorDetails returns the errors together with the id of the request that reported them
+	GetErrorDetails(logging.Logger) []models.ErrorDetail
+	// AddError stores an error message and the id of the request that reported it
+	AddError(logging.Logger, string, string)
+	// GetStats reports the size of the buffer and how often it overflowed
+	GetStats(logging.Logger) Stats
+}
+
+// Stats describes the error buffer for the metrics endpoint
+type Stats struct {
+	Size int
+	// Overflows counts the errors dropped because the buffer was full
+	Overflows int
+	// Added counts every error stored since the server started, including the ones dropped or cleared since
+	Added uint64
 }
 
 type errorStoreImpl struct {
-	errorBuffer []string
+	errorBuffer []models.ErrorDetail
+	overflows   int
+	added       uint64
+	size        int
 	mutex       *sync.Mutex
 }
 
 func NewErrorStore() ErrorStore {
+	return NewErrorStoreWithSize(DefaultErrorBufferSize)
+}
+
+// NewErrorStoreWithSize creates an ErrorStore keeping at most size errors
+func NewErrorStoreWithSize(size int) ErrorStore {
 	return &errorStoreImpl{
-		errorBuffer: make([]string, 0),
+		errorBuffer: make([]models.ErrorDetail, 0),
+		size:        size,
 		mutex:       &sync.Mutex{},
 	}
 }
 
-func (es *errorStoreImpl) AddError(log logging.Logger, errorMessage string) {
+func (es *errorStoreImpl) AddError(log logging.Logger, errorMessage string, requestId string) {
 	es.mutex.Lock()
 	defer es.mutex.Unlock()
 
-	if len(es.errorBuffer) >= MaxErrorBufferSize {
-		log.Printf("error buffer overflow; reset array")
+	if len(es.errorBuffer) >= es.size {
+		log.Warn("error buffer overflow; dropping the oldest error", "size", es.size)
 		es.errorBuffer = es.errorBuffer[1:]
+		es.overflows++
 	}
 
-	log.Printf("appending [%s] to errorBuffer", errorMessage)
-	es.errorBuffer = append(es.errorBuffer, errorMessage)
+	es.added++
+	log.Info("appending to errorBuffer", "error", errorMessage)
+	es.errorBuffer = append(es.errorBuffer, models.ErrorDetail{
+		Error:     errorMessage,
+		RequestId: requestId,
+	})
 }
 
 func (es *errorStoreImpl) GetErrors(log logging.Logger) []string {
 	es.mutex.Lock()
 	defer es.mutex.Unlock()
-	return append([]string{}, es.errorBuffer...)
+	errors := make([]string, 0, len(es.errorBuffer))
+	for _, detail := range es.errorBuffer {
+		errors = append(errors, detail.Error)
+	}
+	return errors
+}
+
+func (es *errorStoreImpl) GetErrorDetails(log logging.Logger) []models.ErrorDetail {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	return append([]models.ErrorDetail{}, es.errorBuffer...)
 }
 
 func (es *errorStoreImpl) DeleteErrors(log logging.Logger) {
 	es.mutex.Lock()
 	defer es.mutex.Unlock()
-	es.errorBuffer = make([]string, 0)
-	log.Printf("Successfully cleared the errors buffer")
+	cleared := len(es.errorBuffer)
+	es.errorBuffer = make([]models.ErrorDetail, 0)
+	log.Info("Successfully cleared the errors buffer", "cleared", cleared)
+}
+
+func (es *errorStoreImpl) GetStats(log logging.Logger) Stats {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	return Stats{
+		Size:      len(es.errorBuffer),
+		Overflows: es.overflows,
+		Added:     es.added,
+	}
 }
@@ -1,10 +1,15 @@
 package global_errors_test
 
 import (
+	"fmt"
+	"io"
+	"log/slog"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/sarabrajsingh/restful-openapi/internal/global_errors"
+	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+	"github.com/sarabrajsingh/restful-openapi/internal/models"
 	"github.com/sarabrajsingh/restful-openapi/mocks"
 	"github.com/stretchr/testify/assert"
 )
@@ -16,12 +21,12 @@ func TestErrorStore_AddError(t *testing.T) {
 	mockLogger := mocks.NewMockLogger(ctrl)
 	es := global_errors.NewErrorStore()
 
-	// Expect log calls with formatted strings
-	mockLogger.EXPECT().Printf("appending [%s] to errorBuffer", "Error 1").Times(1)
-	mockLogger.EXPECT().Printf("appending [%s] to errorBuffer", "Error 2").Times(1)
+	// Expect structured log calls carrying the error message
+	mockLogger.EXPECT().Info("appending to errorBuffer", "error", "Error 1").Times(1)
+	mockLogger.EXPECT().Info("appending to errorBuffer", "error", "Error 2").Times(1)
 
-	es.AddError(mockLogger, "Error 1")
-	es.AddError(mockLogger, "Error 2")
+	es.AddError(mockLogger, "Error 1", "req-1")
+	es.AddError(mockLogger, "Error 2", "req-1")
 
 	// Check the buffer content
 	errors := es.GetErrors(mockLogger)
@@ -37,12 +42,12 @@ func TestErrorStore_DeleteErrors(t *testing.T) {
 	mockLogger := mocks.NewMockLogger(ctrl)
 	es := global_errors.NewErrorStore()
 
-	mockLogger.EXPECT().Printf("appending [%s] to errorBuffer", "Error 1").Times(1)
+	mockLogger.EXPECT().Info("appending to errorBuffer", "error", "Error 1").Times(1)
 	// Add some errors
-	es.AddError(mockLogger, "Error 1")
+	es.AddError(mockLogger, "Error 1", "req-1")
 
 	// Expect log call for deletion
-	mockLogger.EXPECT().Printf("Successfully cleared the errors buffer").Times(1)
+	mockLogger.EXPECT().Info("Successfully cleared the errors buffer", "cleared", 1).Times(1)
 
 	// Clear the errors
 	es.DeleteErrors(mockLogger)
@@ -60,18 +65,63 @@ func TestErrorStore_BufferOverflow(t *testing.T) {
 	es := global_errors.NewErrorStore()
 
 	// Expect multiple adds to fill the buffer and one additional to trigger overflow
-	for i := 0; i < global_errors.MaxErrorBufferSize; i++ {
-		mockLogger.EXPECT().Printf("appending [%s] to errorBuffer", "Error").Times(1)
-		es.AddError(mockLogger, "Error")
+	for i := 0; i < global_errors.DefaultErrorBufferSize; i++ {
+		mockLogger.EXPECT().Info("appending to errorBuffer", "error", "Error").Times(1)
+		es.AddError(mockLogger, "Error", "req-1")
 	}
 
 	// The last overflow error
-	mockLogger.EXPECT().Printf("appending [%s] to errorBuffer", "Overflow Error").Times(1)
-	mockLogger.EXPECT().Printf("error buffer overflow; reset array").Times(1)
-	es.AddError(mockLogger, "Overflow Error")
+	mockLogger.EXPECT().Info("appending to errorBuffer", "error", "Overflow Error").Times(1)
+	mockLogger.EXPECT().Warn("error buffer overflow; dropping the oldest error", "size", global_errors.DefaultErrorBufferSize).Times(1)
+	es.AddError(mockLogger, "Overflow Error", "req-1")
 
 	// Check the buffer content
 	errors := es.GetErrors(mockLogger)
-	assert.Len(t, errors, global_errors.MaxErrorBufferSize)
-	assert.Equal(t, "Overflow Error", errors[global_errors.MaxErrorBufferSize-1])
+	assert.Len(t, errors, global_errors.DefaultErrorBufferSize)
+	assert.Equal(t, "Overflow Error", errors[global_errors.DefaultErrorBufferSize-1])
+	assert.Equal(t, global_errors.Stats{Size: global_errors.DefaultErrorBufferSize, Overflows: 1, Added: global_errors.DefaultErrorBufferSize + 1}, es.GetStats(mockLogger))
+}
+
+func TestErrorStore_GetErrorDetails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	es := global_errors.NewErrorStore()
+
+	es.AddError(mockLogger, "Error 1", "req-1")
+	es.AddError(mockLogger, "Error 2", "")
+
+	details := es.GetErrorDetails(mockLogger)
+	assert.Equal(t, []models.ErrorDetail{
+		{Error: "Error 1", RequestId: "req-1"},
+		{Error: "Error 2"},
+	}, details)
+}
+
+// BenchmarkErrorStore_AddError measures the lock of the store under contention, with the buffer full so that every
+// error drops the oldest one, as it does while a gateway sends garbage
+func BenchmarkErrorStore_AddError(b *testing.B) {
+	logger, err := logging.NewLogger(io.Discard, logging.FormatText, slog.LevelInfo)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, parallelism := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("goroutines=%dxGOMAXPROCS", parallelism), func(b *testing.B) {
+			es := global_errors.NewErrorStore()
+			for i := 0; i < global_errors.DefaultErrorBufferSize; i++ {
+				es.AddError(logger, "foobar", "req-0")
+			}
+
+			b.SetParallelism(parallelism)
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					es.AddError(logger, "365951380:1640995229697:'Temperature':hot", "req-1")
+				}
+			})
+		})
+	}
 }
@@ -10,34 +10,92 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/gorilla/mux"
+	"github.com/sarabrajsingh/restful-openapi/internal/auth"
+	"github.com/sarabrajsingh/restful-openapi/internal/health"
 	"github.com/sarabrajsingh/restful-openapi/internal/logging"
 	"github.com/sarabrajsingh/restful-openapi/internal/models"
+	"github.com/sarabrajsingh/restful-openapi/internal/problem"
+	"github.com/sarabrajsingh/restful-openapi/internal/requestid"
+	"github.com/sarabrajsingh/restful-openapi/internal/tracing"
 	"github.com/sarabrajsingh/restful-openapi/internal/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
+// parseFailureCodes tells the clients why PayloadParserHelper rejected their reading
+var parseFailureCodes = map[string]string{
+	utils.ParseReasonArguments:      problem.CodeInvalidArgumentCount,
+	utils.ParseReasonDeviceId:       problem.CodeInvalidDeviceId,
+	utils.ParseReasonEpoch:          problem.CodeInvalidEpoch,
+	utils.ParseReasonTemperatureKey: problem.CodeInvalidTemperatureKey,
+	utils.ParseReasonTemperature:    problem.CodeInvalidTemperature,
+}
+
+// writeProblem answers with the problem of code, whose detail is also the error of the legacy shape
+func writeProblem(w http.ResponseWriter, r *http.Request, code, detail string) {
+	problem.Write(w, r, problem.New(code, detail), detail)
+}
+
+func writeInvalidParameter(w http.ResponseWriter, r *http.Request, name, detail string) {
+	p := problem.New(problem.CodeInvalidParameter, detail)
+	p.Errors = []models.ValidationError{{In: "query", Parameter: name, Detail: detail}}
+	problem.Write(w, r, p, detail)
+}
+
 func DeleteErrors(log logging.Logger, deleteErrors func(logging.Logger)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context(), log)
+
+		_, span := tracing.Tracer().Start(r.Context(), "ErrorStore.DeleteErrors")
 		deleteErrors(log)
+		span.End()
 
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
-func GetErrors(log logging.Logger, getErrors func(logging.Logger) []string) http.HandlerFunc {
+// DeleteErrorsV2 clears the error buffer like DeleteErrors, but answers 204 since there is nothing to send back
+func DeleteErrorsV2(log logging.Logger, deleteErrors func(logging.Logger)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context(), log)
+
+		_, span := tracing.Tracer().Start(r.Context(), "ErrorStore.DeleteErrors")
+		deleteErrors(log)
+		span.End()
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func GetErrors(log logging.Logger, getErrorDetails func(logging.Logger) []models.ErrorDetail) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context(), log)
+
 		var response models.GetErrorsResponse
 
-		l_errors := getErrors(log)
+		_, span := tracing.Tracer().Start(r.Context(), "ErrorStore.GetErrorDetails")
+		details := getErrorDetails(log)
+		span.End()
 
-		response.Errors = l_errors
+		response.Errors = make([]string, 0, len(details))
+		for _, detail := range details {
+			response.Errors = append(response.Errors, detail.Error)
+		}
+		response.Details = details
 
 		responseJSON, err := json.Marshal(response)
 		if err != nil {
-			utils.WriteErrorResponse(w, "Failed to encode response to JSON", http.StatusInternalServerError)
+			writeProblem(w, r, problem.CodeInternal, "Failed to encode response to JSON")
 			return
 		}
 
@@ -47,46 +105,349 @@ func GetErrors(log logging.Logger, getErrors func(logging.Logger) []string) http
 	}
 }
 
-func TempPost(log logging.Logger, addErrorFunc func(logging.Logger, string), bodyReader utils.BodyReaderFunc) http.HandlerFunc {
+// GetErrorsV2 lists the errors along with the request that reported them, without the bare strings of GetErrors
+func GetErrorsV2(log logging.Logger, getErrorDetails func(logging.Logger) []models.ErrorDetail) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var payload models.TempPostBody
+		log := logging.FromContext(r.Context(), log)
+
+		_, span := tracing.Tracer().Start(r.Context(), "ErrorStore.GetErrorDetails")
+		response := models.ErrorList{Errors: getErrorDetails(log)}
+		span.End()
 
-		body, err := bodyReader(r.Body)
+		// an empty buffer is listed as [], as the contract requires
+		if response.Errors == nil {
+			response.Errors = []models.ErrorDetail{}
+		}
+
+		responseJSON, err := json.Marshal(response)
 		if err != nil {
-			utils.WriteErrorResponse(w, "Failed to parse request body", http.StatusBadRequest)
+			writeProblem(w, r, problem.CodeInternal, "Failed to encode response to JSON")
 			return
 		}
 
-		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseJSON)
+	}
+}
 
-		if err := json.Unmarshal(body, &payload); err != nil {
-			utils.WriteErrorResponse(w, "Failed to parse JSON", http.StatusBadRequest)
+func TempPost(log logging.Logger, threshold float64, addErrorFunc func(logging.Logger, string, string), recordReadingFunc func(logging.Logger, *models.TempPostPayload, bool), recordParseFailureFunc func(string), bodyReader utils.BodyReaderFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// every log line and stored error carries the id of the request
+		log := logging.FromContext(r.Context(), log)
+
+		actual, ok := readReading(w, r, log, addErrorFunc, recordParseFailureFunc, bodyReader)
+		if !ok {
 			return
 		}
 
-		// if we get a malformed data string, log the error to the server logs
-		// add the data string to the global errors variable
-		actual, err := utils.PayloadParserHelper(payload.Data)
+		var overtemp models.TempPostGoodResponseWithOverTemp
+
+		_, span := tracing.Tracer().Start(r.Context(), "TemperatureHelper")
+		utils.TemperatureHelper(actual, threshold, &overtemp)
+		span.SetAttributes(attribute.Int("device_id", int(actual.DeviceId)), attribute.Bool("overtemp", overtemp.Overtemp))
+		span.End()
+
+		// keep the in-process fleet state up to date with every good reading
+		recordReadingFunc(log, actual, overtemp.Overtemp)
+
+		// the contract answers with one of two shapes, the one of a reading below the threshold only holding overtemp
+		var response interface{} = models.TempPostGoodResponseWithNoOverTemp{Overtemp: false}
+		if overtemp.Overtemp {
+			response = overtemp
+		}
+
+		responseJSON, err := json.Marshal(response)
 		if err != nil {
-			log.Println("POST /api/v1/temp - Malformed data string received. Error: ", err.Error())
-			addErrorFunc(log, payload.Data)
-			utils.WriteErrorResponse(w, "bad request", http.StatusBadRequest)
+			writeProblem(w, r, problem.CodeInternal, "Failed to encode response to JSON")
 			return
 		}
 
-		var response models.TempPostResponse
+		// if we're at this point in the codebase then we can return a valid response with a 200 OK
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseJSON)
+	}
+}
 
-		utils.TemperatureHelper(actual, &response)
+// TempPostV2 ingests a reading like TempPost, but answers with the same shape whether or not it is over the threshold
+func TempPostV2(log logging.Logger, threshold float64, addErrorFunc func(logging.Logger, string, string), recordReadingFunc func(logging.Logger, *models.TempPostPayload, bool), recordParseFailureFunc func(string), bodyReader utils.BodyReaderFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context(), log)
+
+		actual, ok := readReading(w, r, log, addErrorFunc, recordParseFailureFunc, bodyReader)
+		if !ok {
+			return
+		}
+
+		response := models.TempReading{
+			DeviceId:    actual.DeviceId,
+			Temperature: actual.Temperature,
+			Overtemp:    actual.Temperature >= threshold,
+			RecordedAt:  utils.ReadingTime(actual.EpochMS).Format(time.RFC3339),
+		}
+		recordReadingFunc(log, actual, response.Overtemp)
 
 		responseJSON, err := json.Marshal(response)
 		if err != nil {
-			utils.WriteErrorResponse(w, "Failed to encode response to JSON", http.StatusInternalServerError)
+			writeProblem(w, r, problem.CodeInternal, "Failed to encode response to JSON")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseJSON)
+	}
+}
+
+// readReading parses the reading of a device out of the body; when it fails the request has been answered and the
+// malformed data string, if any, stored
+func readReading(w http.ResponseWriter, r *http.Request, log logging.Logger, addErrorFunc func(logging.Logger, string, string), recordParseFailureFunc func(string), bodyReader utils.BodyReaderFunc) (*models.TempPostPayload, bool) {
+	var payload models.TempPostBody
+
+	body, err := bodyReader(r.Body)
+	if err != nil {
+		recordParseFailureFunc(utils.ParseReasonBody)
+		writeProblem(w, r, problem.CodeUnreadableBody, "Failed to parse request body")
+		return nil, false
+	}
+
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, &payload); err != nil {
+		recordParseFailureFunc(utils.ParseReasonJSON)
+		writeProblem(w, r, problem.CodeInvalidJSON, "Failed to parse JSON")
+		return nil, false
+	}
+
+	// if we get a malformed data string, log the error to the server logs
+	// add the data string to the global errors variable
+	_, span := tracing.Tracer().Start(r.Context(), "PayloadParserHelper")
+	actual, err := utils.PayloadParserHelper(payload.Data)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+
+	if err != nil {
+		log.Warn("Malformed data string received", "route", "POST "+r.URL.Path, "data", payload.Data, "error", err.Error())
+		_, span := tracing.Tracer().Start(r.Context(), "ErrorStore.AddError")
+		addErrorFunc(log, payload.Data, requestid.FromContext(r.Context()))
+		span.End()
+		code := problem.CodeInvalidRequest
+		var parseError *utils.ParseError
+		if errors.As(err, &parseError) {
+			recordParseFailureFunc(parseError.Reason)
+			code = parseFailureCodes[parseError.Reason]
+		}
+		// the legacy shape never told the failures apart
+		problem.Write(w, r, problem.New(code, err.Error()), "bad request")
+		return nil, false
+	}
+
+	// a device holding a client certificate may only report for itself
+	if err := auth.CheckDevice(r.Context(), actual.DeviceId); err != nil {
+		log.Warn("Rejected reading", "route", "POST "+r.URL.Path, "device_id", actual.DeviceId, "error", err.Error())
+		writeProblem(w, r, problem.CodeDeviceMismatch, err.Error())
+		return nil, false
+	}
+	return actual, true
+}
+
+const (
+	defaultFleetWindowMinutes = 5
+	defaultFleetTopDevices    = 5
+)
+
+func FleetSummary(log logging.Logger, getSummary func(logging.Logger, int, int) models.FleetSummaryResponse) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context(), log)
+
+		// the OpenAPI middleware has already enforced the bounds on these parameters
+		windowMinutes := defaultFleetWindowMinutes
+		if value := r.URL.Query().Get("window_minutes"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				writeInvalidParameter(w, r, "window_minutes", "window_minutes must be an integer")
+				return
+			}
+			windowMinutes = parsed
+		}
+
+		top := defaultFleetTopDevices
+		if value := r.URL.Query().Get("top"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				writeInvalidParameter(w, r, "top", "top must be an integer")
+				return
+			}
+			top = parsed
+		}
+
+		response := getSummary(log, windowMinutes, top)
+
+		responseJSON, err := json.Marshal(response)
+		if err != nil {
+			writeProblem(w, r, problem.CodeInternal, "Failed to encode response to JSON")
 			return
 		}
 
-		// if we're at this point in the codebase then we can return a valid response with a 200 OK
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 		w.WriteHeader(http.StatusOK)
 		w.Write(responseJSON)
 	}
 }
+
+const defaultDeviceReadings = 20
+
+// DeviceReadings lists the last readings of the device in the path
+func DeviceReadings(log logging.Logger, getReadings func(logging.Logger, int32, int) ([]models.DeviceReading, bool)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context(), log)
+
+		// the OpenAPI middleware has already enforced the format and the bounds of these parameters
+		deviceId, err := strconv.ParseInt(mux.Vars(r)["device_id"], 10, 32)
+		if err != nil {
+			p := problem.New(problem.CodeInvalidParameter, "device_id must be an int32")
+			p.Errors = []models.ValidationError{{In: "path", Parameter: "device_id", Detail: "device_id must be an int32"}}
+			problem.Write(w, r, p, "device_id must be an int32")
+			return
+		}
+
+		limit := defaultDeviceReadings
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				writeInvalidParameter(w, r, "limit", "limit must be an integer")
+				return
+			}
+			limit = parsed
+		}
+
+		readings, ok := getReadings(log, int32(deviceId), limit)
+		if !ok {
+			writeProblem(w, r, problem.CodeUnknownDevice, fmt.Sprintf("device %d has not reported since the server started", deviceId))
+			return
+		}
+
+		responseJSON, err := json.Marshal(models.DeviceReadingsResponse{DeviceId: int32(deviceId), Readings: readings})
+		if err != nil {
+			writeProblem(w, r, problem.CodeInternal, "Failed to encode response to JSON")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseJSON)
+	}
+}
+
+func GetAudit(log logging.Logger, getEntries func(logging.Logger, models.AuditQuery) []models.AuditEntry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context(), log)
+
+		query := models.AuditQuery{
+			Action: r.URL.Query().Get("action"),
+			Actor:  r.URL.Query().Get("actor"),
+			Limit:  100,
+		}
+
+		if value := r.URL.Query().Get("since"); value != "" {
+			since, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				writeInvalidParameter(w, r, "since", "since must be an RFC 3339 timestamp")
+				return
+			}
+			query.Since = since
+		}
+
+		if value := r.URL.Query().Get("limit"); value != "" {
+			limit, err := strconv.Atoi(value)
+			if err != nil {
+				writeInvalidParameter(w, r, "limit", "limit must be an integer")
+				return
+			}
+			query.Limit = limit
+		}
+
+		response := models.GetAuditResponse{
+			Entries: getEntries(log, query),
+		}
+
+		responseJSON, err := json.Marshal(response)
+		if err != nil {
+			writeProblem(w, r, problem.CodeInternal, "Failed to encode response to JSON")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseJSON)
+	}
+}
+
+// GetVersion reports which configuration and contract are active, and how the last reload went
+func GetVersion(log logging.Logger, getVersion func() models.VersionResponse) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseJSON, err := json.Marshal(getVersion())
+		if err != nil {
+			writeProblem(w, r, problem.CodeInternal, "Failed to encode response to JSON")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseJSON)
+	}
+}
+
+// Healthz answers the liveness probe as long as the server is able to serve requests
+func Healthz(log logging.Logger, getLiveness func() models.HealthResponse) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHealthResponse(w, r, getLiveness())
+	}
+}
+
+// Readyz answers the readiness probe, with the status of every check when verbose=true is passed; the errors of the
+// failed checks are only logged, since anyone may call the probe
+func Readyz(log logging.Logger, getReadiness func(context.Context) models.HealthResponse) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context(), log)
+
+		ctx, span := tracing.Tracer().Start(r.Context(), "Health.Readiness")
+		response := getReadiness(ctx)
+		span.End()
+
+		if response.Status != health.StatusOK {
+			log.Warn("readiness check failed", "checks", response.Checks)
+		}
+		writeHealthResponse(w, r, response)
+	}
+}
+
+func writeHealthResponse(w http.ResponseWriter, r *http.Request, response models.HealthResponse) {
+	if verbose, _ := strconv.ParseBool(r.URL.Query().Get("verbose")); !verbose {
+		response.Checks = nil
+	}
+	// an error may name a file or a host of the server, which is no business of an anonymous caller
+	for name, check := range response.Checks {
+		response.Checks[name] = models.HealthCheck{Status: check.Status}
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		writeProblem(w, r, problem.CodeInternal, "Failed to encode response to JSON")
+		return
+	}
+
+	status := http.StatusOK
+	if response.Status != health.StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(responseJSON)
+}
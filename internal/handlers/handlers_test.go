@@ -1,6 +1,7 @@
 package handlers_test
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
@@ -8,11 +9,15 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/sarabrajsingh/restful-openapi/internal/handlers"
+	"github.com/sarabrajsingh/restful-openapi/internal/health"
 	"github.com/sarabrajsingh/restful-openapi/internal/logging"
 	"github.com/sarabrajsingh/restful-openapi/internal/models"
+	"github.com/sarabrajsingh/restful-openapi/internal/problem"
+	"github.com/sarabrajsingh/restful-openapi/internal/requestid"
 	"github.com/sarabrajsingh/restful-openapi/internal/utils"
 	"github.com/sarabrajsingh/restful-openapi/mocks"
 	"github.com/stretchr/testify/assert"
@@ -26,14 +31,14 @@ func TestGetErrors(t *testing.T) {
 
 	testCases := []struct {
 		description      string
-		mockGetErrors    func(logging.Logger) []string
+		mockGetErrors    func(logging.Logger) []models.ErrorDetail
 		expectedStatus   int
 		expectedResponse models.GetErrorsResponse
 	}{
 		{
 			description: "No errors",
-			mockGetErrors: func(log logging.Logger) []string {
-				return []string{}
+			mockGetErrors: func(log logging.Logger) []models.ErrorDetail {
+				return []models.ErrorDetail{}
 			},
 			expectedStatus: http.StatusOK,
 			expectedResponse: models.GetErrorsResponse{
@@ -42,8 +47,8 @@ func TestGetErrors(t *testing.T) {
 		},
 		{
 			description: "One error",
-			mockGetErrors: func(log logging.Logger) []string {
-				return []string{"error1"}
+			mockGetErrors: func(log logging.Logger) []models.ErrorDetail {
+				return []models.ErrorDetail{{Error: "error1", RequestId: "req-1"}}
 			},
 			expectedStatus: http.StatusOK,
 			expectedResponse: models.GetErrorsResponse{
@@ -52,8 +57,8 @@ func TestGetErrors(t *testing.T) {
 		},
 		{
 			description: "Multiple errors",
-			mockGetErrors: func(log logging.Logger) []string {
-				return []string{"error1", "error2"}
+			mockGetErrors: func(log logging.Logger) []models.ErrorDetail {
+				return []models.ErrorDetail{{Error: "error1", RequestId: "req-1"}, {Error: "error2", RequestId: "req-2"}}
 			},
 			expectedStatus: http.StatusOK,
 			expectedResponse: models.GetErrorsResponse{
@@ -91,11 +96,43 @@ func TestGetErrors(t *testing.T) {
 				if errorStr != tc.expectedResponse.Errors[i] {
 					t.Errorf("Expected Error at index %d: %v, got: %v", i, tc.expectedResponse.Errors[i], errorStr)
 				}
+				if actualResponse.Details[i].Error != errorStr || actualResponse.Details[i].RequestId == "" {
+					t.Errorf("Expected Detail at index %d to carry %v and its request id, got: %+v", i, errorStr, actualResponse.Details[i])
+				}
 			}
 		})
 	}
 }
 
+// TestGetErrorsV2 tests that v2 lists the errors with their request ids, and an empty buffer as an empty list
+func TestGetErrorsV2(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+
+	testCases := []struct {
+		description  string
+		details      []models.ErrorDetail
+		expectedBody string
+	}{
+		{"No errors", nil, `{"errors":[]}`},
+		{"One error", []models.ErrorDetail{{Error: "error1", RequestId: "req-1"}}, `{"errors":[{"error":"error1","request_id":"req-1"}]}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			handler := handlers.GetErrorsV2(mockLogger, func(logging.Logger) []models.ErrorDetail { return tc.details })
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/v2/errors", nil))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
 func TestDeleteErrors(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -140,42 +177,55 @@ func TestTempPostHappyPath(t *testing.T) {
 	testCases := []struct {
 		description      string
 		requestBody      string
-		mockAddErrorFunc func(logging.Logger, string)
+		mockAddErrorFunc func(logging.Logger, string, string)
 		expectedStatus   int
-		expectedResponse models.TempPostResponse
+		expectedResponse models.TempPostGoodResponseWithOverTemp
+		expectedBody     string
 	}{
 		{
 			description:      "Valid request; Overtemp",
 			requestBody:      `{"data":"1234:1721964434:'Temperature':95.0"}`,
-			mockAddErrorFunc: func(log logging.Logger, data string) {},
+			mockAddErrorFunc: func(log logging.Logger, data string, requestId string) {},
 			expectedStatus:   http.StatusOK,
-			expectedResponse: models.TempPostResponse{
+			expectedResponse: models.TempPostGoodResponseWithOverTemp{
 				DeviceId:      1234,
 				Overtemp:      true,
 				FormattedTime: "2024/07/25 23:27:14",
 			},
+			expectedBody: `{"overtemp":true,"device_id":1234,"formatted_time":"2024/07/25 23:27:14"}`,
 		},
 		{
 			description:      "Valid request; Not Overtemp",
 			requestBody:      `{"data":"1234:1721964434:'Temperature':89.9"}`,
-			mockAddErrorFunc: func(log logging.Logger, data string) {},
+			mockAddErrorFunc: func(log logging.Logger, data string, requestId string) {},
 			expectedStatus:   http.StatusOK,
-			expectedResponse: models.TempPostResponse{
+			expectedResponse: models.TempPostGoodResponseWithOverTemp{
 				Overtemp: false,
 			},
+			expectedBody: `{"overtemp":false}`,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.description, func(t *testing.T) {
 			mockLogger := mocks.NewMockLogger(ctrl)
-			mockLogger.EXPECT().Println(gomock.Any()).AnyTimes()
+			mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
 
 			bodyReader := func(r io.Reader) ([]byte, error) {
 				return io.ReadAll(r)
 			}
 
-			handler := handlers.TempPost(mockLogger, tc.mockAddErrorFunc, bodyReader)
+			var recorded *models.TempPostPayload
+			recordReading := func(log logging.Logger, reading *models.TempPostPayload, overtemp bool) {
+				recorded = reading
+				assert.Equal(t, tc.expectedResponse.Overtemp, overtemp)
+			}
+
+			recordParseFailure := func(reason string) {
+				t.Errorf("unexpected parse failure recorded for a good request: %s", reason)
+			}
+
+			handler := handlers.TempPost(mockLogger, utils.DefaultOvertempThreshold, tc.mockAddErrorFunc, recordReading, recordParseFailure, bodyReader)
 
 			req, err := http.NewRequest("POST", "/api/v1/temp", strings.NewReader(tc.requestBody))
 			if err != nil {
@@ -189,7 +239,9 @@ func TestTempPostHappyPath(t *testing.T) {
 				t.Errorf("Handler returned wrong status code: got %v want %v", status, tc.expectedStatus)
 			}
 
-			var actualResponse models.TempPostResponse
+			assert.JSONEq(t, tc.expectedBody, w.Body.String())
+
+			var actualResponse models.TempPostGoodResponseWithOverTemp
 
 			if err := json.NewDecoder(w.Body).Decode(&actualResponse); err != nil {
 				t.Fatalf("Failed to decode response: %v", err)
@@ -197,6 +249,8 @@ func TestTempPostHappyPath(t *testing.T) {
 
 			assert.NotNil(t, actualResponse)
 			assert.Equal(t, actualResponse, tc.expectedResponse)
+			assert.NotNil(t, recorded)
+			assert.Equal(t, int32(1234), recorded.DeviceId)
 		})
 	}
 }
@@ -208,14 +262,15 @@ func TestTempPostUnhappyPath(t *testing.T) {
 	testCases := []struct {
 		description      string
 		requestBody      string
-		mockAddErrorFunc func(logging.Logger, string)
+		mockAddErrorFunc func(logging.Logger, string, string)
 		expectedStatus   int
 		expectedResponse models.Response400
+		expectedReason   string
 		bodyReader       utils.BodyReaderFunc
 	}{
 		{
 			description:      "Bad Request; malformed JSON request payload",
-			mockAddErrorFunc: func(log logging.Logger, data string) {},
+			mockAddErrorFunc: func(log logging.Logger, data string, requestId string) {},
 			expectedStatus:   http.StatusBadRequest,
 			bodyReader: func(io.Reader) ([]byte, error) {
 				return nil, errors.New("foobar error")
@@ -223,11 +278,12 @@ func TestTempPostUnhappyPath(t *testing.T) {
 			expectedResponse: models.Response400{
 				Error: "Failed to parse request body",
 			},
+			expectedReason: utils.ParseReasonBody,
 		},
 		{
 			description:      "Bad Request; unable to unmarshal JSON payload",
 			requestBody:      `{"data":}`,
-			mockAddErrorFunc: func(log logging.Logger, data string) {},
+			mockAddErrorFunc: func(log logging.Logger, data string, requestId string) {},
 			expectedStatus:   http.StatusBadRequest,
 			bodyReader: func(r io.Reader) ([]byte, error) {
 				return io.ReadAll(r)
@@ -235,11 +291,12 @@ func TestTempPostUnhappyPath(t *testing.T) {
 			expectedResponse: models.Response400{
 				Error: "Failed to parse JSON",
 			},
+			expectedReason: utils.ParseReasonJSON,
 		},
 		{
 			description:      "Bad Request; invalid fields in JSON payload",
 			requestBody:      `{"data":"abc:def:'Temperature':95.0"}`,
-			mockAddErrorFunc: func(log logging.Logger, data string) {},
+			mockAddErrorFunc: func(log logging.Logger, data string, requestId string) {},
 			expectedStatus:   http.StatusBadRequest,
 			bodyReader: func(r io.Reader) ([]byte, error) {
 				return io.ReadAll(r)
@@ -247,15 +304,25 @@ func TestTempPostUnhappyPath(t *testing.T) {
 			expectedResponse: models.Response400{
 				Error: "bad request",
 			},
+			expectedReason: utils.ParseReasonDeviceId,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.description, func(t *testing.T) {
 			mockLogger := mocks.NewMockLogger(ctrl)
-			mockLogger.EXPECT().Println(gomock.Any()).AnyTimes()
+			mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
 
-			handler := handlers.TempPost(mockLogger, tc.mockAddErrorFunc, tc.bodyReader)
+			recordReading := func(log logging.Logger, reading *models.TempPostPayload, overtemp bool) {
+				t.Errorf("unexpected reading recorded for a bad request: %+v", reading)
+			}
+
+			var reasons []string
+			recordParseFailure := func(reason string) {
+				reasons = append(reasons, reason)
+			}
+
+			handler := handlers.TempPost(mockLogger, utils.DefaultOvertempThreshold, tc.mockAddErrorFunc, recordReading, recordParseFailure, tc.bodyReader)
 
 			req, err := http.NewRequest("POST", "/api/v1/temp", strings.NewReader(tc.requestBody))
 			if err != nil {
@@ -277,6 +344,347 @@ func TestTempPostUnhappyPath(t *testing.T) {
 
 			assert.NotNil(t, actualResponse)
 			assert.Equal(t, actualResponse, tc.expectedResponse)
+			assert.Equal(t, []string{tc.expectedReason}, reasons)
+		})
+	}
+}
+
+// TestTempPostProblems tests that the clients asking for application/problem+json are told why a reading was refused
+func TestTempPostProblems(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testCases := []struct {
+		description      string
+		requestBody      string
+		expectedResponse models.Problem
+	}{
+		{"Unable to unmarshal JSON payload", `{"data":}`, problem.New(problem.CodeInvalidJSON, "Failed to parse JSON")},
+		{"Invalid device id", `{"data":"abc:def:'Temperature':95.0"}`, problem.New(problem.CodeInvalidDeviceId, "could not parse device_id=abc to an int32")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			mockLogger := mocks.NewMockLogger(ctrl)
+			mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+
+			recordReading := func(log logging.Logger, reading *models.TempPostPayload, overtemp bool) {
+				t.Errorf("unexpected reading recorded for a bad request: %+v", reading)
+			}
+			handler := handlers.TempPost(mockLogger, utils.DefaultOvertempThreshold, func(logging.Logger, string, string) {}, recordReading, func(string) {}, utils.DefaultBodyReader)
+
+			req, err := http.NewRequest("POST", "/api/v1/temp", strings.NewReader(tc.requestBody))
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			req.Header.Set("Accept", problem.ContentType)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			var actualResponse models.Problem
+			if err := json.NewDecoder(w.Body).Decode(&actualResponse); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			tc.expectedResponse.Instance = "/api/v1/temp"
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+			assert.Equal(t, tc.expectedResponse, actualResponse)
+		})
+	}
+}
+
+// TestTempPostV2 tests that v2 answers every reading with the same shape, reading the epochs above 10^11 as
+// milliseconds where the formatted_time of v1 reads them all as seconds
+func TestTempPostV2(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testCases := []struct {
+		description string
+		requestBody string
+		expectedV2  string
+		expectedV1  string
+	}{
+		{
+			description: "Epoch in seconds",
+			requestBody: `{"data":"1234:1722089835:'Temperature':95.5"}`,
+			expectedV2:  `{"device_id":1234,"temperature":95.5,"overtemp":true,"recorded_at":"2024-07-27T14:17:15Z"}`,
+			expectedV1:  `{"device_id":1234,"formatted_time":"2024/07/27 10:17:15","overtemp":true}`,
+		},
+		{
+			description: "Epoch in milliseconds",
+			requestBody: `{"data":"1234:1722089835697:'Temperature':95.5"}`,
+			expectedV2:  `{"device_id":1234,"temperature":95.5,"overtemp":true,"recorded_at":"2024-07-27T14:17:15Z"}`,
+			expectedV1:  `{"device_id":1234,"formatted_time":"56540/11/08 02:41:37","overtemp":true}`,
+		},
+		{
+			description: "Below the threshold",
+			requestBody: `{"data":"1234:1722089835:'Temperature':45.5"}`,
+			expectedV2:  `{"device_id":1234,"temperature":45.5,"overtemp":false,"recorded_at":"2024-07-27T14:17:15Z"}`,
+			expectedV1:  `{"overtemp":false}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			mockLogger := mocks.NewMockLogger(ctrl)
+			addError := func(logging.Logger, string, string) { t.Errorf("unexpected error stored for a good request") }
+			recordReading := func(logging.Logger, *models.TempPostPayload, bool) {}
+
+			for _, version := range []struct {
+				handler  http.HandlerFunc
+				path     string
+				expected string
+			}{
+				{handlers.TempPostV2(mockLogger, utils.DefaultOvertempThreshold, addError, recordReading, func(string) {}, utils.DefaultBodyReader), "/api/v2/temp", tc.expectedV2},
+				{handlers.TempPost(mockLogger, utils.DefaultOvertempThreshold, addError, recordReading, func(string) {}, utils.DefaultBodyReader), "/api/v1/temp", tc.expectedV1},
+			} {
+				req, err := http.NewRequest("POST", version.path, strings.NewReader(tc.requestBody))
+				if err != nil {
+					t.Fatalf("Failed to create request: %v", err)
+				}
+
+				w := httptest.NewRecorder()
+				version.handler.ServeHTTP(w, req)
+
+				assert.Equal(t, http.StatusOK, w.Code, version.path)
+				assert.JSONEq(t, version.expected, w.Body.String(), version.path)
+			}
+		})
+	}
+}
+
+func TestFleetSummary(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+
+	testCases := []struct {
+		description    string
+		query          string
+		expectedWindow int
+		expectedTop    int
+		expectedStatus int
+	}{
+		{
+			description:    "Defaults",
+			query:          "",
+			expectedWindow: 5,
+			expectedTop:    5,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "Explicit window and top",
+			query:          "?window_minutes=15&top=2",
+			expectedWindow: 15,
+			expectedTop:    2,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "Non-integer window",
+			query:          "?window_minutes=abc",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			getSummary := func(log logging.Logger, windowMinutes int, top int) models.FleetSummaryResponse {
+				assert.Equal(t, tc.expectedWindow, windowMinutes)
+				assert.Equal(t, tc.expectedTop, top)
+				return models.FleetSummaryResponse{
+					TotalDevices:   3,
+					WindowMinutes:  windowMinutes,
+					HottestDevices: []models.FleetDevice{{DeviceId: 1234, Temperature: 95.0, Overtemp: true}},
+				}
+			}
+
+			handler := handlers.FleetSummary(mockLogger, getSummary)
+
+			req, err := http.NewRequest("GET", "/api/v1/fleet/summary"+tc.query, nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var actualResponse models.FleetSummaryResponse
+			if err := json.NewDecoder(w.Body).Decode(&actualResponse); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			assert.Equal(t, 3, actualResponse.TotalDevices)
+			assert.Equal(t, tc.expectedWindow, actualResponse.WindowMinutes)
+			assert.Len(t, actualResponse.HottestDevices, 1)
+		})
+	}
+}
+
+func TestGetAudit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+
+	testCases := []struct {
+		description    string
+		query          string
+		expectedQuery  models.AuditQuery
+		expectedStatus int
+	}{
+		{
+			description:    "Default limit",
+			query:          "",
+			expectedQuery:  models.AuditQuery{Limit: 100},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description: "Filters",
+			query:       "?action=errors.delete&actor=apiKey:ops&since=2024-07-27T14:00:00Z&limit=5",
+			expectedQuery: models.AuditQuery{
+				Action: "errors.delete",
+				Actor:  "apiKey:ops",
+				Since:  time.Date(2024, 7, 27, 14, 0, 0, 0, time.UTC),
+				Limit:  5,
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "Malformed since",
+			query:          "?since=yesterday",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			getEntries := func(log logging.Logger, query models.AuditQuery) []models.AuditEntry {
+				assert.Equal(t, tc.expectedQuery, query)
+				return []models.AuditEntry{}
+			}
+
+			handler := handlers.GetAudit(mockLogger, getEntries)
+
+			req, err := http.NewRequest("GET", "/api/v1/audit"+tc.query, nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestTempPostRequestId(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	baseLogger := mocks.NewMockLogger(ctrl)
+	requestLogger := mocks.NewMockLogger(ctrl)
+	requestLogger.EXPECT().Warn("Malformed data string received", gomock.Any()).Times(1)
+
+	var storedRequestId string
+	var storedLogger logging.Logger
+	addError := func(log logging.Logger, data string, requestId string) {
+		storedLogger = log
+		storedRequestId = requestId
+	}
+	recordReading := func(log logging.Logger, reading *models.TempPostPayload, overtemp bool) {}
+
+	recordParseFailure := func(reason string) {}
+
+	handler := handlers.TempPost(baseLogger, utils.DefaultOvertempThreshold, addError, recordReading, recordParseFailure, utils.DefaultBodyReader)
+
+	req := httptest.NewRequest("POST", "/api/v1/temp", strings.NewReader(`{"data":"abc:def:'Temperature':95.0"}`))
+	ctx := requestid.NewContext(req.Context(), "req-42")
+	ctx = logging.NewContext(ctx, requestLogger)
+	req = req.WithContext(ctx)
+
+	w := httptest.NewRecorder()
+	w.Header().Set(requestid.Header, "req-42")
+	handler.ServeHTTP(w, req)
+
+	var actualResponse models.Response400
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&actualResponse))
+	assert.Equal(t, models.Response400{Error: "bad request", RequestId: "req-42"}, actualResponse)
+	assert.Equal(t, "req-42", storedRequestId)
+	assert.Equal(t, requestLogger, storedLogger)
+}
+
+func TestReadyz(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+
+	testCases := []struct {
+		description    string
+		query          string
+		readiness      models.HealthResponse
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			description: "Ready",
+			readiness: models.HealthResponse{
+				Status: health.StatusOK,
+				Checks: map[string]models.HealthCheck{"audit": {Status: health.StatusOK}},
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"ok"}`,
+		},
+		{
+			description: "Draining",
+			readiness: models.HealthResponse{
+				Status: health.StatusUnavailable,
+				Checks: map[string]models.HealthCheck{"draining": {Status: health.StatusUnavailable, Error: "server is draining"}},
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   `{"status":"unavailable"}`,
+		},
+		{
+			description: "Verbose",
+			query:       "?verbose=true",
+			readiness: models.HealthResponse{
+				Status: health.StatusUnavailable,
+				Checks: map[string]models.HealthCheck{"draining": {Status: health.StatusUnavailable, Error: "server is draining"}},
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   `{"status":"unavailable","checks":{"draining":{"status":"unavailable"}}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			getReadiness := func(ctx context.Context) models.HealthResponse {
+				return tc.readiness
+			}
+
+			handler := handlers.Readyz(mockLogger, getReadiness)
+
+			req, err := http.NewRequest("GET", "/readyz"+tc.query, nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			assert.JSONEq(t, tc.expectedBody, w.Body.String())
 		})
 	}
 }
@@ -0,0 +1,118 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/models"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+
+	// CheckTimeout bounds the time a readiness probe waits for a check
+	CheckTimeout = 2 * time.Second
+
+	SpecificationCheck = "specification"
+	DrainingCheck      = "draining"
+)
+
+// ErrDraining is reported once the server stops accepting new work
+var ErrDraining = errors.New("server is draining")
+
+// Check reports whether a dependency of the server is usable
+type Check func(context.Context) error
+
+type Health interface {
+	// AddCheck registers a check run on every readiness probe
+	AddCheck(name string, check Check)
+	// SetSpecification records whether the OpenAPI spec loaded and validated
+	SetSpecification(err error)
+	// StartDraining fails the readiness probe so that no new traffic is routed to the server
+	StartDraining()
+	// Liveness reports whether the process is serving requests at all
+	Liveness() models.HealthResponse
+	// Readiness runs every check and reports whether the server should receive traffic
+	Readiness(ctx context.Context) models.HealthResponse
+}
+
+type healthImpl struct {
+	checks        map[string]Check
+	specification error
+	draining      bool
+	mutex         *sync.Mutex
+}
+
+// NewHealth creates a Health that is not ready until the specification has been set
+func NewHealth() Health {
+	return &healthImpl{
+		checks:        make(map[string]Check),
+		specification: errors.New("specification not loaded yet"),
+		mutex:         &sync.Mutex{},
+	}
+}
+
+func (h *healthImpl) AddCheck(name string, check Check) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.checks[name] = check
+}
+
+func (h *healthImpl) SetSpecification(err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.specification = err
+}
+
+func (h *healthImpl) StartDraining() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.draining = true
+}
+
+func (h *healthImpl) Liveness() models.HealthResponse {
+	return models.HealthResponse{
+		Status: StatusOK,
+	}
+}
+
+func (h *healthImpl) Readiness(ctx context.Context) models.HealthResponse {
+	h.mutex.Lock()
+	results := map[string]error{
+		SpecificationCheck: h.specification,
+	}
+	if h.draining {
+		results[DrainingCheck] = ErrDraining
+	} else {
+		results[DrainingCheck] = nil
+	}
+	checks := make(map[string]Check, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	h.mutex.Unlock()
+
+	// the checks run outside of the lock, so a slow store doesn't hold up the other probes
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+	for name, check := range checks {
+		results[name] = check(ctx)
+	}
+
+	response := models.HealthResponse{
+		Status: StatusOK,
+		Checks: make(map[string]models.HealthCheck, len(results)),
+	}
+	for name, err := range results {
+		if err != nil {
+			response.Status = StatusUnavailable
+			response.Checks[name] = models.HealthCheck{Status: StatusUnavailable, Error: err.Error()}
+			continue
+		}
+		response.Checks[name] = models.HealthCheck{Status: StatusOK}
+	}
+	return response
+}
@@ -0,0 +1,46 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/health"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadiness(t *testing.T) {
+	h := health.NewHealth()
+
+	// not ready until the contract has been loaded
+	response := h.Readiness(context.Background())
+	assert.Equal(t, health.StatusUnavailable, response.Status)
+	assert.Equal(t, health.StatusUnavailable, response.Checks[health.SpecificationCheck].Status)
+
+	h.SetSpecification(nil)
+	reachable := true
+	h.AddCheck("audit", func(ctx context.Context) error {
+		if !reachable {
+			return errors.New("audit log is unreachable")
+		}
+		return nil
+	})
+
+	response = h.Readiness(context.Background())
+	assert.Equal(t, health.StatusOK, response.Status)
+	assert.Len(t, response.Checks, 3)
+
+	reachable = false
+	response = h.Readiness(context.Background())
+	assert.Equal(t, health.StatusUnavailable, response.Status)
+	assert.Equal(t, "audit log is unreachable", response.Checks["audit"].Error)
+
+	reachable = true
+	h.StartDraining()
+	response = h.Readiness(context.Background())
+	assert.Equal(t, health.StatusUnavailable, response.Status)
+	assert.Equal(t, health.ErrDraining.Error(), response.Checks[health.DrainingCheck].Error)
+
+	// still alive while draining
+	assert.Equal(t, health.StatusOK, h.Liveness().Status)
+}
@@ -0,0 +1,117 @@
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/utils"
+)
+
+// Mix is the share of the generated readings that are malformed, and the share of the well-formed ones that are
+// overtemp, both between 0 and 1
+type Mix struct {
+	Malformed float64
+	Overtemp  float64
+}
+
+// DefaultMix is close to what a fleet sends on a bad day
+var DefaultMix = Mix{Malformed: 0.05, Overtemp: 0.1}
+
+// Generator synthesizes the data strings of a fleet of simulated devices; it is not safe for concurrent use
+type Generator struct {
+	devices []device
+	mix     Mix
+	rand    *rand.Rand
+	now     func() time.Time
+}
+
+// device is a simulated device that drifts around its own baseline temperature
+type device struct {
+	id          int32
+	temperature float64
+}
+
+// the ways a data string is broken, one per reason of the parse failure metrics
+var malformers = []func(id int32, epoch int64, temperature float64) string{
+	// utils.ParseReasonArguments
+	func(id int32, epoch int64, temperature float64) string {
+		return fmt.Sprintf("%d:%d:%.2f", id, epoch, temperature)
+	},
+	// utils.ParseReasonDeviceId, larger than an int32
+	func(id int32, epoch int64, temperature float64) string {
+		return fmt.Sprintf("%d:%d:'Temperature':%.2f", int64(id)+1<<32, epoch, temperature)
+	},
+	// utils.ParseReasonEpoch
+	func(id int32, epoch int64, temperature float64) string {
+		return fmt.Sprintf("%d:%s:'Temperature':%.2f", id, time.UnixMilli(epoch).UTC().Format("2006-01-02T15.04.05"), temperature)
+	},
+	// utils.ParseReasonTemperatureKey
+	func(id int32, epoch int64, temperature float64) string {
+		return fmt.Sprintf("%d:%d:'Temp':%.2f", id, epoch, temperature)
+	},
+	// utils.ParseReasonTemperature
+	func(id int32, epoch int64, temperature float64) string {
+		return fmt.Sprintf("%d:%d:'Temperature':%.2fC", id, epoch, temperature)
+	},
+}
+
+// NewGenerator simulates a fleet of the given number of devices; the same seed generates the same device ids and
+// temperatures
+func NewGenerator(devices int, mix Mix, seed int64) *Generator {
+	return NewGeneratorWithClock(devices, mix, seed, time.Now)
+}
+
+// NewGeneratorWithClock creates a Generator with a custom time source for the epochs of the readings
+func NewGeneratorWithClock(devices int, mix Mix, seed int64, now func() time.Time) *Generator {
+	g := &Generator{
+		devices: make([]device, max(devices, 1)),
+		mix:     mix,
+		rand:    rand.New(rand.NewSource(seed)),
+		now:     now,
+	}
+	for i := range g.devices {
+		g.devices[i] = device{
+			id:          g.rand.Int31(),
+			temperature: 40 + g.rand.Float64()*35,
+		}
+	}
+	return g
+}
+
+// Next returns the data string of the next reading, from a device picked at random
+func (g *Generator) Next() string {
+	d := &g.devices[g.rand.Intn(len(g.devices))]
+	// the devices send milliseconds, as the sample payloads do
+	epoch := g.now().UnixMilli()
+
+	// a random walk that stays below the threshold, the overtemp readings being spikes above it
+	d.temperature = min(max(d.temperature+g.rand.NormFloat64(), 20), utils.DefaultOvertempThreshold-5)
+	temperature := d.temperature
+	if g.rand.Float64() < g.mix.Overtemp {
+		temperature = utils.DefaultOvertempThreshold + g.rand.Float64()*15
+	}
+
+	if g.rand.Float64() < g.mix.Malformed {
+		return malformers[g.rand.Intn(len(malformers))](d.id, epoch, temperature)
+	}
+	return strconv.Itoa(int(d.id)) + ":" + strconv.FormatInt(epoch, 10) + ":'Temperature':" + strconv.FormatFloat(temperature, 'f', -1, 64)
+}
+
+// Stream sends count readings, or readings until ctx is done when count is 0, and closes the channel
+func (g *Generator) Stream(ctx context.Context, count int) <-chan string {
+	readings := make(chan string)
+	go func() {
+		defer close(readings)
+		for n := 0; (count == 0 || n < count) && ctx.Err() == nil; n++ {
+			select {
+			case readings <- g.Next():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return readings
+}
@@ -0,0 +1,311 @@
+package loadtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/client"
+)
+
+// Options bound how the readings are sent
+type Options struct {
+	// Concurrency is the number of requests in flight at once; 1 when lower
+	Concurrency int
+	// Rate is the number of requests started per second; the workers send as fast as they can when it is 0
+	Rate float64
+	// Duration stops handing out readings after this long, and lets the requests in flight finish; never when 0
+	Duration time.Duration
+}
+
+// Result is the outcome of a single reading
+type Result struct {
+	// Status is the status code of the response, or 0 when no response was received
+	Status   int
+	Code     string
+	Overtemp bool
+	Latency  time.Duration
+	Err      error
+}
+
+// Run submits every reading of readings until the channel is closed, opts.Duration is over or ctx is done, and
+// reports how the server answered; the requests are never retried, so that the report counts every answer of the
+// server. Cancelling ctx cancels the requests in flight.
+func Run(ctx context.Context, c client.Client, readings <-chan string, opts Options) *Report {
+	concurrency := max(opts.Concurrency, 1)
+	// unbuffered, so that no reading waits for a worker once the run stops
+	jobs := make(chan string)
+	results := make(chan Result, concurrency)
+
+	started := time.Now()
+	stop, cancel := ctx, context.CancelFunc(func() {})
+	if opts.Duration > 0 {
+		stop, cancel = context.WithTimeout(ctx, opts.Duration)
+	}
+	defer cancel()
+	go dispatch(stop, readings, jobs, opts.Rate, started)
+
+	var workers sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for data := range jobs {
+				results <- Send(ctx, c, data)
+			}
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	recorder := NewRecorder()
+	for result := range results {
+		recorder.Record(result)
+	}
+	return recorder.Report(time.Since(started))
+}
+
+// dispatch hands the readings to the workers until ctx is done, the n-th one no earlier than n/rate seconds after
+// started
+func dispatch(ctx context.Context, readings <-chan string, jobs chan<- string, rate float64, started time.Time) {
+	defer close(jobs)
+	for n := 0; ; n++ {
+		var data string
+		var ok bool
+		select {
+		case data, ok = <-readings:
+			if !ok {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+
+		if rate > 0 {
+			due := started.Add(time.Duration(float64(n) / rate * float64(time.Second)))
+			if wait := time.Until(due); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				}
+			}
+		}
+
+		select {
+		case jobs <- data:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Send submits a single reading and times it
+func Send(ctx context.Context, c client.Client, data string) Result {
+	start := time.Now()
+	response, err := c.TempPost(ctx, data)
+	result := Result{Status: http.StatusOK, Latency: time.Since(start)}
+	if err != nil {
+		result.Status = client.StatusCode(err)
+		result.Err = err
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) {
+			result.Code = apiErr.Code
+		}
+		return result
+	}
+	result.Overtemp = response.Overtemp
+	return result
+}
+
+// Recorder collects the results of a run; it is not safe for concurrent use
+type Recorder struct {
+	statuses  map[int]int
+	codes     map[string]int
+	overtemp  int
+	latencies []time.Duration
+	// failures keeps the first transport errors, which are otherwise only counted under the status 0
+	failures []string
+}
+
+// maxFailures is the number of transport errors kept in a report
+const maxFailures = 5
+
+func NewRecorder() *Recorder {
+	return &Recorder{statuses: map[int]int{}, codes: map[string]int{}}
+}
+
+func (r *Recorder) Record(result Result) {
+	r.statuses[result.Status]++
+	if result.Code != "" {
+		r.codes[result.Code]++
+	}
+	if result.Overtemp {
+		r.overtemp++
+	}
+	r.latencies = append(r.latencies, result.Latency)
+	if result.Status == 0 && result.Err != nil && len(r.failures) < maxFailures {
+		r.failures = append(r.failures, result.Err.Error())
+	}
+}
+
+// Report summarizes the results recorded over a run that lasted elapsed
+func (r *Recorder) Report(elapsed time.Duration) *Report {
+	report := &Report{
+		Requests:    len(r.latencies),
+		Elapsed:     elapsed,
+		StatusCodes: map[string]int{},
+		Codes:       r.codes,
+		Overtemp:    r.overtemp,
+		Failures:    r.failures,
+	}
+	for status, count := range r.statuses {
+		report.StatusCodes[strconv.Itoa(status)] = count
+		switch status {
+		case http.StatusOK:
+			report.Accepted = count
+		case http.StatusTooManyRequests:
+			report.RateLimited = count
+		}
+	}
+	if elapsed > 0 {
+		report.Throughput = float64(report.Requests) / elapsed.Seconds()
+		report.AcceptedThroughput = float64(report.Accepted) / elapsed.Seconds()
+	}
+	report.Latency = latencies(r.latencies)
+	return report
+}
+
+// Report is how the server answered a run; status 0 counts the requests that got no response
+type Report struct {
+	Requests int           `json:"requests"`
+	Elapsed  time.Duration `json:"elapsed_ns"`
+	// Throughput is the number of requests answered per second, the rejected and the rate-limited ones included
+	Throughput float64 `json:"throughput"`
+	// AcceptedThroughput is the number of readings accepted per second, which a 429 answered early can't inflate
+	AcceptedThroughput float64 `json:"accepted_throughput"`
+	Accepted           int     `json:"accepted"`
+	// RateLimited counts the requests turned away with a 429
+	RateLimited int            `json:"rate_limited"`
+	Overtemp    int            `json:"overtemp"`
+	StatusCodes map[string]int `json:"status_codes"`
+	// Codes counts the problem codes of the rejected readings, e.g. invalid_temperature
+	Codes    map[string]int `json:"codes"`
+	Latency  Latency        `json:"latency"`
+	Failures []string       `json:"failures,omitempty"`
+}
+
+// Latency holds the percentiles of the latencies of a run, measured by the client
+type Latency struct {
+	Min  time.Duration `json:"min_ns"`
+	Mean time.Duration `json:"mean_ns"`
+	P50  time.Duration `json:"p50_ns"`
+	P90  time.Duration `json:"p90_ns"`
+	P95  time.Duration `json:"p95_ns"`
+	P99  time.Duration `json:"p99_ns"`
+	Max  time.Duration `json:"max_ns"`
+}
+
+func latencies(samples []time.Duration) Latency {
+	if len(samples) == 0 {
+		return Latency{}
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, sample := range sorted {
+		total += sample
+	}
+	return Latency{
+		Min:  sorted[0],
+		Mean: total / time.Duration(len(sorted)),
+		P50:  Percentile(sorted, 50),
+		P90:  Percentile(sorted, 90),
+		P95:  Percentile(sorted, 95),
+		P99:  Percentile(sorted, 99),
+		Max:  sorted[len(sorted)-1],
+	}
+}
+
+// Percentile returns the nearest-rank percentile p of sorted, which must be in ascending order
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
+
+// WriteJSON writes the report for scripts
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteText writes the report for people
+func (r *Report) WriteText(w io.Writer) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "requests\t%d\n", r.Requests)
+	fmt.Fprintf(table, "elapsed\t%s\n", r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(table, "throughput\t%.1f/s\n", r.Throughput)
+	fmt.Fprintf(table, "accepted\t%d, %.1f/s\n", r.Accepted, r.AcceptedThroughput)
+	fmt.Fprintf(table, "rate limited\t%d\n", r.RateLimited)
+	fmt.Fprintf(table, "overtemp\t%d\n", r.Overtemp)
+
+	fmt.Fprintln(table, "\nstatus\tcount")
+	for _, status := range sortedKeys(r.StatusCodes) {
+		fmt.Fprintf(table, "%s\t%d\n", status, r.StatusCodes[status])
+	}
+	if len(r.Codes) > 0 {
+		fmt.Fprintln(table, "\ncode\tcount")
+		for _, code := range sortedKeys(r.Codes) {
+			fmt.Fprintf(table, "%s\t%d\n", code, r.Codes[code])
+		}
+	}
+
+	fmt.Fprintln(table, "\nlatency\t")
+	for _, row := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"min", r.Latency.Min}, {"mean", r.Latency.Mean}, {"p50", r.Latency.P50}, {"p90", r.Latency.P90},
+		{"p95", r.Latency.P95}, {"p99", r.Latency.P99}, {"max", r.Latency.Max},
+	} {
+		fmt.Fprintf(table, "%s\t%s\n", row.name, row.value)
+	}
+
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	for i, failure := range r.Failures {
+		if i == 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "failed: %s\n", failure)
+	}
+	return nil
+}
+
+func sortedKeys(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
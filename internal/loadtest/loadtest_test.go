@@ -0,0 +1,238 @@
+package loadtest_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/client"
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/loadtest"
+	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+	"github.com/sarabrajsingh/restful-openapi/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func readings(data ...string) <-chan string {
+	source := make(chan string, len(data))
+	for _, d := range data {
+		source <- d
+	}
+	close(source)
+	return source
+}
+
+func TestRun(t *testing.T) {
+	logger, err := logging.NewLogger(io.Discard, logging.FormatText, slog.LevelError)
+	assert.NoError(t, err)
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.Auth.Disabled = true
+	cfg.RateLimits = nil
+
+	c, err := client.NewClient(loadtest.InProcessURL, client.Config{
+		HTTPClient: &http.Client{Transport: loadtest.HandlerTransport(loadtest.NewInProcessRouter(cfg, logger))},
+	})
+	assert.NoError(t, err)
+
+	report := loadtest.Run(context.Background(), c, readings(
+		"365951380:1640995229697:'Temperature':58.48256793121914",
+		"365951380:1640995229697:'Temperature':98.48256793121914",
+		"365951381:1640995229697:'Temperature':99.1",
+		"foobar",
+		"365951380:1640995229697:'Temperature':hot",
+	), loadtest.Options{Concurrency: 3})
+
+	assert.Equal(t, 5, report.Requests)
+	assert.Equal(t, 3, report.Accepted)
+	assert.Equal(t, 2, report.Overtemp)
+	assert.Equal(t, map[string]int{"200": 3, "400": 2}, report.StatusCodes)
+	assert.Equal(t, map[string]int{"invalid_argument_count": 1, "invalid_temperature": 1}, report.Codes)
+	assert.True(t, report.Latency.Min <= report.Latency.P50 && report.Latency.P50 <= report.Latency.Max)
+	assert.Greater(t, report.Throughput, 0.0)
+
+	var text strings.Builder
+	assert.NoError(t, report.WriteText(&text))
+	assert.Contains(t, text.String(), "invalid_temperature")
+	assert.Contains(t, text.String(), "p99")
+}
+
+func TestRunRate(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := maxInFlight.Load()
+			if n <= seen || maxInFlight.CompareAndSwap(seen, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"overtemp": false}`))
+	})
+	c, err := client.NewClient(loadtest.InProcessURL, client.Config{HTTPClient: &http.Client{Transport: loadtest.HandlerTransport(handler)}})
+	assert.NoError(t, err)
+
+	data := make([]string, 11)
+	report := loadtest.Run(context.Background(), c, readings(data...), loadtest.Options{Concurrency: 2, Rate: 100})
+	assert.Equal(t, 11, report.Accepted)
+	// the 11th reading is not sent before 100ms
+	assert.GreaterOrEqual(t, report.Elapsed, 100*time.Millisecond)
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(2))
+}
+
+func TestRunCancel(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"overtemp": false}`))
+	})
+	c, err := client.NewClient(loadtest.InProcessURL, client.Config{HTTPClient: &http.Client{Transport: loadtest.HandlerTransport(handler)}})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	// a reading per second would take a minute
+	report := loadtest.Run(ctx, c, readings(make([]string, 60)...), loadtest.Options{Rate: 1})
+	assert.Equal(t, 1, report.Requests)
+}
+
+// TestRunDuration tests that the end of the duration lets the reading in flight finish, and sends no other
+func TestRunDuration(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(`{"overtemp": false}`))
+	})
+	c, err := client.NewClient(loadtest.InProcessURL, client.Config{HTTPClient: &http.Client{Transport: loadtest.HandlerTransport(handler)}})
+	assert.NoError(t, err)
+
+	report := loadtest.Run(context.Background(), c, readings(make([]string, 10)...), loadtest.Options{Duration: 20 * time.Millisecond})
+	assert.Equal(t, map[string]int{"200": 1}, report.StatusCodes)
+}
+
+// TestTargetInProcess tests that the in-process server keeps its access log out of stdout, where the report goes
+func TestTargetInProcess(t *testing.T) {
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	logger, err := logging.NewLogger(io.Discard, logging.FormatText, slog.LevelError)
+	assert.NoError(t, err)
+	c, err := loadtest.Target{Logger: logger}.NewClient()
+	assert.NoError(t, err)
+	report := loadtest.Run(context.Background(), c, readings("365951380:1640995229697:'Temperature':58.48256793121914"), loadtest.Options{})
+	assert.Equal(t, 1, report.Accepted)
+
+	os.Stdout = stdout
+	assert.NoError(t, w.Close())
+	written, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Empty(t, string(written))
+}
+
+func TestRecorder(t *testing.T) {
+	recorder := loadtest.NewRecorder()
+	for i := 1; i <= 100; i++ {
+		recorder.Record(loadtest.Result{Status: http.StatusOK, Latency: time.Duration(i) * time.Millisecond})
+	}
+	recorder.Record(loadtest.Result{Status: 0, Latency: time.Second, Err: errors.New("connection refused")})
+
+	report := recorder.Report(time.Second)
+	assert.Equal(t, 101, report.Requests)
+	assert.Equal(t, 100, report.Accepted)
+	assert.Equal(t, 101.0, report.Throughput)
+	assert.Equal(t, 100.0, report.AcceptedThroughput)
+	assert.Equal(t, map[string]int{"0": 1, "200": 100}, report.StatusCodes)
+	assert.Equal(t, []string{"connection refused"}, report.Failures)
+	assert.Equal(t, loadtest.Latency{
+		Min:  time.Millisecond,
+		Mean: 6050 * time.Millisecond / 101,
+		P50:  51 * time.Millisecond,
+		P90:  91 * time.Millisecond,
+		P95:  96 * time.Millisecond,
+		P99:  100 * time.Millisecond,
+		Max:  time.Second,
+	}, report.Latency)
+
+	// the 429s count towards the throughput, but not towards the accepted one
+	recorder = loadtest.NewRecorder()
+	recorder.Record(loadtest.Result{Status: http.StatusOK})
+	for i := 0; i < 3; i++ {
+		recorder.Record(loadtest.Result{Status: http.StatusTooManyRequests, Code: "rate_limited"})
+	}
+	report = recorder.Report(2 * time.Second)
+	assert.Equal(t, 3, report.RateLimited)
+	assert.Equal(t, 2.0, report.Throughput)
+	assert.Equal(t, 0.5, report.AcceptedThroughput)
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{1, 2, 3, 4}
+	assert.Equal(t, time.Duration(0), loadtest.Percentile(nil, 50))
+	assert.Equal(t, time.Duration(1), loadtest.Percentile(sorted, 0))
+	assert.Equal(t, time.Duration(2), loadtest.Percentile(sorted, 50))
+	assert.Equal(t, time.Duration(3), loadtest.Percentile(sorted, 51))
+	assert.Equal(t, time.Duration(4), loadtest.Percentile(sorted, 100))
+}
+
+func TestGenerator(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	first := loadtest.NewGeneratorWithClock(10, loadtest.DefaultMix, 7, clock)
+	second := loadtest.NewGeneratorWithClock(10, loadtest.DefaultMix, 7, clock)
+	devices := map[int32]bool{}
+	reasons := map[string]int{}
+	valid, overtemp := 0, 0
+	for i := 0; i < 10000; i++ {
+		data := first.Next()
+		assert.Equal(t, data, second.Next(), "the same seed generates the same readings")
+
+		payload, err := utils.PayloadParserHelper(data)
+		if err != nil {
+			var parseErr *utils.ParseError
+			if assert.ErrorAs(t, err, &parseErr) {
+				reasons[parseErr.Reason]++
+			}
+			continue
+		}
+		valid++
+		devices[payload.DeviceId] = true
+		assert.Equal(t, now.UnixMilli(), payload.EpochMS)
+		if payload.Temperature >= utils.DefaultOvertempThreshold {
+			overtemp++
+		}
+	}
+
+	assert.Len(t, devices, 10)
+	assert.InDelta(t, 0.95, float64(valid)/10000, 0.01)
+	assert.InDelta(t, 0.1, float64(overtemp)/float64(valid), 0.01)
+	for _, reason := range []string{utils.ParseReasonArguments, utils.ParseReasonDeviceId, utils.ParseReasonEpoch, utils.ParseReasonTemperatureKey, utils.ParseReasonTemperature} {
+		assert.Greater(t, reasons[reason], 50, reason)
+	}
+}
+
+func TestGeneratorStream(t *testing.T) {
+	generator := loadtest.NewGenerator(1, loadtest.Mix{}, 1)
+	count := 0
+	for range generator.Stream(context.Background(), 3) {
+		count++
+	}
+	assert.Equal(t, 3, count)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := generator.Stream(ctx, 0)
+	<-stream
+	cancel()
+	for range stream {
+	}
+}
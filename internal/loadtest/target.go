@@ -0,0 +1,135 @@
+package loadtest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/client"
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/audit"
+	"github.com/sarabrajsingh/restful-openapi/internal/fleet"
+	"github.com/sarabrajsingh/restful-openapi/internal/global_errors"
+	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+	"github.com/sarabrajsingh/restful-openapi/internal/server"
+	"github.com/sarabrajsingh/restful-openapi/internal/utils"
+)
+
+// InProcessURL is the base URL of the requests sent to an in-process router; it never reaches the network
+const InProcessURL = "http://in-process"
+
+// DefaultRequestTimeout bounds a request when the Target sets no RequestTimeout
+const DefaultRequestTimeout = 10 * time.Second
+
+// Target is the server the readings are sent to
+type Target struct {
+	// URL of the server; the readings go to the router of an in-process server built from the configuration of
+	// the environment, without its access log and its rate limits, when it is empty
+	URL    string
+	APIKey string
+	// Token is a bearer token, used when no APIKey is set
+	Token string
+	// CAFile is a PEM file of the CA that issued the certificate of the server
+	CAFile string
+	// Logger receives the logs of the in-process server
+	Logger logging.Logger
+	// RateLimits keeps the rate limits of the configuration for the in-process server
+	RateLimits bool
+	// RequestTimeout bounds every request, so that the ones in flight when a run stops can't hang it;
+	// DefaultRequestTimeout when 0
+	RequestTimeout time.Duration
+}
+
+// NewClient returns a client of the target that never retries
+func (t Target) NewClient() (client.Client, error) {
+	cfg := client.Config{UserAgent: "loadtest"}
+	switch {
+	case t.APIKey != "":
+		cfg.Auth = client.APIKey(t.APIKey)
+	case t.Token != "":
+		cfg.Auth = client.BearerToken(t.Token)
+	}
+
+	timeout := t.RequestTimeout
+	if timeout <= 0 {
+		timeout = DefaultRequestTimeout
+	}
+
+	if t.URL == "" {
+		serverConfig, err := t.inProcessConfig()
+		if err != nil {
+			return nil, fmt.Errorf("in-process server: %w", err)
+		}
+		cfg.HTTPClient = &http.Client{Transport: HandlerTransport(NewInProcessRouter(serverConfig, t.Logger)), Timeout: timeout}
+		return client.NewClient(InProcessURL, cfg)
+	}
+
+	cfg.HTTPClient = &http.Client{Timeout: timeout}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA file: no certificate found in %s", t.CAFile)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+		cfg.HTTPClient.Transport = transport
+	}
+	return client.NewClient(t.URL, cfg)
+}
+
+// inProcessConfig is the configuration of the environment, adjusted to a server that only answers the run
+func (t Target) inProcessConfig() (*config.Config, error) {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		return nil, err
+	}
+	// the access log goes to stdout, where it would bury the report
+	cfg.AccessLog.Format = config.AccessLogFormatOff
+	// the in-process server never listens on a network, so it needs no keys of its own
+	if len(cfg.APIKeys) == 0 && !cfg.JWT.Enabled() {
+		cfg.Auth.Disabled = true
+	}
+	// a run sends the readings of a device faster than the device does, so the limits would measure themselves
+	// rather than the handlers
+	if !t.RateLimits {
+		cfg.RateLimits = nil
+	}
+	return cfg, nil
+}
+
+// NewInProcessRouter builds the router of a server the way main does, without listening on a port, so that a run
+// measures the handlers rather than the network
+func NewInProcessRouter(cfg *config.Config, logger logging.Logger) http.Handler {
+	errorStore := global_errors.NewErrorStoreWithSize(cfg.ErrorBufferSize)
+	fleetStore := fleet.NewFleetStoreWithClock(cfg.FleetOfflineAfter, time.Now)
+	srv := server.NewServer(cfg, logger, errorStore, fleetStore, audit.NewAuditStore(), utils.DefaultBodyReader)
+	return srv.NewRouter()
+}
+
+// HandlerTransport serves the requests of an http.Client with handler
+func HandlerTransport(handler http.Handler) http.RoundTripper {
+	return handlerTransport{handler: handler}
+}
+
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// the fields an http.Server fills in for the access log and the rate limits
+	r = r.Clone(r.Context())
+	r.RemoteAddr = "127.0.0.1:0"
+	r.RequestURI = r.URL.RequestURI()
+
+	recorder := httptest.NewRecorder()
+	t.handler.ServeHTTP(recorder, r)
+	return recorder.Result(), nil
+}
@@ -0,0 +1,18 @@
+package logging
+
+import "context"
+
+type loggerKey struct{}
+
+// NewContext returns a context carrying a request-scoped Logger
+func NewContext(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the request-scoped Logger, or fallback outside of a request
+func FromContext(ctx context.Context, fallback Logger) Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(Logger); ok {
+		return logger
+	}
+	return fallback
+}
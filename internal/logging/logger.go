@@ -1,8 +1,21 @@
 package logging
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
 )
 
 type Logger interface {
@@ -10,18 +23,36 @@ type Logger interface {
 	Println(args ...interface{})
 	Fatalf(format string, args ...interface{})
 	Fatal(args ...interface{})
+
+	// Debug, Info, Warn and Error log a message with alternating keys and values
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+
+	// With returns a Logger that adds the keys and values to every message
+	With(keysAndValues ...interface{}) Logger
 }
 
+// ServerLogger writes the plain text format the server has always used, e.g.
+// INFO: 2024/07/27 15:26:35 handlers.go:74: malformed data string received error="..."
 type ServerLogger struct {
 	*log.Logger
+	// Level is the lowest level written by Printf, Println, Debug, Info, Warn and Error; the zero value is info
+	Level  slog.Level
+	fields []interface{}
+	// loggers holds a copy of Logger per level with the level as its prefix, built on first use and shared with
+	// the loggers returned by With
+	once    sync.Once
+	loggers map[slog.Level]*log.Logger
 }
 
 func (s *ServerLogger) Printf(format string, args ...interface{}) {
-	s.Logger.Printf(format, args...)
+	s.log(slog.LevelInfo, fmt.Sprintf(format, args...), nil)
 }
 
 func (s *ServerLogger) Println(args ...interface{}) {
-	s.Logger.Println(args...)
+	s.log(slog.LevelInfo, strings.TrimSuffix(fmt.Sprintln(args...), "\n"), nil)
 }
 
 func (s *ServerLogger) Fatalf(format string, args ...interface{}) {
@@ -32,6 +63,159 @@ func (s *ServerLogger) Fatal(args ...interface{}) {
 	s.Logger.Fatal(args...)
 }
 
+func (s *ServerLogger) Debug(msg string, keysAndValues ...interface{}) {
+	s.log(slog.LevelDebug, msg, keysAndValues)
+}
+
+func (s *ServerLogger) Info(msg string, keysAndValues ...interface{}) {
+	s.log(slog.LevelInfo, msg, keysAndValues)
+}
+
+func (s *ServerLogger) Warn(msg string, keysAndValues ...interface{}) {
+	s.log(slog.LevelWarn, msg, keysAndValues)
+}
+
+func (s *ServerLogger) Error(msg string, keysAndValues ...interface{}) {
+	s.log(slog.LevelError, msg, keysAndValues)
+}
+
+func (s *ServerLogger) With(keysAndValues ...interface{}) Logger {
+	return &ServerLogger{
+		Logger:  s.Logger,
+		Level:   s.Level,
+		fields:  append(append([]interface{}{}, s.fields...), keysAndValues...),
+		loggers: s.levelLoggers(),
+	}
+}
+
+func (s *ServerLogger) levelLoggers() map[slog.Level]*log.Logger {
+	s.once.Do(func() {
+		if s.loggers != nil {
+			return
+		}
+		// the prefix carries the level, in the same position as the INFO: prefix of Logger
+		s.loggers = map[slog.Level]*log.Logger{}
+		for _, level := range []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError} {
+			s.loggers[level] = log.New(s.Logger.Writer(), level.String()+": ", s.Logger.Flags())
+		}
+	})
+	return s.loggers
+}
+
+func (s *ServerLogger) log(level slog.Level, msg string, keysAndValues []interface{}) {
+	if level < s.Level {
+		return
+	}
+
+	var line strings.Builder
+	line.WriteString(msg)
+	writeFields(&line, s.fields)
+	writeFields(&line, keysAndValues)
+
+	// skip log and the exported level method so the caller's file and line are reported
+	s.levelLoggers()[level].Output(3, line.String())
+}
+
+// writeFields appends key=value pairs, quoting values that contain spaces
+func writeFields(line *strings.Builder, keysAndValues []interface{}) {
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key := fmt.Sprint(keysAndValues[i])
+		value := "!MISSING"
+		if i+1 < len(keysAndValues) {
+			value = fmt.Sprint(keysAndValues[i+1])
+		}
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		line.WriteString(" ")
+		line.WriteString(key)
+		line.WriteString("=")
+		line.WriteString(value)
+	}
+}
+
+// jsonLogger writes one JSON object per line through log/slog
+type jsonLogger struct {
+	logger *slog.Logger
+}
+
+func (j *jsonLogger) Printf(format string, args ...interface{}) {
+	j.log(slog.LevelInfo, fmt.Sprintf(format, args...), nil)
+}
+
+func (j *jsonLogger) Println(args ...interface{}) {
+	j.log(slog.LevelInfo, strings.TrimSuffix(fmt.Sprintln(args...), "\n"), nil)
+}
+
+func (j *jsonLogger) Fatalf(format string, args ...interface{}) {
+	j.log(slog.LevelError, fmt.Sprintf(format, args...), nil)
+	os.Exit(1)
+}
+
+func (j *jsonLogger) Fatal(args ...interface{}) {
+	j.log(slog.LevelError, fmt.Sprint(args...), nil)
+	os.Exit(1)
+}
+
+func (j *jsonLogger) Debug(msg string, keysAndValues ...interface{}) {
+	j.log(slog.LevelDebug, msg, keysAndValues)
+}
+
+func (j *jsonLogger) Info(msg string, keysAndValues ...interface{}) {
+	j.log(slog.LevelInfo, msg, keysAndValues)
+}
+
+func (j *jsonLogger) Warn(msg string, keysAndValues ...interface{}) {
+	j.log(slog.LevelWarn, msg, keysAndValues)
+}
+
+func (j *jsonLogger) Error(msg string, keysAndValues ...interface{}) {
+	j.log(slog.LevelError, msg, keysAndValues)
+}
+
+func (j *jsonLogger) With(keysAndValues ...interface{}) Logger {
+	return &jsonLogger{logger: j.logger.With(keysAndValues...)}
+}
+
+func (j *jsonLogger) log(level slog.Level, msg string, keysAndValues []interface{}) {
+	ctx := context.Background()
+	if !j.logger.Enabled(ctx, level) {
+		return
+	}
+
+	// skip runtime.Callers, log and the exported method so the source points at the caller
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+
+	record := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	record.Add(keysAndValues...)
+	j.logger.Handler().Handle(ctx, record)
+}
+
+// ParseLevel converts debug, info, warn or error to a slog.Level
+func ParseLevel(level string) (slog.Level, error) {
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q; expected debug, info, warn or error", level)
+	}
+	return parsed, nil
+}
+
+// NewLogger creates a Logger writing the given format to w
+func NewLogger(w io.Writer, format string, level slog.Level) (Logger, error) {
+	switch format {
+	case FormatText, "":
+		return &ServerLogger{
+			Logger: log.New(w, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile),
+			Level:  level,
+		}, nil
+	case FormatJSON:
+		handler := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, AddSource: true})
+		return &jsonLogger{logger: slog.New(handler)}, nil
+	}
+	return nil, fmt.Errorf("unknown log format %q; expected text or json", format)
+}
+
 func NewRealLogger() Logger {
 	return &ServerLogger{
 		Logger: log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile),
@@ -2,7 +2,9 @@ package logging
 
 import (
 	"bytes"
+	"encoding/json"
 	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"testing"
@@ -76,3 +78,65 @@ func TestNewRealLogger(t *testing.T) {
 	logger := NewRealLogger()
 	assert.NotNil(t, logger)
 }
+
+func TestServerLogger_Levels(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&buf, "INFO: ", log.Lshortfile)
+	serverLogger := &ServerLogger{Logger: logger, Level: slog.LevelWarn}
+
+	serverLogger.Info("dropped")
+	serverLogger.Printf("dropped %s", "too")
+	serverLogger.Warn("rate limit exceeded", "key", "apiKey:ops", "route", "ErrorsGet")
+
+	output := buf.String()
+	assert.NotContains(t, output, "dropped")
+	assert.Contains(t, output, "WARN: logger_test.go:")
+	assert.Contains(t, output, "rate limit exceeded key=apiKey:ops route=ErrorsGet")
+}
+
+func TestServerLogger_With(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&buf, "INFO: ", 0)
+	parent := &ServerLogger{Logger: logger}
+	serverLogger := parent.With("request_id", "abc")
+
+	serverLogger.Info("appending to errorBuffer", "error", "bad data string")
+	serverLogger.Printf("listening on %d", 8080)
+
+	assert.Equal(t, "INFO: appending to errorBuffer request_id=abc error=\"bad data string\"\n"+
+		"INFO: listening on 8080 request_id=abc\n", buf.String())
+	// the loggers of the levels are built once and shared
+	assert.Same(t, parent.levelLoggers()[slog.LevelInfo], serverLogger.(*ServerLogger).levelLoggers()[slog.LevelInfo])
+}
+
+func TestNewLogger_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, FormatJSON, slog.LevelDebug)
+	assert.NoError(t, err)
+
+	logger.With("request_id", "abc").Debug("request", "status", 200)
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "DEBUG", entry["level"])
+	assert.Equal(t, "request", entry["msg"])
+	assert.Equal(t, "abc", entry["request_id"])
+	assert.Equal(t, float64(200), entry["status"])
+
+	source := entry["source"].(map[string]interface{})
+	assert.Contains(t, source["file"], "logger_test.go")
+}
+
+func TestNewLogger_UnknownFormat(t *testing.T) {
+	_, err := NewLogger(&bytes.Buffer{}, "xml", slog.LevelInfo)
+	assert.Error(t, err)
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("warn")
+	assert.NoError(t, err)
+	assert.Equal(t, slog.LevelWarn, level)
+
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err)
+}
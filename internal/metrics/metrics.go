@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sarabrajsingh/restful-openapi/internal/global_errors"
+	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+)
+
+type Metrics interface {
+	// ObserveRequest counts a request and its latency under its Route.Name, the version of the API and the response
+	// status
+	ObserveRequest(route, apiVersion string, status int, latency time.Duration)
+	// RecordReading counts a reading accepted by POST /temp and its overtemp verdict
+	RecordReading(overtemp bool)
+	// RecordParseFailure counts a rejected POST /temp payload by reason
+	RecordParseFailure(reason string)
+	// Handler serves the metrics in the Prometheus text exposition format
+	Handler() http.Handler
+}
+
+type metricsImpl struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	readings        prometheus.Counter
+	verdicts        *prometheus.CounterVec
+	parseFailures   *prometheus.CounterVec
+}
+
+// NewMetrics creates the collectors in their own registry; the ErrorStore is read on every scrape
+func NewMetrics(log logging.Logger, errorStore global_errors.ErrorStore) Metrics {
+	m := &metricsImpl{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Requests handled, by route name, API version and response status.",
+		}, []string{"route", "api_version", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Time taken to send the response, by route name, API version and response status.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "api_version", "status"}),
+		readings: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "readings_ingested_total",
+			Help: "Readings accepted by POST /temp.",
+		}),
+		verdicts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "overtemp_verdicts_total",
+			Help: "Overtemp verdicts returned by POST /temp.",
+		}, []string{"overtemp"}),
+		parseFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "payload_parse_failures_total",
+			Help: "POST /temp payloads that could not be parsed, by reason.",
+		}, []string{"reason"}),
+	}
+
+	// report both verdicts from the first scrape on
+	m.verdicts.WithLabelValues("true")
+	m.verdicts.WithLabelValues("false")
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.readings,
+		m.verdicts,
+		m.parseFailures,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "error_store_size",
+			Help: "Errors currently held in the error buffer.",
+		}, func() float64 {
+			return float64(errorStore.GetStats(log).Size)
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "error_store_overflows_total",
+			Help: "Errors dropped because the error buffer was full.",
+		}, func() float64 {
+			return float64(errorStore.GetStats(log).Overflows)
+		}),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+func (m *metricsImpl) ObserveRequest(route, apiVersion string, status int, latency time.Duration) {
+	code := strconv.Itoa(status)
+	m.requests.WithLabelValues(route, apiVersion, code).Inc()
+	m.requestDuration.WithLabelValues(route, apiVersion, code).Observe(latency.Seconds())
+}
+
+func (m *metricsImpl) RecordReading(overtemp bool) {
+	m.readings.Inc()
+	m.verdicts.WithLabelValues(strconv.FormatBool(overtemp)).Inc()
+}
+
+func (m *metricsImpl) RecordParseFailure(reason string) {
+	m.parseFailures.WithLabelValues(reason).Inc()
+}
+
+func (m *metricsImpl) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,49 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sarabrajsingh/restful-openapi/internal/global_errors"
+	"github.com/sarabrajsingh/restful-openapi/internal/metrics"
+	"github.com/sarabrajsingh/restful-openapi/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockErrorStore.EXPECT().GetStats(mockLogger).Return(global_errors.Stats{Size: 7, Overflows: 3}).AnyTimes()
+
+	m := metrics.NewMetrics(mockLogger, mockErrorStore)
+	m.ObserveRequest("TempPost", "v1", 200, 20*time.Millisecond)
+	m.ObserveRequest("TempPost", "v1", 400, 5*time.Millisecond)
+	m.ObserveRequest("TempPost", "v1", 400, 5*time.Millisecond)
+	m.RecordReading(true)
+	m.RecordReading(false)
+	m.RecordReading(false)
+	m.RecordParseFailure("device_id")
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+
+	output := string(body)
+	assert.Contains(t, output, `http_requests_total{api_version="v1",route="TempPost",status="200"} 1`)
+	assert.Contains(t, output, `http_requests_total{api_version="v1",route="TempPost",status="400"} 2`)
+	assert.Contains(t, output, `http_request_duration_seconds_bucket{api_version="v1",route="TempPost",status="200",le="0.025"} 1`)
+	assert.Contains(t, output, `readings_ingested_total 3`)
+	assert.Contains(t, output, `overtemp_verdicts_total{overtemp="true"} 1`)
+	assert.Contains(t, output, `overtemp_verdicts_total{overtemp="false"} 2`)
+	assert.Contains(t, output, `payload_parse_failures_total{reason="device_id"} 1`)
+	assert.Contains(t, output, `error_store_size 7`)
+	assert.Contains(t, output, `error_store_overflows_total 3`)
+	assert.Contains(t, output, `go_goroutines`)
+}
@@ -1,16 +1,8 @@
+// Package models holds the types exchanged by the handlers and the stores; the types of the contract are generated
+// into openapi.gen.go by go generate, the ones below are not part of the contract
 package models
 
-type GetErrorsResponse struct {
-	Errors []string `json:"errors"`
-}
-
-type Response400 struct {
-	Error string `json:"error"`
-}
-
-type TempPostBody struct {
-	Data string `json:"data"`
-}
+import "time"
 
 type TempPostPayload struct {
 	DeviceId    int32
@@ -18,8 +10,20 @@ type TempPostPayload struct {
 	Temperature float64
 }
 
-type TempPostResponse struct {
-	Overtemp      bool   `json:"overtemp"`
-	DeviceId      int32  `json:"device_id,omitempty"`
-	FormattedTime string `json:"formatted_time,omitempty"`
+type AuditQuery struct {
+	Action string
+	Actor  string
+	Since  time.Time
+	Limit  int
+}
+
+type HealthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type HealthResponse struct {
+	Status string `json:"status"`
+	// Checks is only reported in the verbose mode
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
 }
@@ -0,0 +1,142 @@
+// Code generated by openapi-gen from api/openapi.yaml; DO NOT EDIT.
+
+package models
+
+type TempPostBody struct {
+	Data string `json:"data"`
+}
+
+type TempPostGoodResponseWithOverTemp struct {
+	Overtemp      bool   `json:"overtemp"`
+	DeviceId      int32  `json:"device_id"`
+	FormattedTime string `json:"formatted_time"`
+}
+
+type TempPostGoodResponseWithNoOverTemp struct {
+	Overtemp bool `json:"overtemp"`
+}
+
+type Response400 struct {
+	Error string `json:"error"`
+	// The X-Request-ID of the request, also returned as a response header
+	RequestId string `json:"request_id,omitempty"`
+}
+
+type ErrorDetail struct {
+	Error     string `json:"error"`
+	RequestId string `json:"request_id,omitempty"`
+}
+
+type GetErrorsResponse struct {
+	Errors []string `json:"errors"`
+	// The errors paired with the id of the request that reported them
+	Details []ErrorDetail `json:"details,omitempty"`
+}
+
+type FleetDevice struct {
+	DeviceId    int32   `json:"device_id"`
+	Temperature float64 `json:"temperature"`
+	Overtemp    bool    `json:"overtemp"`
+	LastSeen    string  `json:"last_seen"`
+}
+
+type FleetSummaryResponse struct {
+	TotalDevices     int `json:"total_devices"`
+	OvertempDevices  int `json:"overtemp_devices"`
+	OfflineDevices   int `json:"offline_devices"`
+	WindowMinutes    int `json:"window_minutes"`
+	ReadingsInWindow int `json:"readings_in_window"`
+	// The malformed data strings stored in the errors array since the server started, including the ones
+	// since dropped from the full buffer or cleared by DELETE /errors
+	MalformedPayloads uint64 `json:"malformed_payloads"`
+	// The share of malformed_payloads among the malformed and the good readings since the server started
+	MalformedRate float64 `json:"malformed_rate"`
+	// The online devices with the highest latest temperature, hottest first
+	HottestDevices []FleetDevice `json:"hottest_devices"`
+}
+
+// Scope failures only carry the error message, while role-based access control failures also report the
+// caller, its roles and the roles allowed to call the route.
+type Forbidden403 struct {
+	Error        string   `json:"error"`
+	Route        string   `json:"route,omitempty"`
+	Caller       string   `json:"caller,omitempty"`
+	Roles        []string `json:"roles,omitempty"`
+	AllowedRoles []string `json:"allowed_roles,omitempty"`
+	RequestId    string   `json:"request_id,omitempty"`
+}
+
+type AuditEntry struct {
+	Id         int64             `json:"id"`
+	Time       string            `json:"time"`
+	Action     string            `json:"action"`
+	Actor      string            `json:"actor"`
+	RemoteAddr string            `json:"remote_addr"`
+	Method     string            `json:"method"`
+	Path       string            `json:"path"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+	Status     int               `json:"status"`
+	RequestId  string            `json:"request_id,omitempty"`
+}
+
+type GetAuditResponse struct {
+	Entries []AuditEntry `json:"entries"`
+}
+
+// Identifies the active configuration and contract by a hash of their content
+type VersionResponse struct {
+	ConfigVersion   string `json:"config_version"`
+	ConfigFile      string `json:"config_file,omitempty"`
+	SpecVersion     string `json:"spec_version"`
+	APIVersion      string `json:"api_version"`
+	LoadedAt        string `json:"loaded_at"`
+	Reloads         int    `json:"reloads"`
+	LastReloadAt    string `json:"last_reload_at,omitempty"`
+	LastReloadError string `json:"last_reload_error,omitempty"`
+	// Every version of the API served, spec_version and api_version above are the ones of v1
+	Versions []APIVersion `json:"versions,omitempty"`
+}
+
+// A version of the API, served under its own prefix and validated against its own contract
+type APIVersion struct {
+	Name         string `json:"name"`
+	Prefix       string `json:"prefix"`
+	SpecVersion  string `json:"spec_version"`
+	APIVersion   string `json:"api_version"`
+	DeprecatedAt string `json:"deprecated_at,omitempty"`
+	// The version stops being served after this time
+	SunsetAt string `json:"sunset_at,omitempty"`
+	// The prefix of the version that replaces it
+	Successor string `json:"successor,omitempty"`
+}
+
+// An RFC 7807 problem, sent as application/problem+json. v1 only sends it to the clients that accept
+// application/problem+json, the others are sent the legacy {"error": ...} shape. The codes and their type URIs
+// are listed in docs/problems.md.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// The path of the request
+	Instance string `json:"instance,omitempty"`
+	// The machine-readable reason of the failure, the last part of the type URI
+	Code      string `json:"code"`
+	RequestId string `json:"request_id,omitempty"`
+	// Every part of the request that does not match the contract
+	Errors []ValidationError `json:"errors,omitempty"`
+	// The route the caller may not call, for role-based access control failures
+	Route        string   `json:"route,omitempty"`
+	Caller       string   `json:"caller,omitempty"`
+	Roles        []string `json:"roles,omitempty"`
+	AllowedRoles []string `json:"allowed_roles,omitempty"`
+}
+
+type ValidationError struct {
+	Detail string `json:"detail"`
+	// The JSON pointer of the invalid part of the request body
+	Pointer string `json:"pointer,omitempty"`
+	// Where the invalid parameter is, e.g. query or header
+	In        string `json:"in,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+}
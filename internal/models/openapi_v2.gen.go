@@ -0,0 +1,33 @@
+// Code generated by openapi-gen from api/openapi.v2.yaml; DO NOT EDIT.
+
+package models
+
+// A reading of a device, reported with the same shape whether or not it is over the threshold
+type TempReading struct {
+	DeviceId    int32   `json:"device_id"`
+	Temperature float64 `json:"temperature"`
+	Overtemp    bool    `json:"overtemp"`
+	// The epoch of the reading, in UTC. Epochs larger than 10^11 are read as milliseconds and the others as
+	// seconds, unlike the formatted_time of v1, which reads every epoch as seconds.
+	RecordedAt string `json:"recorded_at"`
+}
+
+type ErrorList struct {
+	Errors []ErrorDetail `json:"errors"`
+}
+
+type DeviceReading struct {
+	Temperature float64 `json:"temperature"`
+	Overtemp    bool    `json:"overtemp"`
+	// The epoch of the data string, in UTC, read as milliseconds when it is larger than 10^11 and as seconds
+	// otherwise.
+	RecordedAt string `json:"recorded_at"`
+	// When the server accepted the reading
+	ReceivedAt string `json:"received_at"`
+}
+
+type DeviceReadingsResponse struct {
+	DeviceId int32 `json:"device_id"`
+	// The readings of the device, newest first
+	Readings []DeviceReading `json:"readings"`
+}
@@ -0,0 +1,148 @@
+// Package problem writes the failed requests as RFC 7807 problems, or in the legacy {"error": ...} shape for the
+// clients written before the problems
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/models"
+	"github.com/sarabrajsingh/restful-openapi/internal/requestid"
+	"github.com/sarabrajsingh/restful-openapi/internal/utils"
+)
+
+const (
+	ContentType = "application/problem+json"
+	// TypeBase is the type URI of a problem without its code; every code has a section in docs/problems.md
+	TypeBase = "https://github.com/sarabrajsingh/restful-openapi/blob/main/docs/problems.md#"
+)
+
+// the machine-readable codes of the problems
+const (
+	CodeUnreadableBody        = "unreadable_body"
+	CodeInvalidJSON           = "invalid_json"
+	CodeInvalidArgumentCount  = "invalid_argument_count"
+	CodeInvalidDeviceId       = "invalid_device_id"
+	CodeInvalidEpoch          = "invalid_epoch"
+	CodeInvalidTemperatureKey = "invalid_temperature_key"
+	CodeInvalidTemperature    = "invalid_temperature"
+	CodeUnknownRoute          = "unknown_route"
+	CodeInvalidParameter      = "invalid_parameter"
+	CodeInvalidBody           = "invalid_body"
+	CodeInvalidRequest        = "invalid_request"
+	CodeUnknownDevice         = "unknown_device"
+	CodeUnauthenticated       = "unauthenticated"
+	CodeInsufficientScope     = "insufficient_scope"
+	CodeRoleNotAllowed        = "role_not_allowed"
+	CodeDeviceMismatch        = "device_mismatch"
+	CodeRateLimited           = "rate_limited"
+	CodeInternal              = "internal_error"
+	CodeResponseValidation    = "response_validation_failed"
+)
+
+type definition struct {
+	status int
+	title  string
+}
+
+var definitions = map[string]definition{
+	CodeUnreadableBody:        {http.StatusBadRequest, "Unreadable request body"},
+	CodeInvalidJSON:           {http.StatusBadRequest, "Invalid JSON"},
+	CodeInvalidArgumentCount:  {http.StatusBadRequest, "Invalid number of arguments"},
+	CodeInvalidDeviceId:       {http.StatusBadRequest, "Invalid device id"},
+	CodeInvalidEpoch:          {http.StatusBadRequest, "Invalid epoch"},
+	CodeInvalidTemperatureKey: {http.StatusBadRequest, "Mislabelled temperature"},
+	CodeInvalidTemperature:    {http.StatusBadRequest, "Invalid temperature"},
+	CodeUnknownRoute:          {http.StatusBadRequest, "Unknown route"},
+	CodeInvalidParameter:      {http.StatusBadRequest, "Invalid parameter"},
+	CodeInvalidBody:           {http.StatusBadRequest, "Invalid request body"},
+	CodeInvalidRequest:        {http.StatusBadRequest, "Invalid request"},
+	CodeUnknownDevice:         {http.StatusNotFound, "Unknown device"},
+	CodeUnauthenticated:       {http.StatusUnauthorized, "Missing or invalid credentials"},
+	CodeInsufficientScope:     {http.StatusForbidden, "Insufficient scope"},
+	CodeRoleNotAllowed:        {http.StatusForbidden, "Role not allowed"},
+	CodeDeviceMismatch:        {http.StatusForbidden, "Device mismatch"},
+	CodeRateLimited:           {http.StatusTooManyRequests, "Rate limit exceeded"},
+	CodeInternal:              {http.StatusInternalServerError, "Internal server error"},
+	CodeResponseValidation:    {http.StatusInternalServerError, "Response validation failed"},
+}
+
+// New returns the problem of code; an unknown code is reported as an internal error
+func New(code, detail string) models.Problem {
+	def, ok := definitions[code]
+	if !ok {
+		code, def = CodeInternal, definitions[CodeInternal]
+	}
+	return models.Problem{
+		Type:   TypeBase + code,
+		Title:  def.title,
+		Status: def.status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Codes lists every code along with its status, for the documentation and the tests
+func Codes() map[string]int {
+	codes := make(map[string]int, len(definitions))
+	for code, def := range definitions {
+		codes[code] = def.status
+	}
+	return codes
+}
+
+type problemsOnlyKey struct{}
+
+// ProblemsOnly marks the requests of the API versions that were never answered with the legacy shape
+func ProblemsOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, problemsOnlyKey{}, true)
+}
+
+// Legacy tells the clients that do not ask for application/problem+json, including the devices and the scripts
+// that send no Accept header or */*; they were written against the {"error": ...} shape, which stays the default of
+// v1 unless the request is marked ProblemsOnly
+func Legacy(r *http.Request) bool {
+	if problemsOnly, _ := r.Context().Value(problemsOnlyKey{}).(bool); problemsOnly {
+		return false
+	}
+	problem := false
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		// q=0 refuses the media type
+		if q, ok := params["q"]; ok {
+			if weight, err := strconv.ParseFloat(q, 64); err != nil || weight == 0 {
+				continue
+			}
+		}
+		if mediaType == ContentType {
+			problem = true
+		}
+	}
+	return !problem
+}
+
+// Write answers r with the problem, or with the legacy shape holding legacyError; the instance and the X-Request-ID
+// already set on the response are filled in
+func Write(w http.ResponseWriter, r *http.Request, p models.Problem, legacyError string) {
+	if Legacy(r) {
+		utils.WriteErrorResponse(w, legacyError, p.Status)
+		return
+	}
+
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.RequestId == "" {
+		p.RequestId = w.Header().Get(requestid.Header)
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,90 @@
+package problem_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/models"
+	"github.com/sarabrajsingh/restful-openapi/internal/problem"
+	"github.com/sarabrajsingh/restful-openapi/internal/requestid"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWrite tests that the clients get the legacy shape unless they ask for a problem
+func TestWrite(t *testing.T) {
+	testCases := []struct {
+		description string
+		accept      string
+		legacy      bool
+	}{
+		{"No Accept header", "", true},
+		{"Any media type", "*/*", true},
+		{"Problems", "application/problem+json", false},
+		{"Problems or JSON", "application/json, application/problem+json", false},
+		{"Only JSON", "application/json", true},
+		{"JSON before anything else", "application/json, text/plain, */*", true},
+		{"Problems refused", "application/json, application/problem+json;q=0", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/v1/temp", nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			assert.Equal(t, tc.legacy, problem.Legacy(req))
+
+			w := httptest.NewRecorder()
+			w.Header().Set(requestid.Header, "req-42")
+			problem.Write(w, req, problem.New(problem.CodeInvalidEpoch, "could not parse epochMS=x to an int64"), "bad request")
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			if tc.legacy {
+				var response models.Response400
+				assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+				assert.Equal(t, models.Response400{Error: "bad request", RequestId: "req-42"}, response)
+				return
+			}
+
+			assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+			var response models.Problem
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+			assert.Equal(t, models.Problem{
+				Type:      problem.TypeBase + problem.CodeInvalidEpoch,
+				Title:     "Invalid epoch",
+				Status:    http.StatusBadRequest,
+				Detail:    "could not parse epochMS=x to an int64",
+				Instance:  "/api/v1/temp",
+				Code:      problem.CodeInvalidEpoch,
+				RequestId: "req-42",
+			}, response)
+		})
+	}
+}
+
+// TestProblemsOnly tests that the requests marked ProblemsOnly get a problem whatever they accept
+func TestProblemsOnly(t *testing.T) {
+	req := httptest.NewRequest("POST", "/api/v2/temp", nil)
+	req.Header.Set("Accept", "application/json")
+	assert.True(t, problem.Legacy(req))
+
+	req = req.WithContext(problem.ProblemsOnly(req.Context()))
+	assert.False(t, problem.Legacy(req))
+
+	w := httptest.NewRecorder()
+	problem.Write(w, req, problem.New(problem.CodeInvalidEpoch, "could not parse epochMS=x to an int64"), "bad request")
+	assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+}
+
+// TestCodesAreDocumented fails when a code has no section in docs/problems.md, which its type URI points at
+func TestCodesAreDocumented(t *testing.T) {
+	docs, err := os.ReadFile("../../docs/problems.md")
+	assert.NoError(t, err)
+
+	for code := range problem.Codes() {
+		assert.Contains(t, string(docs), "\n### "+code+"\n", "document %s in docs/problems.md", code)
+	}
+}
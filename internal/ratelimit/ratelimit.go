@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that have refilled completely are forgotten
+const sweepInterval = time.Minute
+
+type Limiter interface {
+	// Allow takes a token from the bucket for key; when the bucket is empty it returns false and how long
+	// the caller has to wait for the next token
+	Allow(key string) (bool, time.Duration)
+}
+
+type bucket struct {
+	tokens     float64
+	lastRefill time.Time
+}
+
+type tokenBucketLimiter struct {
+	rate      float64
+	burst     float64
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+	mutex     *sync.Mutex
+}
+
+// NewLimiter creates a token bucket per key that refills at requestsPerSecond and holds up to burst tokens
+func NewLimiter(requestsPerSecond float64, burst int) Limiter {
+	return NewLimiterWithClock(requestsPerSecond, burst, time.Now)
+}
+
+// NewLimiterWithClock creates a Limiter with a custom time source
+func NewLimiterWithClock(requestsPerSecond float64, burst int, now func() time.Time) Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucketLimiter{
+		rate:      requestsPerSecond,
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		lastSweep: now(),
+		now:       now,
+		mutex:     &sync.Mutex{},
+	}
+}
+
+func (l *tokenBucketLimiter) Allow(key string) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, lastRefill: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.lastRefill).Seconds()*l.rate)
+	b.lastRefill = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops the buckets that are full again, since a new bucket would start out full anyway
+func (l *tokenBucketLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.lastRefill).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
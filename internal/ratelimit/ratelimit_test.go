@@ -0,0 +1,44 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Date(2024, 7, 27, 14, 0, 0, 0, time.UTC)
+	limiter := ratelimit.NewLimiterWithClock(2, 3, func() time.Time { return now })
+
+	// the bucket starts full
+	for i := 0; i < 3; i++ {
+		allowed, _ := limiter.Allow("gateway-01")
+		assert.True(t, allowed)
+	}
+
+	allowed, wait := limiter.Allow("gateway-01")
+	assert.False(t, allowed)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// other keys have their own bucket
+	allowed, _ = limiter.Allow("gateway-02")
+	assert.True(t, allowed)
+
+	// one token is back after half a second
+	now = now.Add(500 * time.Millisecond)
+	allowed, _ = limiter.Allow("gateway-01")
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow("gateway-01")
+	assert.False(t, allowed)
+
+	// the bucket never holds more than the burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		allowed, _ = limiter.Allow("gateway-01")
+		assert.True(t, allowed)
+	}
+	allowed, _ = limiter.Allow("gateway-01")
+	assert.False(t, allowed)
+}
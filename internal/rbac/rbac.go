@@ -0,0 +1,122 @@
+package rbac
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/auth"
+)
+
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+	RoleDevice   = "device"
+
+	// AllRoutes grants a role every route
+	AllRoutes = "*"
+)
+
+var knownRoles = map[string]bool{
+	RoleViewer:   true,
+	RoleOperator: true,
+	RoleAdmin:    true,
+	RoleDevice:   true,
+}
+
+// Policy maps roles to the routes they may call, and principals to the roles they hold
+type Policy struct {
+	// Roles maps a role to the Route.Names it may call
+	Roles map[string][]string `json:"roles"`
+	// Bindings maps a principal id such as apiKey:ops or bearer:reporting-service to roles, on top of
+	// the roles carried by its credentials
+	Bindings map[string][]string `json:"bindings"`
+}
+
+// LoadPolicy reads a JSON policy file
+func LoadPolicy(path string) (*Policy, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read RBAC policy %s: %w", path, err)
+	}
+
+	policy, err := ParsePolicy(contents)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse RBAC policy %s: %w", path, err)
+	}
+	return policy, nil
+}
+
+// ParsePolicy decodes a policy and rejects roles outside of viewer, operator, admin and device
+func ParsePolicy(contents []byte) (*Policy, error) {
+	var policy Policy
+	if err := json.Unmarshal(contents, &policy); err != nil {
+		return nil, err
+	}
+
+	for role := range policy.Roles {
+		if !knownRoles[role] {
+			return nil, fmt.Errorf("roles.%s: unknown role", role)
+		}
+	}
+	for principal, roles := range policy.Bindings {
+		for _, role := range roles {
+			if !knownRoles[role] {
+				return nil, fmt.Errorf("bindings.%s: unknown role %q", principal, role)
+			}
+		}
+	}
+
+	return &policy, nil
+}
+
+// RolesFor returns the roles of a caller; a request made with a bound device certificate always holds the device role
+func (p *Policy) RolesFor(principal *auth.Principal, device *auth.DeviceIdentity) []string {
+	seen := make(map[string]bool)
+	var roles []string
+	add := func(candidates []string) {
+		for _, role := range candidates {
+			if !seen[role] {
+				seen[role] = true
+				roles = append(roles, role)
+			}
+		}
+	}
+
+	if principal != nil {
+		add(principal.Roles)
+		add(p.Bindings[principal.ID()])
+	}
+	if device != nil && device.Valid {
+		add([]string{RoleDevice})
+	}
+
+	sort.Strings(roles)
+	return roles
+}
+
+// Allowed reports whether any of the roles may call the route
+func (p *Policy) Allowed(roles []string, route string) bool {
+	for _, role := range roles {
+		for _, allowed := range p.Roles[role] {
+			if allowed == route || allowed == AllRoutes {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AllowedRoles lists the roles that may call the route
+func (p *Policy) AllowedRoles(route string) []string {
+	roles := make([]string, 0)
+	for role := range p.Roles {
+		if p.Allowed([]string{role}, route) {
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
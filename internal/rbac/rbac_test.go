@@ -0,0 +1,78 @@
+package rbac_test
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/auth"
+	"github.com/sarabrajsingh/restful-openapi/internal/rbac"
+	"github.com/stretchr/testify/assert"
+)
+
+// loadDefaultPolicy loads the policy shipped in the config folder
+func loadDefaultPolicy(t *testing.T) *rbac.Policy {
+	_, currentFilePath, _, _ := runtime.Caller(0)
+	baseDir := filepath.Dir(filepath.Dir(filepath.Dir(currentFilePath)))
+
+	policy, err := rbac.LoadPolicy(filepath.Join(baseDir, "config", "rbac_policy.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+func TestPolicy_Allowed(t *testing.T) {
+	policy := loadDefaultPolicy(t)
+
+	testCases := []struct {
+		role     string
+		route    string
+		expected bool
+	}{
+		{rbac.RoleViewer, "ErrorsGet", true},
+		{rbac.RoleViewer, "ErrorsDelete", false},
+		{rbac.RoleViewer, "TempPost", false},
+		{rbac.RoleOperator, "TempPost", true},
+		{rbac.RoleOperator, "ErrorsDelete", false},
+		{rbac.RoleAdmin, "ErrorsDelete", true},
+		{rbac.RoleDevice, "TempPost", true},
+		{rbac.RoleDevice, "ErrorsGet", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.role+" "+tc.route, func(t *testing.T) {
+			assert.Equal(t, tc.expected, policy.Allowed([]string{tc.role}, tc.route))
+		})
+	}
+
+	assert.Equal(t, []string{"admin"}, policy.AllowedRoles("ErrorsDelete"))
+	assert.False(t, policy.Allowed(nil, "ErrorsGet"))
+}
+
+func TestPolicy_RolesFor(t *testing.T) {
+	policy, err := rbac.ParsePolicy([]byte(`{
+		"roles": {"viewer": ["ErrorsGet"], "admin": ["*"]},
+		"bindings": {"bearer:reporting-service": ["viewer"], "apiKey:ops": ["admin"]}
+	}`))
+	assert.NoError(t, err)
+
+	// roles from the credentials and the bindings are merged
+	principal := &auth.Principal{Name: "reporting-service", Method: "bearer", Roles: []string{"operator", "viewer"}}
+	assert.Equal(t, []string{"operator", "viewer"}, policy.RolesFor(principal, nil))
+
+	// a bound device certificate holds the device role
+	device := &auth.DeviceIdentity{DeviceId: 1234, Valid: true}
+	assert.Equal(t, []string{"device"}, policy.RolesFor(nil, device))
+
+	// bindings are per authentication method
+	assert.Empty(t, policy.RolesFor(&auth.Principal{Name: "ops", Method: "bearer"}, nil))
+}
+
+func TestParsePolicy_UnknownRole(t *testing.T) {
+	_, err := rbac.ParsePolicy([]byte(`{"roles": {"superuser": ["*"]}}`))
+	assert.Error(t, err)
+
+	_, err = rbac.ParsePolicy([]byte(`{"roles": {}, "bindings": {"apiKey:ops": ["root"]}}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,164 @@
+package reload
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/audit"
+	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+	"github.com/sarabrajsingh/restful-openapi/internal/models"
+)
+
+const (
+	// AuditAction is recorded in the audit log for every reload, successful or not
+	AuditAction = "config.reload"
+	// SignalTrigger is the actor of the reloads asked for with SIGHUP
+	SignalTrigger = "signal:SIGHUP"
+	// ChangedParameter prefixes the settings a reload changed in the parameters of its audit entry
+	ChangedParameter = "changed."
+)
+
+type Reloader interface {
+	// Reload applies the configuration again; trigger is recorded as the actor in the audit log
+	Reload(trigger string) error
+	// Run reloads on SIGHUP and whenever one of the watched files changes, until ctx is done
+	Run(ctx context.Context)
+}
+
+// fileState is what a file is compared on between two polls
+type fileState struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+type reloaderImpl struct {
+	logger     logging.Logger
+	load       func() (*config.Config, error)
+	apply      func(load func() (*config.Config, error)) (*config.Config, error)
+	auditStore audit.AuditStore
+	interval   time.Duration
+	// current is the configuration the last successful reload applied, which the next one is compared with
+	current *config.Config
+	files   map[string]fileState
+	mutex   *sync.Mutex
+}
+
+// NewReloader hands load to apply, which returns the configuration it swapped in, on SIGHUP and whenever one of the
+// files cfg reads changes, checking them every cfg.WatchInterval
+func NewReloader(logger logging.Logger, load func() (*config.Config, error), apply func(load func() (*config.Config, error)) (*config.Config, error), auditStore audit.AuditStore, cfg *config.Config) Reloader {
+	return &reloaderImpl{
+		logger:     logger,
+		load:       load,
+		apply:      apply,
+		auditStore: auditStore,
+		interval:   cfg.WatchInterval,
+		current:    cfg,
+		files:      snapshot(cfg.WatchedFiles()),
+		mutex:      &sync.Mutex{},
+	}
+}
+
+func (r *reloaderImpl) Reload(trigger string) error {
+	log := r.logger.With("trigger", trigger)
+	log.Info("reloading the configuration")
+
+	cfg, err := r.apply(r.load)
+
+	entry := models.AuditEntry{
+		Action: AuditAction,
+		Actor:  trigger,
+		Status: http.StatusOK,
+	}
+	if err != nil {
+		entry.Status = http.StatusUnprocessableEntity
+		entry.Parameters = map[string]string{"error": err.Error()}
+		log.Error("reload failed", "error", err)
+	} else {
+		entry.Parameters = map[string]string{"config_version": cfg.Version()}
+		if cfg.File != "" {
+			entry.Parameters["config_file"] = cfg.File
+		}
+		r.mutex.Lock()
+		for key, change := range cfg.Changes(r.current) {
+			entry.Parameters[ChangedParameter+key] = change
+		}
+		r.current = cfg
+		// the configuration may point at other files now
+		r.files = snapshot(cfg.WatchedFiles())
+		r.mutex.Unlock()
+	}
+	r.auditStore.Record(log, entry)
+
+	return err
+}
+
+func (r *reloaderImpl) Run(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	// a zero interval only reloads on SIGHUP
+	var poll <-chan time.Time
+	if r.interval > 0 {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			r.Reload(SignalTrigger)
+		case <-poll:
+			if file, changed := r.changed(); changed {
+				r.Reload("file:" + file)
+			}
+		}
+	}
+}
+
+// changed returns the first watched file that differs from the last poll; every file is compared again afterwards,
+// so that a file that fails to load is only retried once it changes again
+func (r *reloaderImpl) changed() (string, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	current := snapshot(keys(r.files))
+	for file, state := range current {
+		if r.files[file] != state {
+			r.files = current
+			return file, true
+		}
+	}
+	return "", false
+}
+
+func snapshot(files []string) map[string]fileState {
+	states := make(map[string]fileState, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			states[file] = fileState{}
+			continue
+		}
+		states[file] = fileState{modTime: info.ModTime(), size: info.Size(), exists: true}
+	}
+	return states
+}
+
+func keys(files map[string]fileState) []string {
+	names := make([]string, 0, len(files))
+	for file := range files {
+		names = append(names, file)
+	}
+	return names
+}
@@ -0,0 +1,143 @@
+package reload_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+	"github.com/sarabrajsingh/restful-openapi/internal/models"
+	"github.com/sarabrajsingh/restful-openapi/internal/reload"
+	"github.com/sarabrajsingh/restful-openapi/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestReload tests that every reload is audited with its outcome
+func TestReload(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
+
+	mockLogger.EXPECT().Info(gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Error(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+
+	cfg := config.Defaults()
+	applyErr := errors.New("Failed to validate OpenAPI spec")
+	var applied []*config.Config
+	apply := func(load func() (*config.Config, error)) (*config.Config, error) {
+		cfg, err := load()
+		if err != nil {
+			return nil, err
+		}
+		applied = append(applied, cfg)
+		if applyErr != nil {
+			return nil, applyErr
+		}
+		return cfg, nil
+	}
+	load := func() (*config.Config, error) {
+		return cfg, nil
+	}
+
+	reloader := reload.NewReloader(mockLogger, load, apply, mockAuditStore, cfg)
+
+	mockAuditStore.EXPECT().Record(gomock.Any(), gomock.Any()).Do(func(log logging.Logger, entry models.AuditEntry) {
+		assert.Equal(t, reload.AuditAction, entry.Action)
+		assert.Equal(t, reload.SignalTrigger, entry.Actor)
+		assert.Equal(t, http.StatusUnprocessableEntity, entry.Status)
+		assert.Equal(t, applyErr.Error(), entry.Parameters["error"])
+	}).Times(1)
+	assert.ErrorIs(t, reloader.Reload(reload.SignalTrigger), applyErr)
+
+	// a successful reload records the settings it changed, against the configuration applied last
+	applyErr = nil
+	cfg = config.Defaults()
+	cfg.OvertempThreshold = 35
+	mockAuditStore.EXPECT().Record(gomock.Any(), gomock.Any()).Do(func(log logging.Logger, entry models.AuditEntry) {
+		assert.Equal(t, http.StatusOK, entry.Status)
+		assert.Equal(t, map[string]string{
+			"config_version": cfg.Version(),
+			reload.ChangedParameter + "overtemp_threshold": fmt.Sprintf("%v -> 35", config.Defaults().OvertempThreshold),
+		}, entry.Parameters)
+	}).Times(1)
+	assert.NoError(t, reloader.Reload(reload.SignalTrigger))
+	assert.Len(t, applied, 2)
+
+	mockAuditStore.EXPECT().Record(gomock.Any(), gomock.Any()).Do(func(log logging.Logger, entry models.AuditEntry) {
+		assert.Equal(t, map[string]string{"config_version": cfg.Version()}, entry.Parameters)
+	}).Times(1)
+	assert.NoError(t, reloader.Reload(reload.SignalTrigger))
+	assert.Len(t, applied, 3)
+
+	// a configuration that does not load is never applied
+	load = func() (*config.Config, error) {
+		return nil, errors.New("port: \"http\" is not a port number")
+	}
+	reloader = reload.NewReloader(mockLogger, load, apply, mockAuditStore, cfg)
+	mockAuditStore.EXPECT().Record(gomock.Any(), gomock.Any()).Do(func(log logging.Logger, entry models.AuditEntry) {
+		assert.Equal(t, http.StatusUnprocessableEntity, entry.Status)
+	}).Times(1)
+	assert.Error(t, reloader.Reload(reload.SignalTrigger))
+	assert.Len(t, applied, 3)
+}
+
+// TestRunWatchesFiles tests that a change to a watched file triggers a reload
+func TestRunWatchesFiles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
+
+	mockLogger.EXPECT().Info(gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("port: \"8080\"\n"), 0600))
+
+	cfg := config.Defaults()
+	cfg.File = file
+	cfg.WatchInterval = 10 * time.Millisecond
+
+	load := func() (*config.Config, error) {
+		return cfg, nil
+	}
+	apply := func(load func() (*config.Config, error)) (*config.Config, error) {
+		return load()
+	}
+
+	reloaded := make(chan models.AuditEntry, 1)
+	mockAuditStore.EXPECT().Record(gomock.Any(), gomock.Any()).Do(func(log logging.Logger, entry models.AuditEntry) {
+		reloaded <- entry
+	}).Times(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reload.NewReloader(mockLogger, load, apply, mockAuditStore, cfg).Run(ctx)
+
+	// nothing changed yet
+	select {
+	case <-reloaded:
+		t.Fatal("expected no reload before the file changes")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.NoError(t, os.WriteFile(file, []byte("port: \"9090\"\nlog_level: debug\n"), 0600))
+	select {
+	case entry := <-reloaded:
+		assert.Equal(t, "file:"+file, entry.Actor)
+		assert.Equal(t, file, entry.Parameters["config_file"])
+	case <-time.After(time.Second):
+		t.Fatal("expected the change to trigger a reload")
+	}
+}
@@ -0,0 +1,34 @@
+package requestid_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/requestid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	first := requestid.New()
+	second := requestid.New()
+
+	assert.Len(t, first, 32)
+	assert.True(t, requestid.Valid(first))
+	assert.NotEqual(t, first, second)
+}
+
+func TestValid(t *testing.T) {
+	assert.True(t, requestid.Valid("gateway-01:7f3a.42_b"))
+	assert.False(t, requestid.Valid(""))
+	assert.False(t, requestid.Valid("has space"))
+	assert.False(t, requestid.Valid("line\nbreak"))
+	assert.False(t, requestid.Valid(strings.Repeat("a", requestid.MaxLength+1)))
+}
+
+func TestContext(t *testing.T) {
+	assert.Equal(t, "", requestid.FromContext(context.Background()))
+
+	ctx := requestid.NewContext(context.Background(), "abc")
+	assert.Equal(t, "abc", requestid.FromContext(ctx))
+}
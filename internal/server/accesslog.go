@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/accesslog"
+	"github.com/sarabrajsingh/restful-openapi/internal/auth"
+	"github.com/sarabrajsingh/restful-openapi/internal/requestid"
+)
+
+// AccessLogMiddleware logs every request once its response has been sent, with the status, size and latency
+func AccessLogMiddleware(accessLogger accesslog.AccessLogger, inner http.Handler, name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// the authenticators further in record the caller in this context
+		r = r.WithContext(auth.NewContext(r.Context()))
+
+		recorder := newResponseRecorder(w)
+		inner.ServeHTTP(recorder, r)
+
+		caller := ""
+		if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+			caller = principal.ID()
+		}
+
+		accessLogger.Log(accesslog.Entry{
+			Time:       start,
+			RemoteAddr: r.RemoteAddr,
+			Caller:     caller,
+			Method:     r.Method,
+			URI:        r.RequestURI,
+			Proto:      r.Proto,
+			Status:     recorder.status,
+			Bytes:      recorder.bytes,
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+			Route:      name,
+			RequestId:  requestid.FromContext(r.Context()),
+			Latency:    time.Since(start),
+		})
+	})
+}
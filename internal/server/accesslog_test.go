@@ -0,0 +1,52 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sarabrajsingh/restful-openapi/internal/accesslog"
+	"github.com/sarabrajsingh/restful-openapi/internal/auth"
+	"github.com/sarabrajsingh/restful-openapi/internal/requestid"
+	"github.com/sarabrajsingh/restful-openapi/internal/server"
+	"github.com/sarabrajsingh/restful-openapi/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAccessLogMiddleware tests that the entry is logged after the response, with the caller set further in
+func TestAccessLogMiddleware(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAccessLogger := mocks.NewMockAccessLogger(ctrl)
+	mockAccessLogger.EXPECT().Log(gomock.Any()).Do(func(entry accesslog.Entry) {
+		assert.Equal(t, "ErrorsDelete", entry.Route)
+		assert.Equal(t, http.StatusAccepted, entry.Status)
+		assert.Equal(t, 5, entry.Bytes)
+		assert.Equal(t, "apiKey:ops", entry.Caller)
+		assert.Equal(t, "DELETE", entry.Method)
+		assert.Equal(t, "/api/v1/errors", entry.URI)
+		assert.Equal(t, "curl/8.4.0", entry.UserAgent)
+		assert.Equal(t, "req-1", entry.RequestId)
+	}).Times(1)
+
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// stands in for the OpenAPI middleware authenticating the caller
+		r = r.WithContext(auth.NewContext(r.Context()))
+		auth.SetPrincipal(r.Context(), &auth.Principal{Name: "ops", Method: "apiKey"})
+
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("hello"))
+	})
+
+	req := httptest.NewRequest("DELETE", "/api/v1/errors", nil)
+	req.Header.Set("User-Agent", "curl/8.4.0")
+	req = req.WithContext(requestid.NewContext(req.Context(), "req-1"))
+
+	w := httptest.NewRecorder()
+	server.AccessLogMiddleware(mockAccessLogger, inner, "ErrorsDelete").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "hello", w.Body.String())
+}
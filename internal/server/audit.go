@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sarabrajsingh/restful-openapi/internal/audit"
+	"github.com/sarabrajsingh/restful-openapi/internal/auth"
+	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+	"github.com/sarabrajsingh/restful-openapi/internal/models"
+	"github.com/sarabrajsingh/restful-openapi/internal/requestid"
+)
+
+// AuditMiddleware records who called a destructive or configuration-changing route, from where, with which
+// parameters and with what outcome
+func AuditMiddleware(logger logging.Logger, store audit.AuditStore, action string, inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := newResponseRecorder(w)
+		inner.ServeHTTP(recorder, r)
+
+		actor := "anonymous"
+		if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+			actor = principal.ID()
+		}
+
+		parameters := make(map[string]string)
+		for key, values := range r.URL.Query() {
+			parameters[key] = strings.Join(values, ",")
+		}
+		for key, value := range mux.Vars(r) {
+			parameters[key] = value
+		}
+
+		store.Record(logging.FromContext(r.Context(), logger), models.AuditEntry{
+			Time:       time.Now().UTC().Format(time.RFC3339),
+			Action:     action,
+			Actor:      actor,
+			RemoteAddr: r.RemoteAddr,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Parameters: parameters,
+			Status:     recorder.status,
+			RequestId:  requestid.FromContext(r.Context()),
+		})
+	})
+}
@@ -1,7 +1,15 @@
 package server
 
-import "github.com/gorilla/mux"
+import (
+	"github.com/gorilla/mux"
+	"github.com/sarabrajsingh/restful-openapi/config"
+)
 
 type Server interface {
 	NewRouter() *mux.Router
+	// StartDraining fails the readiness probe ahead of a shutdown
+	StartDraining()
+	// Reload loads the configuration and swaps in its routes, or keeps the current ones and returns why it could not
+	// be loaded
+	Reload(load func() (*config.Config, error)) (*config.Config, error)
 }
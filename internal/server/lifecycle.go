@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+)
+
+// ShutdownFunc flushes a store or a background worker once the listener has stopped
+type ShutdownFunc func(context.Context) error
+
+type Lifecycle interface {
+	// OnShutdown registers a flush, run in the reverse order of registration
+	OnShutdown(name string, shutdown ShutdownFunc)
+	// Run serves until ctx is cancelled or the listener fails, then drains the server and runs the flushes
+	Run(ctx context.Context) error
+}
+
+type shutdownHook struct {
+	name     string
+	shutdown ShutdownFunc
+}
+
+type lifecycleImpl struct {
+	logger     logging.Logger
+	config     config.HTTPServerConfig
+	server     Server
+	httpServer *http.Server
+	hooks      []shutdownHook
+}
+
+// NewHTTPServer creates the listener with the configured timeouts
+func NewHTTPServer(cfg *config.Config, handler http.Handler, tlsConfig *tls.Config) *http.Server {
+	return &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: cfg.HTTPServer.ReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTPServer.ReadTimeout,
+		WriteTimeout:      cfg.HTTPServer.WriteTimeout,
+		IdleTimeout:       cfg.HTTPServer.IdleTimeout,
+	}
+}
+
+// NewLifecycle creates a Lifecycle serving httpServer, which drains server before shutting down
+func NewLifecycle(logger logging.Logger, cfg config.HTTPServerConfig, server Server, httpServer *http.Server) Lifecycle {
+	return &lifecycleImpl{
+		logger:     logger,
+		config:     cfg,
+		server:     server,
+		httpServer: httpServer,
+	}
+}
+
+func (l *lifecycleImpl) OnShutdown(name string, shutdown ShutdownFunc) {
+	l.hooks = append(l.hooks, shutdownHook{name: name, shutdown: shutdown})
+}
+
+func (l *lifecycleImpl) Run(ctx context.Context) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		if l.httpServer.TLSConfig != nil {
+			// the certificate is already loaded into the TLS config
+			serveErr <- l.httpServer.ListenAndServeTLS("", "")
+			return
+		}
+		serveErr <- l.httpServer.ListenAndServe()
+	}()
+
+	var err error
+	select {
+	case err = <-serveErr:
+		// the listener failed on its own, there is nothing left to drain
+		l.logger.Error("listener failed", "error", err)
+		err = fmt.Errorf("could not serve: %w", err)
+	case <-ctx.Done():
+		l.drain()
+	}
+
+	// in-flight requests and the flushes share the shutdown timeout
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), l.config.ShutdownTimeout)
+	defer cancel()
+
+	if shutdownErr := l.httpServer.Shutdown(shutdownCtx); shutdownErr != nil {
+		l.logger.Error("in-flight requests did not finish in time", "timeout", l.config.ShutdownTimeout, "error", shutdownErr)
+		err = errors.Join(err, fmt.Errorf("could not shut down the listener: %w", shutdownErr))
+	}
+
+	for i := len(l.hooks) - 1; i >= 0; i-- {
+		hook := l.hooks[i]
+		if hookErr := hook.shutdown(shutdownCtx); hookErr != nil {
+			l.logger.Error("could not flush on shutdown", "component", hook.name, "error", hookErr)
+			err = errors.Join(err, fmt.Errorf("could not flush %s: %w", hook.name, hookErr))
+		}
+	}
+
+	l.logger.Info("API server stopped")
+	return err
+}
+
+// drain fails the readiness probe and keeps serving for the drain period, so that the load balancer
+// stops routing new requests to the server before the listener is closed
+func (l *lifecycleImpl) drain() {
+	l.logger.Info("shutting down", "drain_period", l.config.DrainPeriod)
+	l.server.StartDraining()
+	time.Sleep(l.config.DrainPeriod)
+}
@@ -0,0 +1,79 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/server"
+	"github.com/sarabrajsingh/restful-openapi/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLifecycleShutdown tests that a cancelled lifecycle drains the server, then runs the flushes newest first
+func TestLifecycleShutdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockServer := mocks.NewMockServer(ctrl)
+
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Error(gomock.Any(), gomock.Any()).AnyTimes()
+	mockServer.EXPECT().StartDraining().Times(1)
+
+	cfg := config.DefaultHTTPServerConfig()
+	cfg.DrainPeriod = 10 * time.Millisecond
+	httpServer := &http.Server{Addr: "127.0.0.1:0"}
+
+	var flushed []string
+	lifecycle := server.NewLifecycle(mockLogger, cfg, mockServer, httpServer)
+	lifecycle.OnShutdown("tracing", func(ctx context.Context) error {
+		flushed = append(flushed, "tracing")
+		return nil
+	})
+	lifecycle.OnShutdown("audit", func(ctx context.Context) error {
+		flushed = append(flushed, "audit")
+		return errors.New("disk full")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := lifecycle.Run(ctx)
+	assert.ErrorContains(t, err, "could not flush audit: disk full")
+	assert.Equal(t, []string{"audit", "tracing"}, flushed)
+}
+
+// TestLifecycleListenerFailure tests that the flushes still run when the listener cannot be opened
+func TestLifecycleListenerFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockServer := mocks.NewMockServer(ctrl)
+
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Error(gomock.Any(), gomock.Any()).AnyTimes()
+
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.Port = "-1"
+	httpServer := server.NewHTTPServer(cfg, http.NotFoundHandler(), nil)
+	assert.Equal(t, cfg.HTTPServer.ReadHeaderTimeout, httpServer.ReadHeaderTimeout)
+
+	flushed := false
+	lifecycle := server.NewLifecycle(mockLogger, cfg.HTTPServer, mockServer, httpServer)
+	lifecycle.OnShutdown("audit", func(ctx context.Context) error {
+		flushed = true
+		return nil
+	})
+
+	err = lifecycle.Run(context.Background())
+	assert.ErrorContains(t, err, "could not serve")
+	assert.True(t, flushed)
+}
@@ -0,0 +1,21 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/metrics"
+)
+
+// MetricsMiddleware counts every request and its latency under the route name, the version of the API and the
+// response status
+func MetricsMiddleware(m metrics.Metrics, inner http.Handler, name, apiVersion string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		recorder := newResponseRecorder(w)
+		inner.ServeHTTP(recorder, r)
+
+		m.ObserveRequest(name, apiVersion, recorder.status, time.Since(start))
+	})
+}
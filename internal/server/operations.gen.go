@@ -0,0 +1,57 @@
+// Code generated by openapi-gen from api/openapi.yaml; DO NOT EDIT.
+
+package server
+
+import "net/http"
+
+// The operationIds of the contract, which also name the routes in the RBAC policy, the rate limits, the metrics and
+// the access log
+const (
+	OperationIndex           = "Index"
+	OperationTempPost        = "TempPost"
+	OperationErrorsGet       = "ErrorsGet"
+	OperationErrorsDelete    = "ErrorsDelete"
+	OperationFleetSummaryGet = "FleetSummaryGet"
+	OperationAuditGet        = "AuditGet"
+	OperationVersionGet      = "VersionGet"
+)
+
+// Handlers has a field for every operation of the contract; a nil handler fails the start up
+type Handlers struct {
+	// Index serves GET /: Home Page
+	Index http.HandlerFunc
+	// TempPost serves POST /temp: An endpoint that accepts a user request for interpretation
+	TempPost http.HandlerFunc
+	// ErrorsGet serves GET /errors: Get errors
+	ErrorsGet http.HandlerFunc
+	// ErrorsDelete serves DELETE /errors: Clears the error buffer
+	ErrorsDelete http.HandlerFunc
+	// FleetSummaryGet serves GET /fleet/summary: Fleet-wide summary
+	FleetSummaryGet http.HandlerFunc
+	// AuditGet serves GET /audit: Audit log
+	AuditGet http.HandlerFunc
+	// VersionGet serves GET /admin/version: Active configuration and contract
+	VersionGet http.HandlerFunc
+}
+
+// Handler returns the handler of an operationId, and false when the operation was not in the contract the code was
+// generated from
+func (h *Handlers) Handler(operationId string) (http.HandlerFunc, bool) {
+	switch operationId {
+	case OperationIndex:
+		return h.Index, true
+	case OperationTempPost:
+		return h.TempPost, true
+	case OperationErrorsGet:
+		return h.ErrorsGet, true
+	case OperationErrorsDelete:
+		return h.ErrorsDelete, true
+	case OperationFleetSummaryGet:
+		return h.FleetSummaryGet, true
+	case OperationAuditGet:
+		return h.AuditGet, true
+	case OperationVersionGet:
+		return h.VersionGet, true
+	}
+	return nil, false
+}
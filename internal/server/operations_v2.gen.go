@@ -0,0 +1,57 @@
+// Code generated by openapi-gen from api/openapi.v2.yaml; DO NOT EDIT.
+
+package server
+
+import "net/http"
+
+// The operationIds of the contract, which also name the routes in the RBAC policy, the rate limits, the metrics and
+// the access log
+const (
+	OperationV2TempPost          = "TempPost"
+	OperationV2ErrorsGet         = "ErrorsGet"
+	OperationV2ErrorsDelete      = "ErrorsDelete"
+	OperationV2FleetSummaryGet   = "FleetSummaryGet"
+	OperationV2DeviceReadingsGet = "DeviceReadingsGet"
+	OperationV2AuditGet          = "AuditGet"
+	OperationV2VersionGet        = "VersionGet"
+)
+
+// HandlersV2 has a field for every operation of the contract; a nil handler fails the start up
+type HandlersV2 struct {
+	// TempPost serves POST /temp: Ingests a reading of a device
+	TempPost http.HandlerFunc
+	// ErrorsGet serves GET /errors: Get errors
+	ErrorsGet http.HandlerFunc
+	// ErrorsDelete serves DELETE /errors: Clears the error buffer
+	ErrorsDelete http.HandlerFunc
+	// FleetSummaryGet serves GET /fleet/summary: Fleet-wide summary
+	FleetSummaryGet http.HandlerFunc
+	// DeviceReadingsGet serves GET /devices/{device_id}/readings: Readings of a device
+	DeviceReadingsGet http.HandlerFunc
+	// AuditGet serves GET /audit: Audit log
+	AuditGet http.HandlerFunc
+	// VersionGet serves GET /admin/version: Active configuration and contracts
+	VersionGet http.HandlerFunc
+}
+
+// Handler returns the handler of an operationId, and false when the operation was not in the contract the code was
+// generated from
+func (h *HandlersV2) Handler(operationId string) (http.HandlerFunc, bool) {
+	switch operationId {
+	case OperationV2TempPost:
+		return h.TempPost, true
+	case OperationV2ErrorsGet:
+		return h.ErrorsGet, true
+	case OperationV2ErrorsDelete:
+		return h.ErrorsDelete, true
+	case OperationV2FleetSummaryGet:
+		return h.FleetSummaryGet, true
+	case OperationV2DeviceReadingsGet:
+		return h.DeviceReadingsGet, true
+	case OperationV2AuditGet:
+		return h.AuditGet, true
+	case OperationV2VersionGet:
+		return h.VersionGet, true
+	}
+	return nil, false
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/auth"
+	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+	"github.com/sarabrajsingh/restful-openapi/internal/models"
+	"github.com/sarabrajsingh/restful-openapi/internal/problem"
+	"github.com/sarabrajsingh/restful-openapi/internal/ratelimit"
+	"github.com/sarabrajsingh/restful-openapi/internal/utils"
+)
+
+// RateLimitMiddleware rejects requests over the route's limit with a 429 and a Retry-After header
+func RateLimitMiddleware(logger logging.Logger, limiter ratelimit.Limiter, keyFunc func(*http.Request) string, inner http.Handler, name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := keyFunc(r)
+
+		allowed, wait := limiter.Allow(key)
+		if !allowed {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+
+			logging.FromContext(r.Context(), logger).Warn("Rate limit exceeded", "key", key, "route", name, "retry_after", retryAfter)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			problem.Write(w, r, problem.New(problem.CodeRateLimited, fmt.Sprintf("retry in %d seconds", retryAfter)), "rate limit exceeded")
+			return
+		}
+
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitKeyFunc returns the function that picks the bucket of a request for the configured key
+func rateLimitKeyFunc(key string) func(*http.Request) string {
+	switch key {
+	case config.RateLimitKeyRemote:
+		return remoteKey
+	case config.RateLimitKeyDevice:
+		return deviceKey
+	default:
+		return clientKey
+	}
+}
+
+func remoteKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "remote:" + host
+}
+
+// clientKey uses the authenticated caller so that several devices behind one NAT don't share a bucket
+func clientKey(r *http.Request) string {
+	if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+		return principal.ID()
+	}
+	return remoteKey(r)
+}
+
+// deviceKey peeks at the device id of a /temp payload so that the devices behind one gateway don't share a bucket.
+// Only a payload that parses as a reading gets the bucket of its device, since the id of a malformed one is
+// whatever the sender made up; the rest are limited per client, which keeps a gateway sending garbage under
+// rotating ids from filling the ErrorStore. The bucket of a device is also scoped to the client, so that one
+// caller can't use up the bucket of another caller's device. The ids of well-formed readings are still the sender's
+// choice, which is why the devices of a client also share the bucket of its client_requests_per_second.
+func deviceKey(r *http.Request) string {
+	if r.Body == nil {
+		return clientKey(r)
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return clientKey(r)
+	}
+
+	var payload models.TempPostBody
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return clientKey(r)
+	}
+
+	reading, err := utils.PayloadParserHelper(payload.Data)
+	if err != nil {
+		return clientKey(r)
+	}
+	return clientKey(r) + "/device:" + strconv.FormatInt(int64(reading.DeviceId), 10)
+}
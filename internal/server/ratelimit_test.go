@@ -0,0 +1,168 @@
+package server_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/server"
+	"github.com/sarabrajsingh/restful-openapi/internal/utils"
+	"github.com/sarabrajsingh/restful-openapi/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRateLimitPerDevice tests that /temp is limited per device id, and that payloads without a device id
+// share the bucket of the client that sent them
+func TestRateLimitPerDevice(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Create mock dependencies
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
+
+	// Set up mock expectations
+	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockLogger.EXPECT().Println(gomock.Any()).AnyTimes()
+	mockFleetStore.EXPECT().RecordReading(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	mockErrorStore.EXPECT().AddError(gomock.Any(), gomock.Any(), gomock.Any()).Times(2)
+
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.Auth.Disabled = true
+	// a slow refill keeps the test deterministic
+	cfg.RateLimits = map[string]config.RateLimit{
+		"TempPost": {RequestsPerSecond: 0.001, Burst: 2, Key: config.RateLimitKeyDevice},
+	}
+	srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, utils.DefaultBodyReader)
+
+	testServer := httptest.NewServer(srv.NewRouter())
+	defer testServer.Close()
+
+	post := func(data string) *http.Response {
+		body := fmt.Sprintf(`{"data":"%s"}`, data)
+		resp, err := http.Post(testServer.URL+"/api/v1/temp", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	assert.Equal(t, http.StatusOK, post("1234:1721964434:'Temperature':95.0").StatusCode)
+	assert.Equal(t, http.StatusOK, post("1234:1721964434:'Temperature':95.0").StatusCode)
+
+	resp := post("1234:1721964434:'Temperature':95.0")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+
+	// another device is not affected
+	assert.Equal(t, http.StatusOK, post("4321:1721964434:'Temperature':95.0").StatusCode)
+
+	// garbage is limited per client, so it can't flush the error buffer
+	assert.Equal(t, http.StatusBadRequest, post("garbage").StatusCode)
+	assert.Equal(t, http.StatusBadRequest, post("garbage").StatusCode)
+	assert.Equal(t, http.StatusTooManyRequests, post("garbage").StatusCode)
+
+	// so is a malformed reading, whatever device id it claims
+	assert.Equal(t, http.StatusTooManyRequests, post("5678:1721964434:'Temperature':hot").StatusCode)
+}
+
+// TestRateLimitRotatingDeviceIds tests that malformed readings can't dodge the limit by claiming a new device id
+// each time
+func TestRateLimitRotatingDeviceIds(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Create mock dependencies
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
+
+	// Set up mock expectations
+	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockLogger.EXPECT().Println(gomock.Any()).AnyTimes()
+	// only the burst of the client reaches the error buffer
+	mockErrorStore.EXPECT().AddError(gomock.Any(), gomock.Any(), gomock.Any()).Times(2)
+
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.Auth.Disabled = true
+	cfg.RateLimits = map[string]config.RateLimit{
+		"TempPost": {RequestsPerSecond: 0.001, Burst: 2, Key: config.RateLimitKeyDevice},
+	}
+	srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, utils.DefaultBodyReader)
+
+	testServer := httptest.NewServer(srv.NewRouter())
+	defer testServer.Close()
+
+	var statuses []int
+	for id := 1; id <= 5; id++ {
+		body := fmt.Sprintf(`{"data":"%d:x"}`, id)
+		resp, err := http.Post(testServer.URL+"/api/v1/temp", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		statuses = append(statuses, resp.StatusCode)
+	}
+	assert.Equal(t, []int{http.StatusBadRequest, http.StatusBadRequest, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests}, statuses)
+}
+
+// TestRateLimitClientOfDevices tests that well-formed readings can't dodge the limit by claiming a new device id each
+// time, since the devices of a client share its bucket
+func TestRateLimitClientOfDevices(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Create mock dependencies
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
+
+	// Set up mock expectations
+	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockLogger.EXPECT().Println(gomock.Any()).AnyTimes()
+	// only the burst of the client is ingested
+	mockFleetStore.EXPECT().RecordReading(gomock.Any(), gomock.Any(), gomock.Any()).Times(3)
+
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.Auth.Disabled = true
+	cfg.RateLimits = map[string]config.RateLimit{
+		"TempPost": {RequestsPerSecond: 0.001, Burst: 2, Key: config.RateLimitKeyDevice, ClientRequestsPerSecond: 0.001, ClientBurst: 3},
+	}
+	srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, utils.DefaultBodyReader)
+
+	testServer := httptest.NewServer(srv.NewRouter())
+	defer testServer.Close()
+
+	var statuses []int
+	for id := 1; id <= 6; id++ {
+		body := fmt.Sprintf(`{"data":"%d:1721964434:'Temperature':95.0"}`, id)
+		resp, err := http.Post(testServer.URL+"/api/v1/temp", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		statuses = append(statuses, resp.StatusCode)
+	}
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests}, statuses)
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/auth"
+	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+	"github.com/sarabrajsingh/restful-openapi/internal/models"
+	"github.com/sarabrajsingh/restful-openapi/internal/problem"
+	"github.com/sarabrajsingh/restful-openapi/internal/rbac"
+	"github.com/sarabrajsingh/restful-openapi/internal/requestid"
+)
+
+// AuthorizationMiddleware only lets callers holding a role allowed by the policy reach the route
+func AuthorizationMiddleware(logger logging.Logger, policy *rbac.Policy, inner http.Handler, name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := auth.PrincipalFromContext(r.Context())
+		device, _ := auth.DeviceIdentityFromContext(r.Context())
+
+		roles := policy.RolesFor(principal, device)
+		if policy.Allowed(roles, name) {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		caller := "anonymous"
+		if principal != nil {
+			caller = principal.ID()
+		} else if device != nil && device.Valid {
+			caller = "device:" + strconv.Itoa(int(device.DeviceId))
+		}
+
+		logging.FromContext(r.Context(), logger).Warn("Authorization denied", "caller", caller, "route", name, "roles", strings.Join(roles, ","))
+
+		if roles == nil {
+			roles = []string{}
+		}
+		if problem.Legacy(r) {
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(models.Forbidden403{
+				Error:        "forbidden",
+				Route:        name,
+				Caller:       caller,
+				Roles:        roles,
+				AllowedRoles: policy.AllowedRoles(name),
+				RequestId:    requestid.FromContext(r.Context()),
+			})
+			return
+		}
+
+		p := problem.New(problem.CodeRoleNotAllowed, fmt.Sprintf("%s may not call %s", caller, name))
+		p.Route = name
+		p.Caller = caller
+		p.Roles = roles
+		p.AllowedRoles = policy.AllowedRoles(name)
+		p.RequestId = requestid.FromContext(r.Context())
+		problem.Write(w, r, p, "")
+	})
+}
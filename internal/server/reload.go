@@ -0,0 +1,133 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/models"
+	"github.com/sarabrajsingh/restful-openapi/internal/ratelimit"
+)
+
+// routerState is everything a reload swaps at once
+type routerState struct {
+	router        *mux.Router
+	config        *config.Config
+	configVersion string
+	// versions are the versions of the API in the order of versionSources, v1 first
+	versions []*apiVersion
+	loadedAt time.Time
+}
+
+func newRouterState(router *mux.Router, cfg *config.Config, versions []*apiVersion) *routerState {
+	return &routerState{
+		router:        router,
+		config:        cfg,
+		configVersion: cfg.Version(),
+		versions:      versions,
+		loadedAt:      time.Now().UTC(),
+	}
+}
+
+type rateLimiter struct {
+	settings config.RateLimit
+	limiter  ratelimit.Limiter
+}
+
+// reloadStatus serializes reloads and remembers how the last one went
+type reloadStatus struct {
+	reloadMutex *sync.Mutex
+	mutex       *sync.Mutex
+	reloads     int
+	lastReload  time.Time
+	lastError   error
+	// limiters keeps the buckets of a route across reloads that leave its rate limit unchanged
+	limiters map[string]rateLimiter
+}
+
+func newReloadStatus() *reloadStatus {
+	return &reloadStatus{
+		reloadMutex: &sync.Mutex{},
+		mutex:       &sync.Mutex{},
+		limiters:    map[string]rateLimiter{},
+	}
+}
+
+func (rs *reloadStatus) limiter(routeName string, settings config.RateLimit) ratelimit.Limiter {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if current, ok := rs.limiters[routeName]; ok && current.settings == settings {
+		return current.limiter
+	}
+	limiter := ratelimit.NewLimiter(settings.RequestsPerSecond, settings.Burst)
+	rs.limiters[routeName] = rateLimiter{settings: settings, limiter: limiter}
+	return limiter
+}
+
+func (rs *reloadStatus) record(err error) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	rs.lastReload = time.Now().UTC()
+	rs.lastError = err
+	if err == nil {
+		rs.reloads++
+	}
+}
+
+// Reload builds the routes for the configuration returned by load and swaps them in; when anything fails to load the
+// current routes keep serving, but the readiness probe reports the failure until a reload succeeds
+func (s *serverImpl) Reload(load func() (*config.Config, error)) (*config.Config, error) {
+	s.reloader.reloadMutex.Lock()
+	defer s.reloader.reloadMutex.Unlock()
+
+	cfg, err := load()
+	var state *routerState
+	if err == nil {
+		state, err = s.buildRouter(cfg)
+	}
+	s.reloader.record(err)
+	s.health.SetSpecification(err)
+	if err != nil {
+		s.logger.Error("reload failed, the current configuration stays active", "error", err)
+		return nil, err
+	}
+
+	previous := s.state.Swap(state)
+	if previous != nil {
+		for _, key := range cfg.RestartRequired(previous.config) {
+			s.logger.Warn("setting changed, it takes effect after a restart", "key", key)
+		}
+	}
+	s.logger.Info("configuration reloaded", "config_version", state.configVersion, "spec_version", state.versions[0].specVersion)
+	return cfg, nil
+}
+
+// Version describes the configuration and the contract the server is running with
+func (s *serverImpl) Version() models.VersionResponse {
+	state := s.state.Load()
+
+	s.reloader.mutex.Lock()
+	defer s.reloader.mutex.Unlock()
+
+	response := models.VersionResponse{
+		ConfigVersion: state.configVersion,
+		ConfigFile:    state.config.File,
+		SpecVersion:   state.versions[0].specVersion,
+		APIVersion:    state.versions[0].specification.Info.Version,
+		LoadedAt:      state.loadedAt.Format(time.RFC3339),
+		Reloads:       s.reloader.reloads,
+	}
+	for _, version := range state.versions {
+		response.Versions = append(response.Versions, version.describe())
+	}
+	if !s.reloader.lastReload.IsZero() {
+		response.LastReloadAt = s.reloader.lastReload.Format(time.RFC3339)
+	}
+	if s.reloader.lastError != nil {
+		response.LastReloadError = s.reloader.lastError.Error()
+	}
+	return response
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+	"github.com/sarabrajsingh/restful-openapi/internal/requestid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDMiddleware accepts the caller's X-Request-ID or generates one, echoes it in the response and
+// places it, together with a Logger that adds it to every line, in the request context
+func RequestIDMiddleware(logger logging.Logger, inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		// set before the inner handlers run so that error responses can pick it up as well
+		w.Header().Set(requestid.Header, id)
+
+		fields := []interface{}{"request_id", id}
+		// ties the log lines to the trace when one is being recorded
+		if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.IsSampled() {
+			fields = append(fields, "trace_id", spanContext.TraceID().String())
+		}
+
+		ctx := requestid.NewContext(r.Context(), id)
+		ctx = logging.NewContext(ctx, logger.With(fields...))
+		inner.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
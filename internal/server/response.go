@@ -0,0 +1,79 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// responseRecorder captures the status code and size of a response on its way to the client
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	rr.status = status
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	n, err := rr.ResponseWriter.Write(b)
+	rr.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// responseBuffer holds a response back until it has been validated against the contract
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// newResponseBuffer starts from the headers already set on w, e.g. the X-Request-ID
+func newResponseBuffer(w http.ResponseWriter) *responseBuffer {
+	return &responseBuffer{header: w.Header().Clone()}
+}
+
+func (rb *responseBuffer) Header() http.Header {
+	return rb.header
+}
+
+func (rb *responseBuffer) WriteHeader(status int) {
+	if rb.status == 0 {
+		rb.status = status
+	}
+}
+
+func (rb *responseBuffer) Write(b []byte) (int, error) {
+	if rb.status == 0 {
+		rb.status = http.StatusOK
+	}
+	return rb.body.Write(b)
+}
+
+// Status is the status code of the response, 200 when the handler did not set one
+func (rb *responseBuffer) Status() int {
+	if rb.status == 0 {
+		return http.StatusOK
+	}
+	return rb.status
+}
+
+// WriteTo sends the response that was held back
+func (rb *responseBuffer) WriteTo(w http.ResponseWriter) {
+	for key, values := range rb.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(rb.Status())
+	w.Write(rb.body.Bytes())
+}
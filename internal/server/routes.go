@@ -0,0 +1,92 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/handlers"
+	"github.com/sarabrajsingh/restful-openapi/internal/utils"
+)
+
+// operationHandlers is the generated table of handlers of a version of the contract, e.g. Handlers or HandlersV2
+type operationHandlers interface {
+	Handler(operationId string) (http.HandlerFunc, bool)
+}
+
+// auditActions names the action recorded in the audit log for the administrative operations
+var auditActions = map[string]string{
+	OperationErrorsDelete: "errors.delete",
+}
+
+// handlersV1 serves the operations of v1
+func (s *serverImpl) handlersV1(cfg *config.Config) operationHandlers {
+	return &Handlers{
+		Index:           Index,
+		ErrorsDelete:    handlers.DeleteErrors(s.logger, s.errorStore.DeleteErrors),
+		ErrorsGet:       handlers.GetErrors(s.logger, s.errorStore.GetErrorDetails),
+		TempPost:        handlers.TempPost(s.logger, cfg.OvertempThreshold, s.errorStore.AddError, s.recordReading, s.metrics.RecordParseFailure, utils.DefaultBodyReader),
+		FleetSummaryGet: handlers.FleetSummary(s.logger, s.fleetSummary),
+		AuditGet:        handlers.GetAudit(s.logger, s.auditStore.GetEntries),
+		VersionGet:      handlers.GetVersion(s.logger, s.Version),
+	}
+}
+
+// handlersV2 serves the operations of v2, sharing the stores with v1
+func (s *serverImpl) handlersV2(cfg *config.Config) operationHandlers {
+	return &HandlersV2{
+		ErrorsDelete:      handlers.DeleteErrorsV2(s.logger, s.errorStore.DeleteErrors),
+		ErrorsGet:         handlers.GetErrorsV2(s.logger, s.errorStore.GetErrorDetails),
+		TempPost:          handlers.TempPostV2(s.logger, cfg.OvertempThreshold, s.errorStore.AddError, s.recordReading, s.metrics.RecordParseFailure, utils.DefaultBodyReader),
+		FleetSummaryGet:   handlers.FleetSummary(s.logger, s.fleetSummary),
+		DeviceReadingsGet: handlers.DeviceReadings(s.logger, s.fleetStore.GetReadings),
+		AuditGet:          handlers.GetAudit(s.logger, s.auditStore.GetEntries),
+		VersionGet:        handlers.GetVersion(s.logger, s.Version),
+	}
+}
+
+// newRoutes routes every operation of the contract to its handler by operationId, so that an operation added to the
+// contract without a handler stops the server from starting instead of answering 404
+func newRoutes(spec *openapi3.T, routeHandlers operationHandlers) (Routes, error) {
+	var routes Routes
+	paths := spec.Paths.Map()
+	patterns := make([]string, 0, len(paths))
+	for pattern := range paths {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		operations := paths[pattern].Operations()
+		methods := make([]string, 0, len(operations))
+		for method := range operations {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			operationId := operations[method].OperationID
+			if operationId == "" {
+				return nil, fmt.Errorf("%s %s has no operationId", method, pattern)
+			}
+			handler, ok := routeHandlers.Handler(operationId)
+			if !ok {
+				return nil, fmt.Errorf("%s %s: operation %s is not in the generated code, run go generate ./...", method, pattern, operationId)
+			}
+			if handler == nil {
+				return nil, fmt.Errorf("%s %s: operation %s has no handler", method, pattern, operationId)
+			}
+
+			routes = append(routes, Route{
+				Name:        operationId,
+				Method:      method,
+				Pattern:     pattern,
+				HandlerFunc: handler,
+				AuditAction: auditActions[operationId],
+			})
+		}
+	}
+	return routes, nil
+}
@@ -2,10 +2,14 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"strings"
+	"sync/atomic"
 
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/getkin/kin-openapi/openapi3filter"
@@ -13,10 +17,38 @@ import (
 	"github.com/getkin/kin-openapi/routers/gorillamux"
 	"github.com/gorilla/mux"
 	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/accesslog"
+	"github.com/sarabrajsingh/restful-openapi/internal/audit"
+	"github.com/sarabrajsingh/restful-openapi/internal/auth"
+	"github.com/sarabrajsingh/restful-openapi/internal/fleet"
 	"github.com/sarabrajsingh/restful-openapi/internal/global_errors"
 	"github.com/sarabrajsingh/restful-openapi/internal/handlers"
+	"github.com/sarabrajsingh/restful-openapi/internal/health"
 	"github.com/sarabrajsingh/restful-openapi/internal/logging"
-	"github.com/sarabrajsingh/restful-openapi/internal/utils"
+	"github.com/sarabrajsingh/restful-openapi/internal/metrics"
+	"github.com/sarabrajsingh/restful-openapi/internal/models"
+	"github.com/sarabrajsingh/restful-openapi/internal/problem"
+	"github.com/sarabrajsingh/restful-openapi/internal/rbac"
+	"github.com/sarabrajsingh/restful-openapi/internal/tracing"
+	"github.com/sarabrajsingh/restful-openapi/swaggerui"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const (
+	// SwaggerUIRouteName names the file server of the Swagger UI in the access log
+	SwaggerUIRouteName = "SwaggerUI"
+	// MetricsRouteName names the Prometheus endpoint in the access log
+	MetricsRouteName = "Metrics"
+	MetricsPath      = "/metrics"
+	// OpenAPISpecRouteName names the contracts served to the Swagger UI in the access log
+	OpenAPISpecRouteName = "OpenAPISpec"
+	OpenAPISpecPath      = "/openapi.yaml"
+	OpenAPISpecV2Path    = "/openapi.v2.yaml"
+	// HealthzRouteName and ReadyzRouteName name the liveness and readiness probes in the access log
+	HealthzRouteName = "Healthz"
+	ReadyzRouteName  = "Readyz"
+	HealthzPath      = "/healthz"
+	ReadyzPath       = "/readyz"
 )
 
 type Route struct {
@@ -24,129 +56,289 @@ type Route struct {
 	Method      string
 	Pattern     string
 	HandlerFunc http.HandlerFunc
+	// AuditAction is recorded in the audit log every time the route is called, when set
+	AuditAction string
 }
 
 type Routes []Route
 
 type serverImpl struct {
-	config        *config.Config
-	logger        logging.Logger
-	errorStore    global_errors.ErrorStore
-	bodyReader    func(io.Reader) ([]byte, error)
-	specification *openapi3.T
+	config     *config.Config
+	logger     logging.Logger
+	errorStore global_errors.ErrorStore
+	fleetStore fleet.FleetStore
+	auditStore audit.AuditStore
+	metrics    metrics.Metrics
+	health     health.Health
+	bodyReader func(io.Reader) ([]byte, error)
+	// state is swapped as a whole by Reload, requests in flight finish on the router they started on
+	state    atomic.Pointer[routerState]
+	reloader *reloadStatus
 }
 
-func NewServer(config *config.Config, logger logging.Logger, errorStore global_errors.ErrorStore, bodyReader func(io.Reader) ([]byte, error)) Server {
+func NewServer(config *config.Config, logger logging.Logger, errorStore global_errors.ErrorStore, fleetStore fleet.FleetStore, auditStore audit.AuditStore, bodyReader func(io.Reader) ([]byte, error)) Server {
+	// the error and fleet stores live in memory, only the audit log can become unreachable
+	serverHealth := health.NewHealth()
+	serverHealth.AddCheck("audit", func(ctx context.Context) error {
+		return auditStore.Ping(logging.FromContext(ctx, logger))
+	})
+
 	return &serverImpl{
 		config:     config,
 		logger:     logger,
 		errorStore: errorStore,
+		fleetStore: fleetStore,
+		auditStore: auditStore,
+		metrics:    metrics.NewMetrics(logger, errorStore),
+		health:     serverHealth,
 		bodyReader: bodyReader,
+		reloader:   newReloadStatus(),
 	}
 }
 
+func (s *serverImpl) StartDraining() {
+	s.logger.Info("draining, the readiness probe fails from now on")
+	s.health.StartDraining()
+}
+
+// fleetSummary summarizes the fleet, with the malformed-payload rate based on the payloads the ErrorStore has stored
+func (s *serverImpl) fleetSummary(log logging.Logger, windowMinutes int, top int) models.FleetSummaryResponse {
+	return s.fleetStore.GetSummary(log, windowMinutes, top, s.errorStore.GetStats(log).Added)
+}
+
+// recordReading keeps the fleet state up to date and counts the reading and its verdict
+func (s *serverImpl) recordReading(log logging.Logger, reading *models.TempPostPayload, overtemp bool) {
+	s.fleetStore.RecordReading(log, reading, overtemp)
+	s.metrics.RecordReading(overtemp)
+}
+
+// GetSpecification returns the contract of v1
 func (s *serverImpl) GetSpecification() *openapi3.T {
-	return s.specification
+	if state := s.state.Load(); state != nil {
+		return state.versions[0].specification
+	}
+	return nil
 }
 
+// NewRouter builds the routes for the configuration the server was created with; the router it returns always
+// serves the routes of the last successful Reload
 func (s *serverImpl) NewRouter() *mux.Router {
-	router := mux.NewRouter().StrictSlash(true)
-
-	// Load and validate OpenAPI spec
-	spec, err := openapi3.NewLoader().LoadFromFile(s.config.OpenAPI3YamlFileLocation)
+	state, err := s.buildRouter(s.config)
+	s.health.SetSpecification(err)
 	if err != nil {
-		s.logger.Fatalf("Failed to load OpenAPI spec: %v", err)
+		s.logger.Fatalf("%v", err)
 	}
+	s.state.Store(state)
+
+	router := mux.NewRouter()
+	router.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.state.Load().router.ServeHTTP(w, r)
+	})
+	return router
+}
 
-	s.specification = spec
+// buildRouter loads the contract of every version and every file the configuration points at, and registers the
+// routes; nothing is changed on the server, so that a failed reload leaves the current routes in place
+func (s *serverImpl) buildRouter(cfg *config.Config) (*routerState, error) {
+	router := mux.NewRouter().StrictSlash(true)
+
+	// Load and validate the OpenAPI spec of every version
+	versions := make([]*apiVersion, 0, len(versionSources))
+	for _, source := range versionSources {
+		version, err := s.loadVersion(cfg, source)
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range versions {
+			if other.prefix == version.prefix {
+				return nil, fmt.Errorf("Failed to validate OpenAPI spec of %s: %s already serves %s", version.name, other.name, version.prefix)
+			}
+		}
+		versions = append(versions, version)
+	}
 
-	err = spec.Validate(openapi3.NewLoader().Context)
+	// credentials are checked against the securitySchemes declared in the contract
+	authFunc, err := s.newAuthenticationFunc(cfg)
 	if err != nil {
-		s.logger.Fatalf("Failed to validate OpenAPI spec: %v", err)
+		return nil, err
 	}
 
-	// Create OpenAPI router
-	oapiRouter, err := gorillamux.NewRouter(spec)
+	// roles are checked against the policy once the caller is known
+	var policy *rbac.Policy
+	if cfg.RBACPolicyFile != "" {
+		policy, err = rbac.LoadPolicy(cfg.RBACPolicyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load RBAC policy: %w", err)
+		}
+		s.logger.Printf("Role-based access control enabled with policy %s", cfg.RBACPolicyFile)
+	}
+
+	// access log written once every response has been sent
+	accessLogger, err := accesslog.NewAccessLogger(os.Stdout, cfg.AccessLog)
 	if err != nil {
-		s.logger.Fatalf("Failed to create OpenAPI router: %v", err)
+		return nil, fmt.Errorf("Failed to create the access log: %w", err)
 	}
 
-	s.logger.Printf("Validating Contract")
+	// the operationIds of every version, which name the routes of the rate limits
+	operations := map[string]bool{}
+	for i, version := range versions {
+		// every version is validated against its own contract
+		oapiRouter, err := gorillamux.NewRouter(version.specification)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create OpenAPI router of %s: %w", version.name, err)
+		}
 
-	// Define routes with /api/v1/ prefix
-	routes := []Route{
-		{
-			Name:        "Index",
-			Method:      "GET",
-			Pattern:     "/",
-			HandlerFunc: Index,
-		},
-		{
-			Name:        "ErrorsDelete",
-			Method:      strings.ToUpper("DELETE"),
-			Pattern:     "/errors",
-			HandlerFunc: handlers.DeleteErrors(s.logger, s.errorStore.DeleteErrors),
-		},
-		{
-			Name:        "ErrorsGet",
-			Method:      strings.ToUpper("GET"),
-			Pattern:     "/errors",
-			HandlerFunc: handlers.GetErrors(s.logger, s.errorStore.GetErrors),
-		},
-		{
-			Name:        "TempPost",
-			Method:      strings.ToUpper("POST"),
-			Pattern:     "/temp",
-			HandlerFunc: handlers.TempPost(s.logger, s.errorStore.AddError, utils.DefaultBodyReader),
-		},
+		s.logger.Printf("Validating Contract of %s", version.name)
+
+		// a handler for every operation of the contract, routed by operationId
+		routes, err := newRoutes(version.specification, versionSources[i].handlers(s, cfg))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to route the contract of %s: %w", version.name, err)
+		}
+
+		// Register routes with middleware; the route names are the operationIds, so the RBAC policy and the rate
+		// limits of a route cover all the versions
+		for _, route := range routes {
+			operations[route.Name] = true
+			var handler http.Handler
+			handler = route.HandlerFunc
+			// token bucket rate limiting for the handlers that have a limit configured
+			if rateLimit, ok := cfg.RateLimits[route.Name]; ok && rateLimit.RequestsPerSecond > 0 {
+				limiter := s.reloader.limiter(route.Name, rateLimit)
+				handler = RateLimitMiddleware(s.logger, limiter, rateLimitKeyFunc(rateLimit.Key), handler, route.Name)
+				// the devices of a client share a bucket in front of their own ones, so both have to admit a request
+				if rateLimit.Key == config.RateLimitKeyDevice && rateLimit.ClientRequestsPerSecond > 0 {
+					clientLimit := config.RateLimit{RequestsPerSecond: rateLimit.ClientRequestsPerSecond, Burst: rateLimit.ClientBurst, Key: config.RateLimitKeyClient}
+					handler = RateLimitMiddleware(s.logger, s.reloader.limiter(route.Name+"/client", clientLimit), clientKey, handler, route.Name)
+				}
+			}
+			// role-based access control for everything but the landing page
+			if policy != nil && route.Name != "Index" {
+				handler = AuthorizationMiddleware(s.logger, policy, handler, route.Name)
+			}
+			// bind device certificates to the device id they report for
+			if cfg.TLS.BindDeviceId {
+				handler = auth.DeviceIdentityMiddleware(handler)
+			}
+			// openapi3 validaton middleware for each handler request
+			handler = OpenAPIMiddleware(s.logger, oapiRouter, authFunc, cfg.ResponseValidation, handler)
+			// audit log of administrative actions, outside of the authentication, the access control and the rate
+			// limits so that the denied attempts are recorded along with their status
+			if route.AuditAction != "" {
+				handler = AuditMiddleware(s.logger, s.auditStore, route.AuditAction, handler)
+			}
+			// request counts and latencies, including the requests rejected by the validation
+			handler = MetricsMiddleware(s.metrics, handler, route.Name, version.name)
+			// access log, outside of the validation so that rejected requests are logged with their status
+			handler = AccessLogMiddleware(accessLogger, handler, route.Name)
+			// request id and request-scoped logger, so that every response carries the id
+			handler = RequestIDMiddleware(s.logger, handler)
+			// deprecation headers, and the problems-only responses of the versions without the legacy shape
+			handler = VersionMiddleware(version, handler)
+			// server span, outermost so that it covers the whole request
+			handler = TracingMiddleware(handler, route.Name)
+
+			router.
+				Methods(route.Method).
+				Path(version.prefix + route.Pattern).
+				Name(version.name + "." + route.Name).
+				Handler(handler)
+		}
+
+		// the Swagger UI shows the contracts the requests are validated against
+		router.Methods("GET").Path(version.specPath).Name(OpenAPISpecRouteName + "." + version.name).Handler(
+			RequestIDMiddleware(s.logger, AccessLogMiddleware(accessLogger, serveSpecification(version.specData), OpenAPISpecRouteName)),
+		)
 	}
 
-	// Register routes with middleware
-	for _, route := range routes {
-		var handler http.Handler
-		handler = route.HandlerFunc
-		// logging middleware for handlers
-		handler = LoggerMiddleware(s.logger, handler, route.Name)
-		// openapi3 validaton middleware for each handler request
-		handler = OpenAPIMiddleware(oapiRouter, handler)
+	// a limit on a route name that is not an operationId, such as a typo, would limit nothing
+	for route := range cfg.RateLimits {
+		if !operations[route] {
+			return nil, fmt.Errorf("rate_limits.%s: no operation of the contracts has this operationId", route)
+		}
+	}
 
-		router.
-			Methods(route.Method).
-			Path("/api/v1" + route.Pattern).
-			Name(route.Name).
-			Handler(handler)
+	s.logger.Printf("Successfully validated the contracts")
+
+	// Prometheus metrics, outside of the contract
+	if cfg.MetricsEnabled {
+		router.Methods("GET").Path(MetricsPath).Name(MetricsRouteName).Handler(
+			RequestIDMiddleware(s.logger, AccessLogMiddleware(accessLogger, s.metrics.Handler(), MetricsRouteName)),
+		)
 	}
 
-	s.logger.Printf("Successfully validated the contract")
+	// liveness and readiness probes, outside of the contract and of the authentication
+	router.Methods("GET").Path(HealthzPath).Name(HealthzRouteName).Handler(
+		RequestIDMiddleware(s.logger, AccessLogMiddleware(accessLogger, handlers.Healthz(s.logger, s.health.Liveness), HealthzRouteName)),
+	)
+	router.Methods("GET").Path(ReadyzPath).Name(ReadyzRouteName).Handler(
+		RequestIDMiddleware(s.logger, AccessLogMiddleware(accessLogger, handlers.Readyz(s.logger, s.health.Readiness), ReadyzRouteName)),
+	)
 
-	// Serve Swagger UI
-	fs := http.FileServer(http.Dir(s.config.SwaggerUIFolder))
-	router.PathPrefix("/").Handler(http.StripPrefix("/", fs))
+	// Serve Swagger UI, from disk when a folder is configured
+	swaggerUI := http.FS(swaggerui.FS())
+	if cfg.SwaggerUIFolder != "" {
+		swaggerUI = http.Dir(cfg.SwaggerUIFolder)
+	}
+	fs := http.FileServer(swaggerUI)
+	router.PathPrefix("/").Name(SwaggerUIRouteName).Handler(
+		RequestIDMiddleware(s.logger, AccessLogMiddleware(accessLogger, http.StripPrefix("/", fs), SwaggerUIRouteName)),
+	)
 
-	return router
+	return newRouterState(router, cfg, versions), nil
 }
 
-// LoggerMiddleware logs the HTTP request details
-func LoggerMiddleware(logger logging.Logger, inner http.Handler, name string) http.Handler {
+func serveSpecification(data []byte) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger.Printf(
-			"%s\t%s\t%s\t%s",
-			r.Method,
-			r.RequestURI,
-			name,
-			r.RemoteAddr,
-		)
-		inner.ServeHTTP(w, r)
+		w.Header().Set("Content-Type", "application/yaml")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
 	})
 }
 
-func OpenAPIMiddleware(router routers.Router, next http.Handler) http.Handler {
+// newAuthenticationFunc builds the authenticator for every configured security scheme type
+func (s *serverImpl) newAuthenticationFunc(cfg *config.Config) (openapi3filter.AuthenticationFunc, error) {
+	authenticators := auth.Authenticators{}
+
+	if len(cfg.APIKeys) > 0 {
+		authenticators["apiKey"] = auth.NewAPIKeyAuthenticationFunc(cfg.APIKeys)
+		s.logger.Printf("API key authentication enabled with %d keys", len(cfg.APIKeys))
+	}
+
+	if cfg.JWT.Enabled() {
+		keys, err := auth.NewKeySource(cfg.JWT)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load JWKS: %w", err)
+		}
+		authenticators["http"] = auth.NewBearerAuthenticationFunc(keys, cfg.JWT)
+		s.logger.Printf("JWT bearer authentication enabled")
+	}
+
+	// a deployment that lost its keys fails closed rather than opening DELETE /errors to anyone
+	if len(authenticators) == 0 {
+		if !cfg.Auth.Disabled {
+			return nil, fmt.Errorf("Failed to configure authentication: no API keys or JWKS configured; set auth.disabled (%s=true) to run without authentication", config.AuthDisabledEnv)
+		}
+		s.logger.Warn("authentication is disabled by auth.disabled; every operation is open to anyone")
+		return openapi3filter.NoopAuthenticationFunc, nil
+	}
+
+	return authenticators.AuthenticationFunc(), nil
+}
+
+// OpenAPIMiddleware validates requests against the contract, including its security requirements, and the responses
+// unless responseValidation is off
+func OpenAPIMiddleware(log logging.Logger, router routers.Router, authFunc openapi3filter.AuthenticationFunc, responseValidation string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// make room for the authenticated caller before the security requirements are checked
+		r = r.WithContext(auth.NewContext(r.Context()))
+
+		_, span := tracing.Tracer().Start(r.Context(), "openapi.FindRoute")
 		route, pathParams, err := router.FindRoute(r)
+		span.End()
 		if err != nil {
-			fmt.Printf("Request: %+v\n", r)
 			response := fmt.Sprintf("OpenAPI Middleware: Error finding route: %v\n", err)
-			utils.WriteErrorResponse(w, response, http.StatusBadRequest)
+			problem.Write(w, r, problem.New(problem.CodeUnknownRoute, err.Error()), response)
 			return
 		}
 
@@ -154,18 +346,114 @@ func OpenAPIMiddleware(router routers.Router, next http.Handler) http.Handler {
 			Request:    r,
 			PathParams: pathParams,
 			Route:      route,
+			Options: &openapi3filter.Options{
+				AuthenticationFunc: authFunc,
+			},
 		}
 
-		if err := openapi3filter.ValidateRequest(r.Context(), requestValidationInput); err != nil {
+		ctx, span := tracing.Tracer().Start(r.Context(), "openapi.ValidateRequest")
+		err = openapi3filter.ValidateRequest(ctx, requestValidationInput)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+
+		if err != nil {
+			if statusCode := auth.StatusCode(err); statusCode != 0 {
+				response := fmt.Sprintf("OpenAPI Middleware: Authentication failed: %v\n", err)
+				code := problem.CodeUnauthenticated
+				if statusCode == http.StatusForbidden {
+					code = problem.CodeInsufficientScope
+				}
+				problem.Write(w, r, problem.New(code, err.Error()), response)
+				return
+			}
+
 			response := fmt.Sprintf("OpenAPI Middleware: Request validation failed: %v\n", err)
-			utils.WriteErrorResponse(w, response, http.StatusBadRequest)
+			problem.Write(w, r, validationProblem(err), response)
+			return
+		}
+
+		if responseValidation == config.ResponseValidationOff {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		buffer := newResponseBuffer(w)
+		next.ServeHTTP(buffer, r)
+
+		err = validateResponse(r.Context(), requestValidationInput, buffer)
+		if err != nil {
+			log := logging.FromContext(r.Context(), log)
+			log.Error("response does not match the contract", "method", route.Method, "path", route.Path, "status", buffer.Status(), "error", err)
+			// the handler has already run, e.g. DELETE /errors has cleared the buffer, so enforcing only replaces what
+			// the client is told; the reason stays in the log, since it describes the internals of the response
+			if responseValidation == config.ResponseValidationEnforce {
+				problem.Write(w, r, problem.New(problem.CodeResponseValidation, "the response does not match the contract"), "OpenAPI Middleware: Response validation failed\n")
+				return
+			}
+		}
+
+		buffer.WriteTo(w)
 	})
 }
 
+// validationProblem lists every part of the request that does not match the contract, e.g. the JSON pointer of an
+// invalid property of the body or the name of an invalid parameter
+func validationProblem(err error) models.Problem {
+	var requestErr *openapi3filter.RequestError
+	if !errors.As(err, &requestErr) {
+		return problem.New(problem.CodeInvalidRequest, err.Error())
+	}
+
+	detail := requestErr.Reason
+	var schemaErr *openapi3.SchemaError
+	if errors.As(requestErr.Err, &schemaErr) {
+		detail = schemaErr.Reason
+	} else if requestErr.Err != nil {
+		detail = requestErr.Err.Error()
+	}
+
+	switch {
+	case requestErr.Parameter != nil:
+		p := problem.New(problem.CodeInvalidParameter, fmt.Sprintf("parameter %q in %s: %s", requestErr.Parameter.Name, requestErr.Parameter.In, detail))
+		p.Errors = []models.ValidationError{{In: requestErr.Parameter.In, Parameter: requestErr.Parameter.Name, Detail: detail}}
+		return p
+	case requestErr.RequestBody != nil:
+		p := problem.New(problem.CodeInvalidBody, "request body: "+detail)
+		validationError := models.ValidationError{Detail: detail}
+		if schemaErr != nil {
+			validationError.Pointer = "#" + strings.Join(append([]string{""}, schemaErr.JSONPointer()...), "/")
+		}
+		p.Errors = []models.ValidationError{validationError}
+		return p
+	}
+	return problem.New(problem.CodeInvalidRequest, requestErr.Error())
+}
+
+// validateResponse checks the status, the headers and the body of a response against the operation it answers;
+// a status the operation does not declare is a mismatch too
+func validateResponse(ctx context.Context, requestValidationInput *openapi3filter.RequestValidationInput, buffer *responseBuffer) error {
+	ctx, span := tracing.Tracer().Start(ctx, "openapi.ValidateResponse")
+	defer span.End()
+
+	responseValidationInput := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: requestValidationInput,
+		Status:                 buffer.Status(),
+		Header:                 buffer.Header(),
+		Options: &openapi3filter.Options{
+			IncludeResponseStatus: true,
+		},
+	}
+	responseValidationInput.SetBodyBytes(buffer.body.Bytes())
+
+	err := openapi3filter.ValidateResponse(ctx, responseValidationInput)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
 // Home/Landing page for the API here
 func Index(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/index.html", http.StatusFound)
@@ -2,14 +2,29 @@
 package server_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
 	"github.com/golang/mock/gomock"
+	"github.com/sarabrajsingh/restful-openapi/api"
 	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/global_errors"
+	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+	"github.com/sarabrajsingh/restful-openapi/internal/models"
+	"github.com/sarabrajsingh/restful-openapi/internal/problem"
 	"github.com/sarabrajsingh/restful-openapi/internal/server"
 	"github.com/sarabrajsingh/restful-openapi/internal/utils"
 	"github.com/sarabrajsingh/restful-openapi/mocks"
@@ -23,15 +38,21 @@ func TestIndexRedirect(t *testing.T) {
 	// Create mock dependencies
 	mockLogger := mocks.NewMockLogger(ctrl)
 	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
 	bodyReader := utils.DefaultBodyReader
 
 	// Set up mock expectations
 	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
 
 	// Create server with mocks
 	cfg, err := config.NewConfig()
 	assert.NoError(t, err)
-	srv := server.NewServer(cfg, mockLogger, mockErrorStore, bodyReader)
+	cfg.Auth.Disabled = true
+	srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, bodyReader)
 
 	// Create a test server
 	testServer := httptest.NewServer(srv.NewRouter())
@@ -75,16 +96,27 @@ func TestErrorsDelete(t *testing.T) {
 	// Create mock dependencies
 	mockLogger := mocks.NewMockLogger(ctrl)
 	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
 	bodyReader := utils.DefaultBodyReader
 
 	// Set up mock expectations
 	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
 	mockErrorStore.EXPECT().DeleteErrors(gomock.Any()).AnyTimes()
+	mockAuditStore.EXPECT().Record(gomock.Any(), gomock.Any()).Do(func(log logging.Logger, entry models.AuditEntry) {
+		assert.Equal(t, "errors.delete", entry.Action)
+		assert.Equal(t, "anonymous", entry.Actor)
+		assert.Equal(t, http.StatusOK, entry.Status)
+	}).Times(1)
 
 	// Create server with mocks
 	cfg, err := config.NewConfig()
 	assert.NoError(t, err)
-	srv := server.NewServer(cfg, mockLogger, mockErrorStore, bodyReader)
+	cfg.Auth.Disabled = true
+	srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, bodyReader)
 
 	// Create a test server
 	testServer := httptest.NewServer(srv.NewRouter())
@@ -115,16 +147,22 @@ func TestErrorsGet(t *testing.T) {
 	// Create mock dependencies
 	mockLogger := mocks.NewMockLogger(ctrl)
 	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
 	bodyReader := utils.DefaultBodyReader
 
 	// Set up mock expectations
 	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
-	mockErrorStore.EXPECT().GetErrors(gomock.Any()).Return([]string{"error1", "error2"})
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockErrorStore.EXPECT().GetErrorDetails(gomock.Any()).Return([]models.ErrorDetail{{Error: "error1"}, {Error: "error2"}})
 
 	// Create server with mocks
 	cfg, err := config.NewConfig()
 	assert.NoError(t, err)
-	srv := server.NewServer(cfg, mockLogger, mockErrorStore, bodyReader)
+	cfg.Auth.Disabled = true
+	srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, bodyReader)
 
 	// Create a test server
 	testServer := httptest.NewServer(srv.NewRouter())
@@ -153,4 +191,954 @@ func TestErrorsGet(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 	assert.Contains(t, string(body), "error1")
 	assert.Contains(t, string(body), "error2")
+	assert.Len(t, resp.Header.Get("X-Request-ID"), 32)
+}
+
+// TestFleetSummaryGet tests the /fleet/summary GET endpoint
+func TestFleetSummaryGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Create mock dependencies
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
+	bodyReader := utils.DefaultBodyReader
+
+	// Set up mock expectations
+	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockErrorStore.EXPECT().GetStats(gomock.Any()).Return(global_errors.Stats{Size: 1, Added: 4})
+	mockFleetStore.EXPECT().GetSummary(gomock.Any(), 10, 3, uint64(4)).Return(models.FleetSummaryResponse{
+		TotalDevices:   2,
+		WindowMinutes:  10,
+		HottestDevices: []models.FleetDevice{},
+	})
+
+	// Create server with mocks
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.Auth.Disabled = true
+	srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, bodyReader)
+
+	// Create a test server
+	testServer := httptest.NewServer(srv.NewRouter())
+	defer testServer.Close()
+
+	// Send a valid request
+	resp, err := http.Get(fmt.Sprintf("%s/api/v1/fleet/summary?window_minutes=10&top=3", testServer.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var summary models.FleetSummaryResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&summary))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, summary.TotalDevices)
+	assert.Equal(t, 10, summary.WindowMinutes)
+
+	// A window outside of the contract is rejected by the OpenAPI middleware
+	resp, err = http.Get(fmt.Sprintf("%s/api/v1/fleet/summary?window_minutes=600", testServer.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// TestAPIKeyAuthentication tests that the security requirements in the contract are enforced
+func TestAPIKeyAuthentication(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Create mock dependencies
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
+	bodyReader := utils.DefaultBodyReader
+
+	// Set up mock expectations
+	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockErrorStore.EXPECT().DeleteErrors(gomock.Any()).Times(1)
+	// only the admin key gets through, and every attempt is audited with its outcome
+	var audited []models.AuditEntry
+	mockAuditStore.EXPECT().Record(gomock.Any(), gomock.Any()).Do(func(log logging.Logger, entry models.AuditEntry) {
+		audited = append(audited, entry)
+	}).Times(4)
+
+	// Create server with API keys
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.APIKeys = []config.APIKey{
+		{Name: "gateway-01", Key: "device-secret", Scopes: []string{"ingest"}},
+		{Name: "ops", Key: "admin-secret", Scopes: []string{"ingest", "read", "admin"}},
+	}
+	srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, bodyReader)
+
+	// Create a test server
+	testServer := httptest.NewServer(srv.NewRouter())
+	defer testServer.Close()
+
+	testCases := []struct {
+		description    string
+		apiKey         string
+		expectedStatus int
+	}{
+		{"No API key", "", http.StatusUnauthorized},
+		{"Unknown API key", "foobar", http.StatusUnauthorized},
+		{"Device key", "device-secret", http.StatusForbidden},
+		{"Admin key", "admin-secret", http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/api/v1/errors", testServer.URL), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.apiKey != "" {
+				req.Header.Set("X-API-Key", tc.apiKey)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+		})
+	}
+
+	if assert.Len(t, audited, 4) {
+		// a key without the scope of the operation does not authenticate the caller
+		assert.Equal(t, []string{"anonymous", "anonymous", "anonymous", "apiKey:ops"}, []string{audited[0].Actor, audited[1].Actor, audited[2].Actor, audited[3].Actor})
+		assert.Equal(t, []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusForbidden, http.StatusOK}, []int{audited[0].Status, audited[1].Status, audited[2].Status, audited[3].Status})
+	}
+}
+
+// TestRoleBasedAccessControl tests that a viewer can read but not clear the errors
+func TestRoleBasedAccessControl(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Create mock dependencies
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
+	bodyReader := utils.DefaultBodyReader
+
+	// Set up mock expectations
+	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockErrorStore.EXPECT().GetErrorDetails(gomock.Any()).Return([]models.ErrorDetail{}).Times(1)
+	// the denied attempts to clear the errors are audited
+	mockAuditStore.EXPECT().Record(gomock.Any(), gomock.Any()).Do(func(log logging.Logger, entry models.AuditEntry) {
+		assert.Equal(t, "errors.delete", entry.Action)
+		assert.Equal(t, "apiKey:dashboard", entry.Actor)
+		assert.Equal(t, http.StatusForbidden, entry.Status)
+	}).Times(2)
+
+	// Create server with API keys and the default policy
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.APIKeys = []config.APIKey{
+		{Name: "dashboard", Key: "viewer-secret", Scopes: []string{"read", "admin"}, Roles: []string{"viewer"}},
+	}
+	cfg.RBACPolicyFile = filepath.Join("..", "..", "config", "rbac_policy.json")
+	srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, bodyReader)
+
+	// Create a test server
+	testServer := httptest.NewServer(srv.NewRouter())
+	defer testServer.Close()
+
+	do := func(method string, accept string) *http.Response {
+		req, err := http.NewRequest(method, fmt.Sprintf("%s/api/v1/errors", testServer.URL), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-API-Key", "viewer-secret")
+		req.Header.Set("X-Request-ID", "rbac-test")
+		req.Header.Set("Accept", accept)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := do("GET", "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the key holds the admin scope, but the viewer role may not clear the errors
+	resp = do("DELETE", problem.ContentType)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, problem.ContentType, resp.Header.Get("Content-Type"))
+
+	var forbiddenProblem models.Problem
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&forbiddenProblem))
+	assert.Equal(t, problem.CodeRoleNotAllowed, forbiddenProblem.Code)
+	assert.Equal(t, "ErrorsDelete", forbiddenProblem.Route)
+	assert.Equal(t, []string{"admin"}, forbiddenProblem.AllowedRoles)
+	assert.Equal(t, "rbac-test", forbiddenProblem.RequestId)
+
+	// the clients that only accept JSON keep getting the legacy shape
+	resp = do("DELETE", "application/json")
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	var forbidden models.Forbidden403
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&forbidden))
+	assert.Equal(t, models.Forbidden403{
+		Error:        "forbidden",
+		Route:        "ErrorsDelete",
+		Caller:       "apiKey:dashboard",
+		Roles:        []string{"viewer"},
+		AllowedRoles: []string{"admin"},
+		RequestId:    "rbac-test",
+	}, forbidden)
+}
+
+// TestAuditGet tests the /audit GET endpoint
+func TestAuditGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Create mock dependencies
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
+	bodyReader := utils.DefaultBodyReader
+
+	// Set up mock expectations
+	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockAuditStore.EXPECT().GetEntries(gomock.Any(), gomock.Any()).DoAndReturn(func(log logging.Logger, query models.AuditQuery) []models.AuditEntry {
+		assert.Equal(t, "errors.delete", query.Action)
+		assert.Equal(t, 10, query.Limit)
+		return []models.AuditEntry{{Id: 1, Time: "2024-07-27T14:17:15Z", Action: "errors.delete", Actor: "apiKey:ops", Status: 200}}
+	})
+
+	// Create server with mocks
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.Auth.Disabled = true
+	srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, bodyReader)
+
+	// Create a test server
+	testServer := httptest.NewServer(srv.NewRouter())
+	defer testServer.Close()
+
+	resp, err := http.Get(fmt.Sprintf("%s/api/v1/audit?action=errors.delete&limit=10", testServer.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var audit models.GetAuditResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&audit))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, audit.Entries, 1)
+	assert.Equal(t, "apiKey:ops", audit.Entries[0].Actor)
+}
+
+// TestRequestID tests that the caller's X-Request-ID is echoed and reaches the error responses and the ErrorStore
+func TestRequestID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	requestLogger := mocks.NewMockLogger(ctrl)
+	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
+
+	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With("request_id", "gateway-01:7f3a").Return(requestLogger).Times(2)
+	requestLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	requestLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockErrorStore.EXPECT().AddError(requestLogger, "bad:data", "gateway-01:7f3a").Times(1)
+
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.Auth.Disabled = true
+	srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, utils.DefaultBodyReader)
+
+	testServer := httptest.NewServer(srv.NewRouter())
+	defer testServer.Close()
+
+	post := func(body string) (*http.Response, models.Response400) {
+		req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/v1/temp", testServer.URL), strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Request-ID", "gateway-01:7f3a")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var response models.Response400
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+		return resp, response
+	}
+
+	// rejected by the handler
+	resp, response := post(`{"data":"bad:data"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "gateway-01:7f3a", resp.Header.Get("X-Request-ID"))
+	assert.Equal(t, "gateway-01:7f3a", response.RequestId)
+
+	// rejected by the OpenAPI validation
+	resp, response = post(`{"foo":"bar"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "gateway-01:7f3a", response.RequestId)
+}
+
+// TestMetricsEndpoint tests that requests and parse failures show up on /metrics
+func TestMetricsEndpoint(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
+
+	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockErrorStore.EXPECT().AddError(gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
+	mockErrorStore.EXPECT().GetStats(gomock.Any()).Return(global_errors.Stats{Size: 1}).AnyTimes()
+
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.Auth.Disabled = true
+	srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, utils.DefaultBodyReader)
+
+	testServer := httptest.NewServer(srv.NewRouter())
+	defer testServer.Close()
+
+	resp, err := http.Post(fmt.Sprintf("%s/api/v1/temp", testServer.URL), "application/json", strings.NewReader(`{"data":"1234:1721964434:'Temp':95.0"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = http.Get(fmt.Sprintf("%s/metrics", testServer.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), `http_requests_total{api_version="v1",route="TempPost",status="400"} 1`)
+	assert.Contains(t, string(body), `payload_parse_failures_total{reason="temperature_key"} 1`)
+	assert.Contains(t, string(body), `error_store_size 1`)
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
+
+	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockAuditStore.EXPECT().Ping(gomock.Any()).Return(nil).AnyTimes()
+
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.Auth.Disabled = true
+	srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, utils.DefaultBodyReader)
+
+	testServer := httptest.NewServer(srv.NewRouter())
+	defer testServer.Close()
+
+	get := func(path string) (int, models.HealthResponse) {
+		resp, err := http.Get(testServer.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var response models.HealthResponse
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+		return resp.StatusCode, response
+	}
+
+	status, response := get("/healthz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ok", response.Status)
+
+	status, response = get("/readyz?verbose=true")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ok", response.Checks["specification"].Status)
+	assert.Equal(t, "ok", response.Checks["audit"].Status)
+
+	// a draining server stays alive but stops taking traffic
+	srv.StartDraining()
+
+	status, _ = get("/healthz")
+	assert.Equal(t, http.StatusOK, status)
+
+	status, response = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "unavailable", response.Status)
+	assert.Nil(t, response.Checks)
+}
+
+// TestSwaggerUI tests that the Swagger UI and the contract are served from the binary, or from disk when configured
+func TestSwaggerUI(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
+
+	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+
+	get := func(url string) (int, string) {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.Auth.Disabled = true
+	srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, utils.DefaultBodyReader)
+	testServer := httptest.NewServer(srv.NewRouter())
+	defer testServer.Close()
+
+	status, body := get(testServer.URL + "/swagger-ui-bundle.js")
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotEmpty(t, body)
+
+	status, body = get(testServer.URL + "/openapi.yaml")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, string(api.OpenAPISpec), body)
+
+	status, body = get(testServer.URL + "/openapi.v2.yaml")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, string(api.OpenAPISpecV2), body)
+
+	// a contract and a Swagger UI being worked on are loaded from disk
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>work in progress</html>"), 0600))
+	spec := filepath.Join(dir, "openapi.yaml")
+	assert.NoError(t, os.WriteFile(spec, api.OpenAPISpec, 0600))
+
+	cfg.SwaggerUIFolder = dir
+	cfg.OpenAPI3YamlFileLocation = spec
+	srv = server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, utils.DefaultBodyReader)
+	diskServer := httptest.NewServer(srv.NewRouter())
+	defer diskServer.Close()
+
+	status, body = get(diskServer.URL + "/")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "work in progress")
+
+	status, _ = get(diskServer.URL + "/swagger-ui-bundle.js")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+// TestReload tests that a reload swaps the routes in only when the new configuration loads
+func TestReload(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
+
+	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Error(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockAuditStore.EXPECT().Ping(gomock.Any()).Return(nil).AnyTimes()
+
+	getVersion := func(url string, apiKey string) (int, models.VersionResponse) {
+		req, err := http.NewRequest("GET", url+"/api/v1/admin/version", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-API-Key", apiKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var version models.VersionResponse
+		if resp.StatusCode == http.StatusOK {
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&version))
+		}
+		return resp.StatusCode, version
+	}
+
+	getReadiness := func(url string) (int, models.HealthResponse) {
+		resp, err := http.Get(url + "/readyz?verbose=true")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var response models.HealthResponse
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+		return resp.StatusCode, response
+	}
+
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.APIKeys = []config.APIKey{{Name: "ops", Key: "admin-secret", Scopes: []string{"admin"}}}
+	srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, utils.DefaultBodyReader)
+	testServer := httptest.NewServer(srv.NewRouter())
+	defer testServer.Close()
+
+	status, initial := getVersion(testServer.URL, "admin-secret")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, cfg.Version(), initial.ConfigVersion)
+	assert.Equal(t, "1.0.0", initial.APIVersion)
+	assert.Equal(t, 0, initial.Reloads)
+	assert.Empty(t, initial.LastReloadAt)
+
+	// a contract that cannot be loaded leaves the current routes in place
+	broken := *cfg
+	broken.OpenAPI3YamlFileLocation = filepath.Join(t.TempDir(), "missing.yaml")
+	_, err = srv.Reload(func() (*config.Config, error) { return &broken, nil })
+	assert.Error(t, err)
+
+	status, version := getVersion(testServer.URL, "admin-secret")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, initial.ConfigVersion, version.ConfigVersion)
+	assert.Equal(t, 0, version.Reloads)
+	assert.Contains(t, version.LastReloadError, "missing.yaml")
+
+	// and takes the server out of rotation until a reload succeeds
+	status, readiness := getReadiness(testServer.URL)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "unavailable", readiness.Checks["specification"].Status)
+
+	// so does a deprecation that cannot be read
+	spec := filepath.Join(t.TempDir(), "openapi.v2.yaml")
+	assert.NoError(t, os.WriteFile(spec, []byte(strings.Replace(string(api.OpenAPISpecV2), "version: 2.0.0", "version: 2.0.0\n  x-sunset-at: soon", 1)), 0600))
+	broken = *cfg
+	broken.OpenAPISpecV2 = spec
+	_, err = srv.Reload(func() (*config.Config, error) { return &broken, nil })
+	assert.ErrorContains(t, err, "x-sunset-at must be an RFC 3339 time")
+
+	// so does a limit on a route that is not an operationId
+	misnamed := *cfg
+	misnamed.RateLimits = config.DefaultRateLimits()
+	misnamed.RateLimits["TempPots"] = config.RateLimit{RequestsPerSecond: 1, Burst: 1, Key: config.RateLimitKeyClient}
+	_, err = srv.Reload(func() (*config.Config, error) { return &misnamed, nil })
+	assert.ErrorContains(t, err, "rate_limits.TempPots: no operation of the contracts has this operationId")
+
+	// a configuration that lost its keys fails closed, unless authentication is turned off on purpose
+	keyless := *cfg
+	keyless.APIKeys = nil
+	_, err = srv.Reload(func() (*config.Config, error) { return &keyless, nil })
+	assert.ErrorContains(t, err, "no API keys or JWKS configured")
+	status, _ = getVersion(testServer.URL, "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// a rotated key takes effect without a restart
+	rotated := *cfg
+	rotated.APIKeys = []config.APIKey{{Name: "ops", Key: "rotated-secret", Scopes: []string{"admin"}, Rotation: 1}}
+	applied, err := srv.Reload(func() (*config.Config, error) { return &rotated, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, &rotated, applied)
+
+	status, _ = getVersion(testServer.URL, "admin-secret")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, version = getVersion(testServer.URL, "rotated-secret")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, rotated.Version(), version.ConfigVersion)
+	assert.NotEqual(t, initial.ConfigVersion, version.ConfigVersion)
+	assert.Equal(t, initial.SpecVersion, version.SpecVersion)
+	assert.Equal(t, 1, version.Reloads)
+	assert.Empty(t, version.LastReloadError)
+
+	status, readiness = getReadiness(testServer.URL)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ok", readiness.Checks["specification"].Status)
+
+	// so does a configuration that does not load at all
+	_, err = srv.Reload(func() (*config.Config, error) { return nil, fmt.Errorf("port: \"http\" is not a port number") })
+	assert.Error(t, err)
+	_, version = getVersion(testServer.URL, "rotated-secret")
+	assert.Equal(t, rotated.Version(), version.ConfigVersion)
+	assert.Equal(t, "port: \"http\" is not a port number", version.LastReloadError)
+}
+
+// TestResponseValidation tests that a response that drifted from the contract is logged, or replaced when enforced
+func TestResponseValidation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
+
+	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Println(gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockFleetStore.EXPECT().RecordReading(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+
+	// a contract where a reading below the threshold can no longer be answered
+	drifted := strings.Replace(string(api.OpenAPISpec), "- false\n          example: false", "- true\n          example: true", 1)
+	assert.NotEqual(t, string(api.OpenAPISpec), drifted)
+	spec := filepath.Join(t.TempDir(), "openapi.yaml")
+	assert.NoError(t, os.WriteFile(spec, []byte(drifted), 0600))
+
+	testCases := []struct {
+		mode           string
+		expectedStatus int
+		expectedLogs   int
+	}{
+		{config.ResponseValidationOff, http.StatusOK, 0},
+		{config.ResponseValidationLog, http.StatusOK, 1},
+		{config.ResponseValidationEnforce, http.StatusInternalServerError, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.mode, func(t *testing.T) {
+			mockLogger.EXPECT().Error("response does not match the contract", gomock.Any()).Times(tc.expectedLogs)
+
+			cfg, err := config.NewConfig()
+			assert.NoError(t, err)
+			cfg.Auth.Disabled = true
+			cfg.OpenAPI3YamlFileLocation = spec
+			cfg.ResponseValidation = tc.mode
+			srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, utils.DefaultBodyReader)
+			testServer := httptest.NewServer(srv.NewRouter())
+			defer testServer.Close()
+
+			body := `{"data":"1234:1721964434:'Temperature':58.48"}`
+			resp, err := http.Post(testServer.URL+"/api/v1/temp", "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			if tc.expectedStatus == http.StatusOK {
+				var response models.TempPostGoodResponseWithOverTemp
+				assert.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+				assert.False(t, response.Overtemp)
+			} else {
+				// the reason of the mismatch is only logged
+				body, err := io.ReadAll(resp.Body)
+				assert.NoError(t, err)
+				assert.NotContains(t, string(body), "overtemp")
+				assert.Contains(t, string(body), "Response validation failed")
+			}
+		})
+	}
+}
+
+// TestOperationWithoutHandler tests that an operation added to the contract without a handler is refused
+func TestOperationWithoutHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
+
+	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Error("reload failed, the current configuration stays active", gomock.Any()).Times(1)
+
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.Auth.Disabled = true
+	srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, utils.DefaultBodyReader)
+	srv.NewRouter()
+
+	extended := strings.Replace(string(api.OpenAPISpec), "paths:\n", `paths:
+  /devices:
+    get:
+      operationId: DevicesGet
+      security: []
+      responses:
+        "200":
+          description: OK
+`, 1)
+	spec := filepath.Join(t.TempDir(), "openapi.yaml")
+	assert.NoError(t, os.WriteFile(spec, []byte(extended), 0600))
+
+	extendedCfg := *cfg
+	extendedCfg.OpenAPI3YamlFileLocation = spec
+	_, err = srv.Reload(func() (*config.Config, error) { return &extendedCfg, nil })
+	assert.ErrorContains(t, err, "GET /devices: operation DevicesGet is not in the generated code")
+}
+
+// TestProblemDetails tests that the problems tell the parser failures and the contract violations apart, and that
+// they match the contract
+func TestProblemDetails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
+
+	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockErrorStore.EXPECT().AddError(gomock.Any(), "1:2:'Temperature':hot", gomock.Any()).Times(1)
+
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.Auth.Disabled = true
+	cfg.ResponseValidation = config.ResponseValidationEnforce
+	srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, utils.DefaultBodyReader)
+
+	testServer := httptest.NewServer(srv.NewRouter())
+	defer testServer.Close()
+
+	testCases := []struct {
+		description    string
+		method         string
+		path           string
+		body           string
+		expectedCode   string
+		expectedDetail string
+		expectedErrors []models.ValidationError
+	}{
+		{"Parser failure", "POST", "/api/v1/temp", `{"data":"1:2:'Temperature':hot"}`, problem.CodeInvalidTemperature,
+			"could not parse temperature=hot to a float64", nil},
+		{"Invalid body", "POST", "/api/v1/temp", `{"foo":"bar"}`, problem.CodeInvalidBody,
+			`request body: property "data" is missing`,
+			[]models.ValidationError{{Pointer: "#/data", Detail: `property "data" is missing`}}},
+		{"Invalid parameter", "GET", "/api/v1/audit?limit=5000", "", problem.CodeInvalidParameter,
+			`parameter "limit" in query: number must be at most 1000`,
+			[]models.ValidationError{{In: "query", Parameter: "limit", Detail: "number must be at most 1000"}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, testServer.URL+tc.path, strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept", "application/problem+json")
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+			assert.Equal(t, problem.ContentType, resp.Header.Get("Content-Type"))
+
+			var response models.Problem
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+			assert.Equal(t, tc.expectedCode, response.Code)
+			assert.Equal(t, problem.TypeBase+tc.expectedCode, response.Type)
+			assert.Equal(t, tc.expectedDetail, response.Detail)
+			assert.Equal(t, tc.expectedErrors, response.Errors)
+			assert.Equal(t, strings.Split(tc.path, "?")[0], response.Instance)
+			assert.NotEmpty(t, response.RequestId)
+		})
+	}
+}
+
+// TestAPIVersions tests that v1 and v2 are served side by side, each validated against its own contract, and that v1
+// tells its clients about its deprecation
+func TestAPIVersions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
+
+	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockErrorStore.EXPECT().AddError(gomock.Any(), "foobar", gomock.Any()).Times(1)
+	mockErrorStore.EXPECT().DeleteErrors(gomock.Any()).Times(1)
+	mockFleetStore.EXPECT().RecordReading(gomock.Any(), gomock.Any(), true).Times(2)
+	mockAuditStore.EXPECT().Record(gomock.Any(), gomock.Any()).Times(1)
+
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.Auth.Disabled = true
+	cfg.ResponseValidation = config.ResponseValidationEnforce
+	srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, utils.DefaultBodyReader)
+	testServer := httptest.NewServer(srv.NewRouter())
+	defer testServer.Close()
+
+	do := func(method, path, body, accept string) *http.Response {
+		req, err := http.NewRequest(method, testServer.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	const reading = `{"data":"365951380:1722089835:'Temperature':98.48256793121914"}`
+
+	// v1 keeps its shapes, and points at v2
+	resp := do("POST", "/api/v1/temp", reading, "application/json")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, fmt.Sprintf("@%d", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC).Unix()), resp.Header.Get("Deprecation"))
+	assert.Equal(t, "Sun, 31 Oct 2027 00:00:00 GMT", resp.Header.Get("Sunset"))
+	assert.Equal(t, `</api/v2>; rel="successor-version"`, resp.Header.Get("Link"))
+	var v1Response models.TempPostGoodResponseWithOverTemp
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&v1Response))
+	assert.Equal(t, int32(365951380), v1Response.DeviceId)
+
+	// the rejected requests of v1 are told too
+	resp = do("GET", "/api/v1/audit?limit=5000", "", "application/json")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Deprecation"))
+
+	resp = do("POST", "/api/v2/temp", reading, "application/json")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Deprecation"))
+	assert.Empty(t, resp.Header.Get("Sunset"))
+	var v2Response models.TempReading
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&v2Response))
+	assert.Equal(t, models.TempReading{
+		DeviceId:    365951380,
+		Temperature: 98.48256793121914,
+		Overtemp:    true,
+		RecordedAt:  "2024-07-27T14:17:15Z",
+	}, v2Response)
+
+	// v2 never sends the legacy shape, whatever the client accepts
+	resp = do("POST", "/api/v2/temp", `{"data":"foobar"}`, "application/json")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, problem.ContentType, resp.Header.Get("Content-Type"))
+	var response models.Problem
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+	assert.Equal(t, problem.CodeInvalidArgumentCount, response.Code)
+	assert.Equal(t, "/api/v2/temp", response.Instance)
+
+	resp = do("DELETE", "/api/v2/errors", "", "application/json")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// the landing page is only part of v1
+	resp = do("GET", "/api/v2/", "", "application/json")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = do("GET", "/api/v2/admin/version", "", "application/json")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var version models.VersionResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&version))
+	assert.Equal(t, "1.0.0", version.APIVersion)
+	if assert.Len(t, version.Versions, 2) {
+		assert.Equal(t, "/api/v1", version.Versions[0].Prefix)
+		assert.Equal(t, "2027-10-31T00:00:00Z", version.Versions[0].SunsetAt)
+		assert.Equal(t, "/api/v2", version.Versions[0].Successor)
+		assert.Equal(t, models.APIVersion{Name: "v2", Prefix: "/api/v2", SpecVersion: version.Versions[1].SpecVersion, APIVersion: "2.0.0"}, version.Versions[1])
+	}
+}
+
+// BenchmarkOpenAPIMiddleware measures the validation of a /temp request, and of its response unless it is off, on
+// top of a handler that does nothing
+func BenchmarkOpenAPIMiddleware(b *testing.B) {
+	logger, err := logging.NewLogger(io.Discard, logging.FormatText, slog.LevelError)
+	if err != nil {
+		b.Fatal(err)
+	}
+	loader := openapi3.NewLoader()
+	spec, err := loader.LoadFromData(api.OpenAPISpec)
+	if err != nil {
+		b.Fatal(err)
+	}
+	router, err := gorillamux.NewRouter(spec)
+	if err != nil {
+		b.Fatal(err)
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"overtemp":false}`))
+	})
+	body := []byte(`{"data":"365951380:1640995229697:'Temperature':58.48256793121914"}`)
+
+	for _, mode := range []string{config.ResponseValidationOff, config.ResponseValidationEnforce} {
+		b.Run("response validation "+mode, func(b *testing.B) {
+			middleware := server.OpenAPIMiddleware(logger, router, openapi3filter.NoopAuthenticationFunc, mode, handler)
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					req := httptest.NewRequest(http.MethodPost, "/api/v1/temp", bytes.NewReader(body))
+					req.Header.Set("Content-Type", "application/json")
+					recorder := httptest.NewRecorder()
+					middleware.ServeHTTP(recorder, req)
+					if recorder.Code != http.StatusOK {
+						b.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body.String())
+					}
+				}
+			})
+		})
+	}
 }
@@ -0,0 +1,175 @@
+package server_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/server"
+	"github.com/sarabrajsingh/restful-openapi/internal/utils"
+	"github.com/sarabrajsingh/restful-openapi/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// issueCertificate creates a certificate signed by the parent, or a self-signed CA when parent is nil
+func issueCertificate(t *testing.T, template *x509.Certificate, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	signerCert, signerKey := template, key
+	if parent != nil {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCertificate{cert: cert, key: key, der: der}
+}
+
+func writePEM(t *testing.T, dir string, name string, blockType string, contents []byte) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: contents}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestMutualTLSDeviceBinding tests that a device certificate can only submit readings for its own device id
+func TestMutualTLSDeviceBinding(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir := t.TempDir()
+
+	ca := issueCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "device-ca"},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil)
+	serverCert := issueCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	deviceCert := issueCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "1234"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+
+	serverKeyDER, err := x509.MarshalECPrivateKey(serverCert.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tlsSettings := config.TLSConfig{
+		Mode:         config.TLSModeMutual,
+		CertFile:     writePEM(t, dir, "server.pem", "CERTIFICATE", serverCert.der),
+		KeyFile:      writePEM(t, dir, "server-key.pem", "EC PRIVATE KEY", serverKeyDER),
+		ClientCAFile: writePEM(t, dir, "ca.pem", "CERTIFICATE", ca.der),
+		BindDeviceId: true,
+	}
+
+	tlsConfig, err := server.NewTLSConfig(tlsSettings)
+	assert.NoError(t, err)
+
+	// Create mock dependencies
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
+
+	// Set up mock expectations
+	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockLogger.EXPECT().Println(gomock.Any()).AnyTimes()
+	mockFleetStore.EXPECT().RecordReading(gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
+
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.Auth.Disabled = true
+	cfg.TLS = tlsSettings
+	srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, utils.DefaultBodyReader)
+
+	testServer := httptest.NewUnstartedServer(srv.NewRouter())
+	testServer.TLS = tlsConfig
+	testServer.StartTLS()
+	defer testServer.Close()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.cert)
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs: rootCAs,
+				Certificates: []tls.Certificate{{
+					Certificate: [][]byte{deviceCert.der},
+					PrivateKey:  deviceCert.key,
+				}},
+			},
+		},
+	}
+
+	testCases := []struct {
+		description    string
+		deviceId       int
+		expectedStatus int
+	}{
+		{"Reading for the certificate's device", 1234, http.StatusOK},
+		{"Reading for another device", 4321, http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			body := fmt.Sprintf(`{"data":"%d:1721964434:'Temperature':95.0"}`, tc.deviceId)
+			resp, err := client.Post(testServer.URL+"/api/v1/temp", "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+		})
+	}
+
+	// without a client certificate the handshake is refused
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: rootCAs}}}
+	_, err = anonymous.Get(testServer.URL + "/api/v1/errors")
+	assert.Error(t, err)
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sarabrajsingh/restful-openapi/internal/requestid"
+	"github.com/sarabrajsingh/restful-openapi/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingMiddleware starts the server span of a request, continuing the trace of an incoming traceparent header
+func TracingMiddleware(inner http.Handler, name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		ctx, span := tracing.Tracer().Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				span.SetAttributes(semconv.HTTPRoute(template))
+			}
+		}
+
+		recorder := newResponseRecorder(w)
+		inner.ServeHTTP(recorder, r.WithContext(ctx))
+
+		span.SetAttributes(
+			semconv.HTTPResponseStatusCode(recorder.status),
+			// the request id middleware further in has set the header by now
+			attribute.StringSlice("http.response.header.x-request-id", []string{recorder.Header().Get(requestid.Header)}),
+		)
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
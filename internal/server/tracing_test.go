@@ -0,0 +1,84 @@
+package server_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/server"
+	"github.com/sarabrajsingh/restful-openapi/internal/utils"
+	"github.com/sarabrajsingh/restful-openapi/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// TestTracing tests that a request continues the caller's trace and records the spans of its stages
+func TestTracing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockErrorStore := mocks.NewMockErrorStore(ctrl)
+	mockFleetStore := mocks.NewMockFleetStore(ctrl)
+	mockAuditStore := mocks.NewMockAuditStore(ctrl)
+
+	mockLogger.EXPECT().Printf(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().With("request_id", gomock.Any(), "trace_id", "4bf92f3577b34da6a3ce929d0e0e4736").Return(mockLogger).Times(1)
+	mockFleetStore.EXPECT().RecordReading(gomock.Any(), gomock.Any(), true).Times(1)
+
+	cfg, err := config.NewConfig()
+	assert.NoError(t, err)
+	cfg.Auth.Disabled = true
+	srv := server.NewServer(cfg, mockLogger, mockErrorStore, mockFleetStore, mockAuditStore, utils.DefaultBodyReader)
+
+	testServer := httptest.NewServer(srv.NewRouter())
+	defer testServer.Close()
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/v1/temp", testServer.URL), strings.NewReader(`{"data":"1234:1721964434:'Temperature':95.0"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	for _, name := range []string{"TempPost", "openapi.FindRoute", "openapi.ValidateRequest", "PayloadParserHelper", "TemperatureHelper"} {
+		span, ok := spans[name]
+		if !assert.True(t, ok, "missing span %s", name) {
+			continue
+		}
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	}
+
+	serverSpan := spans["TempPost"]
+	assert.Equal(t, trace.SpanKindServer, serverSpan.SpanKind())
+	assert.Equal(t, "00f067aa0ba902b7", serverSpan.Parent().SpanID().String())
+	assert.Equal(t, serverSpan.SpanContext().SpanID(), spans["PayloadParserHelper"].Parent().SpanID())
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/sarabrajsingh/restful-openapi/api"
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/models"
+	"github.com/sarabrajsingh/restful-openapi/internal/problem"
+)
+
+// the extensions of the info object of a contract that deprecate its version
+const (
+	deprecatedAtExtension = "x-deprecated-at"
+	sunsetAtExtension     = "x-sunset-at"
+	successorExtension    = "x-successor-version"
+)
+
+// versionSource tells where the contract of a version of the API is read from, and which handlers serve it
+type versionSource struct {
+	name string
+	// specPath is where the contract is served to the Swagger UI
+	specPath string
+	embedded []byte
+	file     func(*config.Config) string
+	handlers func(*serverImpl, *config.Config) operationHandlers
+	// problemsOnly is set for the versions that never sent the legacy {"error": ...} shape
+	problemsOnly bool
+}
+
+// versionSources lists the versions of the API served side by side, the oldest first
+var versionSources = []versionSource{
+	{
+		name:     "v1",
+		specPath: OpenAPISpecPath,
+		embedded: api.OpenAPISpec,
+		file:     func(cfg *config.Config) string { return cfg.OpenAPI3YamlFileLocation },
+		handlers: (*serverImpl).handlersV1,
+	},
+	{
+		name:         "v2",
+		specPath:     OpenAPISpecV2Path,
+		embedded:     api.OpenAPISpecV2,
+		file:         func(cfg *config.Config) string { return cfg.OpenAPISpecV2 },
+		handlers:     (*serverImpl).handlersV2,
+		problemsOnly: true,
+	},
+}
+
+// apiVersion is a loaded version of the API: its contract, the prefix its routes are served under, taken from the
+// servers of the contract, and its deprecation
+type apiVersion struct {
+	name          string
+	prefix        string
+	specPath      string
+	specification *openapi3.T
+	specData      []byte
+	specVersion   string
+	problemsOnly  bool
+	deprecatedAt  time.Time
+	sunsetAt      time.Time
+	successor     string
+}
+
+// loadVersion reads and validates the contract of a version, from disk when a path is configured, otherwise the copy
+// built into the binary
+func (s *serverImpl) loadVersion(cfg *config.Config, source versionSource) (*apiVersion, error) {
+	loader := openapi3.NewLoader()
+
+	var spec *openapi3.T
+	specData := source.embedded
+	var err error
+	if file := source.file(cfg); file == "" {
+		spec, err = loader.LoadFromData(specData)
+	} else {
+		specData, err = os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load OpenAPI spec of %s: %w", source.name, err)
+		}
+		s.logger.Printf("Loading the contract of %s from %s", source.name, file)
+		// the path lets references to other files be resolved
+		spec, err = loader.LoadFromDataWithPath(specData, &url.URL{Path: filepath.ToSlash(file)})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load OpenAPI spec of %s: %w", source.name, err)
+	}
+
+	err = spec.Validate(loader.Context)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to validate OpenAPI spec of %s: %w", source.name, err)
+	}
+
+	// the routes are registered under the path of the first server, which the OpenAPI router matches as well
+	if len(spec.Servers) == 0 || !strings.HasPrefix(spec.Servers[0].URL, "/") {
+		return nil, fmt.Errorf("Failed to validate OpenAPI spec of %s: the first server must be a path, e.g. /api/%s", source.name, source.name)
+	}
+
+	sum := sha256.Sum256(specData)
+	version := &apiVersion{
+		name:          source.name,
+		prefix:        strings.TrimSuffix(spec.Servers[0].URL, "/"),
+		specPath:      source.specPath,
+		specification: spec,
+		specData:      specData,
+		specVersion:   hex.EncodeToString(sum[:])[:12],
+		problemsOnly:  source.problemsOnly,
+	}
+
+	if version.deprecatedAt, err = timeExtension(spec.Info, deprecatedAtExtension); err == nil {
+		version.sunsetAt, err = timeExtension(spec.Info, sunsetAtExtension)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to validate OpenAPI spec of %s: %w", source.name, err)
+	}
+	if successor, ok := spec.Info.Extensions[successorExtension].(string); ok {
+		version.successor = successor
+	}
+	return version, nil
+}
+
+// timeExtension reads an RFC 3339 time out of an extension of the info object; the time is zero when it is not set
+func timeExtension(info *openapi3.Info, name string) (time.Time, error) {
+	value, ok := info.Extensions[name]
+	if !ok {
+		return time.Time{}, nil
+	}
+	text, ok := value.(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time, got %v", name, value)
+	}
+	parsed, err := time.Parse(time.RFC3339, text)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time: %w", name, err)
+	}
+	return parsed.UTC(), nil
+}
+
+// describe reports the version in the response of GET /admin/version
+func (v *apiVersion) describe() models.APIVersion {
+	response := models.APIVersion{
+		Name:        v.name,
+		Prefix:      v.prefix,
+		SpecVersion: v.specVersion,
+		APIVersion:  v.specification.Info.Version,
+		Successor:   v.successor,
+	}
+	if !v.deprecatedAt.IsZero() {
+		response.DeprecatedAt = v.deprecatedAt.Format(time.RFC3339)
+	}
+	if !v.sunsetAt.IsZero() {
+		response.SunsetAt = v.sunsetAt.Format(time.RFC3339)
+	}
+	return response
+}
+
+// VersionMiddleware tells the clients of a deprecated version when it was deprecated (RFC 9745), when it stops being
+// served (RFC 8594) and which version replaces it, on every response including the rejected requests
+func VersionMiddleware(version *apiVersion, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !version.deprecatedAt.IsZero() {
+			w.Header().Set("Deprecation", "@"+strconv.FormatInt(version.deprecatedAt.Unix(), 10))
+		}
+		if !version.sunsetAt.IsZero() {
+			w.Header().Set("Sunset", version.sunsetAt.Format(http.TimeFormat))
+		}
+		if version.successor != "" {
+			w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", version.successor))
+		}
+		if version.problemsOnly {
+			r = r.WithContext(problem.ProblemsOnly(r.Context()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
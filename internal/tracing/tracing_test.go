@@ -0,0 +1,49 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestSetupStdout(t *testing.T) {
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	var buf bytes.Buffer
+	shutdown, err := tracing.Setup(context.Background(), config.TracingConfig{
+		Exporter:    config.TracingExporterStdout,
+		SampleRatio: 1,
+		ServiceName: "restful-openapi-test",
+	}, &buf)
+	assert.NoError(t, err)
+
+	_, span := tracing.Tracer().Start(context.Background(), "PayloadParserHelper")
+	span.End()
+
+	// spans are batched until the provider shuts down
+	assert.NoError(t, shutdown(context.Background()))
+	assert.Contains(t, buf.String(), `"Name":"PayloadParserHelper"`)
+	assert.Contains(t, buf.String(), "restful-openapi-test")
+}
+
+func TestSetupNone(t *testing.T) {
+	var buf bytes.Buffer
+	shutdown, err := tracing.Setup(context.Background(), config.TracingConfig{Exporter: config.TracingExporterNone}, &buf)
+	assert.NoError(t, err)
+
+	_, span := tracing.Tracer().Start(context.Background(), "PayloadParserHelper")
+	span.End()
+
+	assert.NoError(t, shutdown(context.Background()))
+	assert.False(t, span.SpanContext().IsSampled())
+	assert.Empty(t, buf.String())
+
+	_, err = tracing.Setup(context.Background(), config.TracingConfig{Exporter: "zipkin"}, &buf)
+	assert.Error(t, err)
+}
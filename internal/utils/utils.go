@@ -10,15 +10,17 @@ import (
 	"time"
 
 	"github.com/sarabrajsingh/restful-openapi/internal/models"
+	"github.com/sarabrajsingh/restful-openapi/internal/requestid"
 )
 
 // a helper function that marshalls an error string into a proper response object to be
-// written to the http response writer
+// written to the http response writer; the X-Request-ID already set on the response is copied into the body
 func WriteErrorResponse(w http.ResponseWriter, errorMessage string, statusCode int) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(statusCode)
 	errorResponse := models.Response400{
-		Error: errorMessage,
+		Error:     errorMessage,
+		RequestId: w.Header().Get(requestid.Header),
 	}
 	json.NewEncoder(w).Encode(errorResponse)
 }
@@ -29,9 +31,13 @@ func DefaultBodyReader(r io.Reader) ([]byte, error) {
 	return io.ReadAll(r)
 }
 
-func TemperatureHelper(actual *models.TempPostPayload, response *models.TempPostResponse) {
+// DefaultOvertempThreshold is the temperature at and above which a reading is reported as overtemp
+const DefaultOvertempThreshold = 90.00
+
+// TemperatureHelper fills in the response to an overtemp reading; only Overtemp is set, to false, for the others
+func TemperatureHelper(actual *models.TempPostPayload, threshold float64, response *models.TempPostGoodResponseWithOverTemp) {
 	// parse out the meat and potatoes
-	if actual.Temperature >= 90.00 {
+	if actual.Temperature >= threshold {
 		response.Overtemp = true
 		response.DeviceId = actual.DeviceId
 		// convert epoch into an epochInt and then into a time object
@@ -44,30 +50,63 @@ func TemperatureHelper(actual *models.TempPostPayload, response *models.TempPost
 	}
 }
 
+// maxEpochSeconds is the largest epoch read in seconds, in the year 5138; larger ones can only be milliseconds
+const maxEpochSeconds = 1e11
+
+// ReadingTime is the time of the epoch of a data string. Most devices send seconds, some send milliseconds as the
+// name epoch_ms suggests; the formatted_time of v1 keeps reading both as seconds.
+func ReadingTime(epoch int64) time.Time {
+	if epoch > maxEpochSeconds || epoch < -maxEpochSeconds {
+		return time.UnixMilli(epoch).UTC()
+	}
+	return time.Unix(epoch, 0).UTC()
+}
+
+// reasons a /temp payload is rejected, used to label the parse failure metrics
+const (
+	ParseReasonBody           = "body"
+	ParseReasonJSON           = "json"
+	ParseReasonArguments      = "arguments"
+	ParseReasonDeviceId       = "device_id"
+	ParseReasonEpoch          = "epoch"
+	ParseReasonTemperatureKey = "temperature_key"
+	ParseReasonTemperature    = "temperature"
+)
+
+// ParseError is returned by PayloadParserHelper along with the reason the data string was rejected
+type ParseError struct {
+	Reason  string
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return e.Message
+}
+
 func PayloadParserHelper(payloadData string) (*models.TempPostPayload, error) {
 	data := strings.Split(payloadData, ":")
 
 	if len(data) != 4 {
-		return nil, fmt.Errorf("invalid number of arguments in request body")
+		return nil, &ParseError{ParseReasonArguments, "invalid number of arguments in request body"}
 	}
 
 	deviceId, err := strconv.ParseInt(data[0], 10, 32)
 	if err != nil {
-		return nil, fmt.Errorf("could not parse device_id=%s to an int32", data[0])
+		return nil, &ParseError{ParseReasonDeviceId, fmt.Sprintf("could not parse device_id=%s to an int32", data[0])}
 	}
 
 	epochMS, err := strconv.ParseInt(data[1], 10, 64)
 	if err != nil {
-		return nil, fmt.Errorf("could not parse epochMS=%s to an int64", data[1])
+		return nil, &ParseError{ParseReasonEpoch, fmt.Sprintf("could not parse epochMS=%s to an int64", data[1])}
 	}
 
 	if string(data[2]) != string("'Temperature'") {
-		return nil, fmt.Errorf("temperature key is mislabelled: %s", data[2])
+		return nil, &ParseError{ParseReasonTemperatureKey, fmt.Sprintf("temperature key is mislabelled: %s", data[2])}
 	}
 
 	temperature, err := strconv.ParseFloat(data[3], 64)
 	if err != nil {
-		return nil, fmt.Errorf("could not parse temperature=%s to a float64", data[3])
+		return nil, &ParseError{ParseReasonTemperature, fmt.Sprintf("could not parse temperature=%s to a float64", data[3])}
 	}
 
 	// these casts may be unncessary
@@ -2,6 +2,7 @@ package utils_test
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http/httptest"
 	"testing"
 	"time"
@@ -173,7 +174,7 @@ func TestTemperatureHelper(t *testing.T) {
 	tests := []struct {
 		name          string
 		actualPayload models.TempPostPayload
-		expectedResp  models.TempPostResponse
+		expectedResp  models.TempPostGoodResponseWithOverTemp
 	}{
 		{
 			name: "Temperature above threshold",
@@ -182,7 +183,7 @@ func TestTemperatureHelper(t *testing.T) {
 				EpochMS:     1721964434,
 				Temperature: 95.0,
 			},
-			expectedResp: models.TempPostResponse{
+			expectedResp: models.TempPostGoodResponseWithOverTemp{
 				Overtemp:      true,
 				DeviceId:      1234,
 				FormattedTime: time.Unix(1721964434, 0).Format("2006/01/02 15:04:05"),
@@ -195,7 +196,7 @@ func TestTemperatureHelper(t *testing.T) {
 				EpochMS:     1721964434,
 				Temperature: 85.0,
 			},
-			expectedResp: models.TempPostResponse{
+			expectedResp: models.TempPostGoodResponseWithOverTemp{
 				Overtemp: false,
 			},
 		},
@@ -203,8 +204,8 @@ func TestTemperatureHelper(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			var resp models.TempPostResponse
-			utils.TemperatureHelper(&tt.actualPayload, &resp)
+			var resp models.TempPostGoodResponseWithOverTemp
+			utils.TemperatureHelper(&tt.actualPayload, utils.DefaultOvertempThreshold, &resp)
 
 			if resp.Overtemp != tt.expectedResp.Overtemp {
 				t.Errorf("expected Overtemp %v, got %v", tt.expectedResp.Overtemp, resp.Overtemp)
@@ -218,3 +219,84 @@ func TestTemperatureHelper(t *testing.T) {
 		})
 	}
 }
+
+func TestPayloadParserHelperReason(t *testing.T) {
+	testCases := map[string]string{
+		"1234:1721964434:95.0":              utils.ParseReasonArguments,
+		"abc:1721964434:'Temperature':95.0": utils.ParseReasonDeviceId,
+		"1234:abc:'Temperature':95.0":       utils.ParseReasonEpoch,
+		"1234:1721964434:'Temp':95.0":       utils.ParseReasonTemperatureKey,
+		"1234:1721964434:'Temperature':abc": utils.ParseReasonTemperature,
+	}
+
+	for payloadData, expectedReason := range testCases {
+		_, err := utils.PayloadParserHelper(payloadData)
+
+		var parseError *utils.ParseError
+		if !errors.As(err, &parseError) {
+			t.Fatalf("Expected a ParseError for %s, got: %v", payloadData, err)
+		}
+		if parseError.Reason != expectedReason {
+			t.Errorf("Expected reason %s for %s, got: %s", expectedReason, payloadData, parseError.Reason)
+		}
+	}
+}
+
+// TestReadingTime tests that epochs in seconds and in milliseconds are told apart
+func TestReadingTime(t *testing.T) {
+	testCases := []struct {
+		epoch    int64
+		expected time.Time
+	}{
+		{1722089835, time.Date(2024, 7, 27, 14, 17, 15, 0, time.UTC)},
+		{1640995229697, time.Date(2022, 1, 1, 0, 0, 29, 697000000, time.UTC)},
+		{0, time.Unix(0, 0).UTC()},
+	}
+
+	for _, tc := range testCases {
+		if actual := utils.ReadingTime(tc.epoch); !actual.Equal(tc.expected) {
+			t.Errorf("Expected %d to be read as %v, got %v", tc.epoch, tc.expected, actual)
+		}
+	}
+}
+
+func BenchmarkPayloadParserHelper(b *testing.B) {
+	benchmarks := []struct {
+		description string
+		payloadData string
+	}{
+		{"valid", "365951380:1640995229697:'Temperature':58.48256793121914"},
+		{"malformed arguments", "365951380:1640995229697:58.48256793121914"},
+		{"malformed temperature", "365951380:1640995229697:'Temperature':58.48C"},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.description, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				utils.PayloadParserHelper(bm.payloadData)
+			}
+		})
+	}
+}
+
+func BenchmarkTemperatureHelper(b *testing.B) {
+	benchmarks := []struct {
+		description string
+		temperature float64
+	}{
+		{"below threshold", 58.48256793121914},
+		{"overtemp", 98.48256793121914},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.description, func(b *testing.B) {
+			payload := &models.TempPostPayload{DeviceId: 365951380, EpochMS: 1640995229697, Temperature: bm.temperature}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var response models.TempPostGoodResponseWithOverTemp
+				utils.TemperatureHelper(payload, utils.DefaultOvertempThreshold, &response)
+			}
+		})
+	}
+}
@@ -9,8 +9,14 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
-	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	// WARNING!
 	// Change this to a fully-qualified import path
@@ -21,28 +27,121 @@ import (
 	//
 
 	"github.com/sarabrajsingh/restful-openapi/config"
+	"github.com/sarabrajsingh/restful-openapi/internal/audit"
+	"github.com/sarabrajsingh/restful-openapi/internal/fleet"
 	"github.com/sarabrajsingh/restful-openapi/internal/global_errors"
 	"github.com/sarabrajsingh/restful-openapi/internal/logging"
+	"github.com/sarabrajsingh/restful-openapi/internal/reload"
 	sw "github.com/sarabrajsingh/restful-openapi/internal/server"
+	"github.com/sarabrajsingh/restful-openapi/internal/tracing"
 	"github.com/sarabrajsingh/restful-openapi/internal/utils"
 )
 
 func main() {
-	logger := logging.NewRealLogger()
+	// defaults, then the configuration file, the environment and the flags; reloads read the same layers again
+	load := func() (*config.Config, error) {
+		return config.Load(os.Args[1:])
+	}
+	config, err := load()
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Couldn't load config: %v", err)
+	}
+	if config.PrintConfig {
+		if err := config.Print(os.Stdout); err != nil {
+			log.Fatalf("Couldn't print config: %v", err)
+		}
+		return
+	}
+
+	logLevel, err := logging.ParseLevel(config.LogLevel)
+	if err != nil {
+		log.Fatalf("Couldn't load config: %v", err)
+	}
+	logger, err := logging.NewLogger(os.Stdout, config.LogFormat, logLevel)
+	if err != nil {
+		log.Fatalf("Couldn't load config: %v", err)
+	}
+
+	// OpenTelemetry spans for the configured exporter
+	shutdownTracing, err := tracing.Setup(context.Background(), config.Tracing, os.Stdout)
+	if err != nil {
+		log.Fatalf("Couldn't set up tracing: %v", err)
+	}
+	if config.Tracing.Enabled() {
+		logger.Printf("Tracing enabled with the %s exporter", config.Tracing.Exporter)
+	}
+
 	// in memory error store
-	errorStore := global_errors.NewErrorStore()
+	errorStore := global_errors.NewErrorStoreWithSize(config.ErrorBufferSize)
+	// in memory fleet state fed by the ingestion path
+	fleetStore := fleet.NewFleetStoreWithClock(config.FleetOfflineAfter, time.Now)
 	bodyReader := utils.DefaultBodyReader
 	logger.Printf("Server started")
+	if config.File != "" {
+		logger.Printf("Configuration loaded from %s", config.File)
+	}
 
-	config, err := config.NewConfig()
-	if err != nil {
-		log.Fatalf("Couldn't load config: %v", err)
+	// append-only audit log of administrative actions
+	auditStore := audit.NewAuditStore()
+	if config.AuditLogFile != "" {
+		auditStore, err = audit.NewFileAuditStore(config.AuditLogFile)
+		if err != nil {
+			log.Fatalf("Couldn't open audit log: %v", err)
+		}
 	}
 
-	server := sw.NewServer(config, logger, errorStore, bodyReader)
+	server := sw.NewServer(config, logger, errorStore, fleetStore, auditStore, bodyReader)
 	router := server.NewRouter()
-	port := ":8080"
 
-	logger.Printf("API server is running on port %s\n", port)
-	log.Fatal(http.ListenAndServe(port, router))
+	tlsConfig, err := sw.NewTLSConfig(config.TLS)
+	if err != nil {
+		log.Fatalf("Couldn't load TLS config: %v", err)
+	}
+
+	httpServer := sw.NewHTTPServer(config, router, tlsConfig)
+
+	// flushed once the in-flight requests have finished, the spans last so that they cover the shutdown
+	lifecycle := sw.NewLifecycle(logger, config.HTTPServer, server, httpServer)
+	lifecycle.OnShutdown("tracing", shutdownTracing)
+	lifecycle.OnShutdown("audit", func(ctx context.Context) error {
+		return auditStore.Close(logger)
+	})
+
+	// deploys send SIGTERM, a terminal sends SIGINT
+	ctx := shutdownContext(logger)
+
+	// SIGHUP or a change to the configuration, the contract or the files they point at swaps in new routes
+	reloader := reload.NewReloader(logger, load, server.Reload, auditStore, config)
+	go reloader.Run(ctx)
+
+	if tlsConfig == nil {
+		logger.Printf("API server is running on port %s\n", httpServer.Addr)
+	} else {
+		logger.Printf("API server is running on port %s with TLS mode %s\n", httpServer.Addr, config.TLS.Mode)
+	}
+	if err := lifecycle.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// shutdownContext is cancelled by the first SIGTERM or SIGINT, which drains the server; the signals are still read
+// during the drain, and a second one exits at once without waiting for the drain period or the in-flight requests
+func shutdownContext(logger logging.Logger) context.Context {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		received := <-signals
+		logger.Info("received signal, send it again to exit without draining", "signal", received)
+		cancel()
+
+		received = <-signals
+		logger.Warn("received a second signal, exiting without draining", "signal", received)
+		os.Exit(1)
+	}()
+	return ctx
 }
@@ -0,0 +1,23 @@
+package swaggerui
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// only the assets loaded by index.html are built into the binary; the source maps and the ES bundles
+// stay on disk, and openapi.yaml and openapi.v2.yaml are served from the contracts loaded by the server
+//
+//go:embed dist/index.html dist/index.css dist/oauth2-redirect.html dist/favicon-16x16.png dist/favicon-32x32.png
+//go:embed dist/swagger-ui.css dist/swagger-ui-bundle.js dist/swagger-ui-standalone-preset.js
+var dist embed.FS
+
+// FS returns the Swagger UI built into the binary, served unless a Swagger UI folder is configured
+func FS() fs.FS {
+	assets, err := fs.Sub(dist, "dist")
+	if err != nil {
+		// the directory is embedded above, so this can't happen
+		panic(err)
+	}
+	return assets
+}